@@ -0,0 +1,248 @@
+package mp4
+
+// Audio object types (ISO/IEC 14496-3) that codec strings such as "mp4a.40.2"
+// carry after the object type indication.
+const (
+	AudioObjectTypeAACMain = 1
+	AudioObjectTypeAACLC   = 2
+	AudioObjectTypeAACLTP  = 4
+	AudioObjectTypeSBR     = 5  // HE-AAC
+	AudioObjectTypeERAACLD = 23 // AAC-LD
+	AudioObjectTypePS      = 29 // HE-AAC v2
+	AudioObjectTypeUSAC    = 42 // xHE-AAC
+)
+
+// Sync extension types of the explicit, backward compatible signaling of SBR
+// and PS after an AudioSpecificConfig.
+const (
+	syncExtensionSBR = 0x2b7
+	syncExtensionPS  = 0x548
+)
+
+// samplingFrequencies maps a sampling frequency index to Hz. Indexes 13 and 14
+// are reserved and 15 escapes to an explicit 24-bit frequency.
+var samplingFrequencies = [...]uint32{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350, 0, 0,
+}
+
+// channelCounts maps a channel configuration to its number of channels.
+var channelCounts = [16]uint8{0, 1, 2, 3, 4, 5, 6, 8, 0, 0, 0, 7, 8, 24, 8, 0}
+
+// AudioSpecificConfig is the MPEG-4 audio decoder configuration held in the
+// DecoderSpecificInfo of an esds box.
+type AudioSpecificConfig struct {
+	// ObjectType is the audio object type of the core codec, such as
+	// AudioObjectTypeAACLC. For HE-AAC it is the type SBR extends, not
+	// AudioObjectTypeSBR.
+	ObjectType uint8
+
+	SampleRate    uint32 // core sampling frequency in Hz; zero for a reserved index
+	ChannelConfig uint8  // zero when a program config element lists the channels
+
+	// Channels is the number of output channels: those of ChannelConfig or
+	// the program config element, and two for mono with PS.
+	Channels uint16
+
+	// SBR and PS report spectral band replication (HE-AAC) and parametric
+	// stereo (HE-AAC v2), whether signaled by the object type or by a sync
+	// extension after the config. ExtSampleRate is the output sampling
+	// frequency with SBR, or zero.
+	SBR           bool
+	PS            bool
+	ExtSampleRate uint32
+}
+
+// ReadAudioSpecificConfig decodes an AudioSpecificConfig, such as the
+// DecoderSpecificInfo of an [ESDescriptor]. It reads the sync extensions that
+// signal SBR and PS only after the GASpecificConfig of the AAC object types,
+// the only configs it decodes in full. It returns [ErrShortBox] if data ends
+// early.
+func ReadAudioSpecificConfig(data []byte) (AudioSpecificConfig, error) {
+	b := bitReader{data: data}
+	var c AudioSpecificConfig
+	c.ObjectType = b.objectType()
+	c.SampleRate = b.frequency()
+	c.ChannelConfig = uint8(b.read(4))
+	c.Channels = uint16(channelCounts[c.ChannelConfig])
+	explicit := false
+	if c.ObjectType == AudioObjectTypeSBR || c.ObjectType == AudioObjectTypePS {
+		explicit = true
+		c.SBR = true
+		c.PS = c.ObjectType == AudioObjectTypePS
+		c.ExtSampleRate = b.frequency()
+		c.ObjectType = b.objectType()
+		if c.ObjectType == 22 { // ER BSAC
+			b.read(4) // extensionChannelConfiguration
+		}
+	}
+
+	switch c.ObjectType {
+	case 1, 2, 3, 4, 6, 7, 17, 19, 20, 21, 22, 23:
+		b.gaSpecificConfig(&c)
+	default:
+		return c.finish(&b)
+	}
+	switch c.ObjectType {
+	case 17, 19, 20, 21, 22, 23:
+		if ep := b.read(2); ep >= 2 {
+			// Error protection config: the sync extension cannot be found.
+			return c.finish(&b)
+		}
+	}
+
+	if !explicit && b.left() >= 16 && b.read(11) == syncExtensionSBR {
+		switch b.objectType() {
+		case AudioObjectTypeSBR:
+			if c.SBR = b.read(1) == 1; c.SBR {
+				c.ExtSampleRate = b.frequency()
+				if b.left() >= 12 && b.read(11) == syncExtensionPS {
+					c.PS = b.read(1) == 1
+				}
+			}
+		case 22:
+			if c.SBR = b.read(1) == 1; c.SBR {
+				c.ExtSampleRate = b.frequency()
+			}
+			b.read(4) // extensionChannelConfiguration
+		}
+	}
+	return c.finish(&b)
+}
+
+// finish applies PS to the channel count and returns c with the reader's error.
+func (c *AudioSpecificConfig) finish(b *bitReader) (AudioSpecificConfig, error) {
+	if b.err != nil {
+		return AudioSpecificConfig{}, b.err
+	}
+	if c.PS && c.Channels == 1 {
+		c.Channels = 2
+	}
+	return *c, nil
+}
+
+// CodecObjectType returns the audio object type that names the stream in a
+// codec string: AudioObjectTypePS for HE-AAC v2, AudioObjectTypeSBR for
+// HE-AAC and ObjectType otherwise.
+func (c *AudioSpecificConfig) CodecObjectType() uint8 {
+	switch {
+	case c.PS:
+		return AudioObjectTypePS
+	case c.SBR:
+		return AudioObjectTypeSBR
+	}
+	return c.ObjectType
+}
+
+// OutputSampleRate returns the sampling frequency a decoder outputs: the SBR
+// frequency if there is one and the core frequency otherwise.
+func (c *AudioSpecificConfig) OutputSampleRate() uint32 {
+	if c.SBR && c.ExtSampleRate != 0 {
+		return c.ExtSampleRate
+	}
+	return c.SampleRate
+}
+
+// gaSpecificConfig reads the GASpecificConfig of the AAC object types,
+// counting the channels of its program config element if there is one.
+func (b *bitReader) gaSpecificConfig(c *AudioSpecificConfig) {
+	b.read(1) // frameLengthFlag
+	if b.read(1) == 1 {
+		b.read(14) // coreCoderDelay
+	}
+	extension := b.read(1) == 1
+	if c.ChannelConfig == 0 {
+		c.Channels = b.programConfigElement()
+	}
+	if c.ObjectType == 6 || c.ObjectType == 20 {
+		b.read(3) // layerNr
+	}
+	if extension {
+		switch c.ObjectType {
+		case 22:
+			b.read(5 + 11) // numOfSubFrame, layer_length
+		case 17, 19, 20, 23:
+			b.read(3) // resilience flags
+		}
+		b.read(1) // extensionFlag3
+	}
+}
+
+// programConfigElement reads a program_config_element and returns its number
+// of channels.
+func (b *bitReader) programConfigElement() uint16 {
+	b.read(4 + 2 + 4) // element_instance_tag, object_type, sampling_frequency_index
+	front := b.read(4)
+	side := b.read(4)
+	back := b.read(4)
+	lfe := b.read(2)
+	assoc := b.read(3)
+	cc := b.read(4)
+	if b.read(1) == 1 {
+		b.read(4) // mono_mixdown_element_number
+	}
+	if b.read(1) == 1 {
+		b.read(4) // stereo_mixdown_element_number
+	}
+	if b.read(1) == 1 {
+		b.read(2 + 1) // matrix_mixdown_idx, pseudo_surround_enable
+	}
+	n := lfe
+	for range front + side + back {
+		if b.read(1) == 1 { // is_cpe
+			n++
+		}
+		n++
+		b.read(4) // element_tag_select
+	}
+	b.read(int(4*lfe + 4*assoc + 5*cc))
+	b.pos = (b.pos + 7) &^ 7 // byte_alignment
+	b.read(8 * int(b.read(8)))
+	return uint16(n)
+}
+
+// bitReader reads big-endian bit fields, recording [ErrShortBox] once a read
+// runs past the data.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+	err  error
+}
+
+// read returns the next n bits. Fields wider than 32 bits are skipped.
+func (b *bitReader) read(n int) uint32 {
+	if b.err != nil {
+		return 0
+	}
+	if n > b.left() {
+		b.err = ErrShortBox
+		return 0
+	}
+	var v uint32
+	for range n {
+		v = v<<1 | uint32(b.data[b.pos>>3]>>(7-b.pos&7))&1
+		b.pos++
+	}
+	return v
+}
+
+// left returns the number of unread bits.
+func (b *bitReader) left() int { return 8*len(b.data) - b.pos }
+
+// objectType reads an audio object type, with its escape for types above 30.
+func (b *bitReader) objectType() uint8 {
+	t := uint8(b.read(5))
+	if t == 31 {
+		t = 32 + uint8(b.read(6))
+	}
+	return t
+}
+
+// frequency reads a sampling frequency index and, for index 15, the explicit
+// frequency.
+func (b *bitReader) frequency() uint32 {
+	i := b.read(4)
+	if i == 15 {
+		return b.read(24)
+	}
+	return samplingFrequencies[i]
+}
@@ -56,9 +56,9 @@ func walkBench(r *mp4.Reader) {
 			if r.Next() {
 				switch r.Type() {
 				case mp4.TypeAvc1:
-					_ = mp4.ReadVisualSampleEntry(r.Data())
+					_, _ = mp4.ReadVisualSampleEntry(r.Data())
 				case mp4.TypeMp4a:
-					_ = mp4.ReadAudioSampleEntry(r.Data())
+					_, _ = mp4.ReadAudioSampleEntry(r.Data())
 				}
 			}
 			r.Exit()
@@ -114,6 +114,23 @@ func BenchmarkStszIter(b *testing.B) {
 	}
 }
 
+func BenchmarkStszIterAll(b *testing.B) {
+	data := loadTestFile(b)
+	m, err := mp4.Find(data, "moov/trak/mdia/minf/stbl/stsz")
+	if err != nil {
+		b.Skipf("no stsz found: %v", err)
+	}
+
+	b.SetBytes(int64(len(m.Data)))
+	b.ReportAllocs()
+
+	for b.Loop() {
+		it := mp4.NewStszIter(m.Data)
+		for range it.All() {
+		}
+	}
+}
+
 func BenchmarkWriterBuild(b *testing.B) {
 	buf := make([]byte, 4096)
 
@@ -128,7 +145,7 @@ func BenchmarkWriterBuild(b *testing.B) {
 		w.StartBox(mp4.TypeTrak)
 		w.WriteTkhd(0x03, 1, 30000, 1920<<16, 1080<<16)
 		w.StartBox(mp4.TypeMdia)
-		w.WriteMdhd(12288, 368640, 0x55C4)
+		w.WriteMdhd(12288, 368640, "und")
 		w.WriteHdlr([4]byte{'v', 'i', 'd', 'e'}, "VideoHandler")
 		w.EndBox() // mdia
 		w.EndBox() // trak
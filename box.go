@@ -37,6 +37,8 @@ var (
 	TypeNmhd = BoxType{'n', 'm', 'h', 'd'} // Null media header
 	TypeDinf = BoxType{'d', 'i', 'n', 'f'} // Data information container
 	TypeDref = BoxType{'d', 'r', 'e', 'f'} // Data reference (URL/URN entries)
+	TypeUrl  = BoxType{'u', 'r', 'l', ' '} // Data entry URL
+	TypeUrn  = BoxType{'u', 'r', 'n', ' '} // Data entry URN
 )
 
 // Sample table boxes (stbl children).
@@ -83,6 +85,7 @@ var (
 var (
 	TypeMeta = BoxType{'m', 'e', 't', 'a'} // Metadata container
 	TypeUdta = BoxType{'u', 'd', 't', 'a'} // User data container
+	TypeIlst = BoxType{'i', 'l', 's', 't'} // iTunes metadata item list
 )
 
 // Data boxes.
@@ -92,6 +95,13 @@ var (
 	TypeSkip = BoxType{'s', 'k', 'i', 'p'} // Free space (can be skipped)
 )
 
+// TypeUuid is the type of boxes identified by a 16-byte extended type that
+// follows the size and type fields, such as PIFF sample encryption and XMP.
+var TypeUuid = BoxType{'u', 'u', 'i', 'd'}
+
+// uuidSize is the size of the extended type in a uuid box header.
+const uuidSize = 16
+
 // Sample entry boxes (children of stsd).
 var (
 	TypeAvc1 = BoxType{'a', 'v', 'c', '1'} // AVC/H.264 visual sample entry
@@ -114,7 +124,10 @@ func IsFullBox(t BoxType) bool {
 		TypeMeta, TypeEsds, TypeMehd, TypeTrex,
 		TypeMfhd, TypeTfhd, TypeTfdt, TypeTrun,
 		TypeSbgp, TypeSgpd, TypeSaiz, TypeSaio,
-		TypeCslg, TypeSdtp, TypeSidx, TypeEmsg:
+		TypeCslg, TypeSdtp, TypeSidx, TypeEmsg,
+		TypeHmhd, TypeSthd, TypeNmhd, TypeElng,
+		TypeStz2, TypeStsh, TypePadb, TypeStdp,
+		TypeSubs, TypeLeva, TypeUrl, TypeUrn:
 		return true
 	}
 	return false
@@ -126,7 +139,7 @@ func IsContainerBox(t BoxType) bool {
 	case TypeMoov, TypeTrak, TypeEdts, TypeMdia,
 		TypeMinf, TypeDinf, TypeStbl, TypeUdta,
 		TypeMeta, TypeMvex, TypeMoof, TypeTraf,
-		TypeTref, TypeTrgr:
+		TypeTref, TypeTrgr, TypeIlst:
 		return true
 	}
 	return false
@@ -0,0 +1,448 @@
+package mp4
+
+import "errors"
+
+// Box is a decoded box. Each box type declared in this package has a struct
+// that implements Box, such as [Mvhd], [Stts] or [Sidx]; types without one
+// decode to a [RawBox].
+//
+// Decode parses the box data as returned by [Reader.Data]: for full boxes
+// it starts after the version and flags, which are passed separately, and for
+// uuid boxes it is preceded by the 16-byte extended type. Encode
+// writes the complete box, header included. Reserved and pre-defined fields
+// are written with the values the specification requires, so a conforming
+// box round-trips byte for byte.
+//
+// Slices in a decoded box, such as [Mdat.Data], point into the data passed to
+// Decode.
+type Box interface {
+	Type() BoxType
+	Decode(data []byte, version uint8, flags uint32) error
+	Encode(w *Writer)
+}
+
+// FullHeader holds the version and flags of a full box. Box structs embed it
+// when [IsFullBox] reports true for their type. Encode raises the version
+// when a field does not fit the stored one, for example a 64-bit duration.
+type FullHeader struct {
+	Version uint8
+	Flags   uint32
+}
+
+var registry = map[BoxType]func() Box{
+	TypeFtyp: func() Box { return &Ftyp{BoxType: TypeFtyp} },
+	TypeStyp: func() Box { return &Ftyp{BoxType: TypeStyp} },
+
+	TypeMoov: func() Box { return &Container{BoxType: TypeMoov} },
+	TypeMvhd: func() Box { return new(Mvhd) },
+	TypeTrak: func() Box { return &Container{BoxType: TypeTrak} },
+	TypeTkhd: func() Box { return new(Tkhd) },
+	TypeTref: func() Box { return new(Tref) },
+	TypeTrgr: func() Box { return new(Trgr) },
+	TypeEdts: func() Box { return &Container{BoxType: TypeEdts} },
+	TypeElst: func() Box { return new(Elst) },
+	TypeMdia: func() Box { return &Container{BoxType: TypeMdia} },
+	TypeMdhd: func() Box { return new(Mdhd) },
+	TypeHdlr: func() Box { return new(Hdlr) },
+	TypeElng: func() Box { return new(Elng) },
+	TypeMinf: func() Box { return &Container{BoxType: TypeMinf} },
+	TypeVmhd: func() Box { return new(Vmhd) },
+	TypeSmhd: func() Box { return new(Smhd) },
+	TypeHmhd: func() Box { return new(Hmhd) },
+	TypeSthd: func() Box { return &EmptyFullBox{BoxType: TypeSthd} },
+	TypeNmhd: func() Box { return &EmptyFullBox{BoxType: TypeNmhd} },
+	TypeDinf: func() Box { return &Container{BoxType: TypeDinf} },
+	TypeDref: func() Box { return new(Dref) },
+	TypeUrl:  func() Box { return new(Url) },
+	TypeUrn:  func() Box { return new(Urn) },
+
+	TypeStbl: func() Box { return &Container{BoxType: TypeStbl} },
+	TypeStsd: func() Box { return new(Stsd) },
+	TypeStts: func() Box { return new(Stts) },
+	TypeCtts: func() Box { return new(Ctts) },
+	TypeCslg: func() Box { return new(Cslg) },
+	TypeStsc: func() Box { return new(Stsc) },
+	TypeStsz: func() Box { return new(Stsz) },
+	TypeStz2: func() Box { return new(Stz2) },
+	TypeStco: func() Box { return new(Stco) },
+	TypeCo64: func() Box { return new(Co64) },
+	TypeStss: func() Box { return new(Stss) },
+	TypeStsh: func() Box { return new(Stsh) },
+	TypePadb: func() Box { return new(Padb) },
+	TypeStdp: func() Box { return new(Stdp) },
+	TypeSdtp: func() Box { return new(Sdtp) },
+	TypeSbgp: func() Box { return new(Sbgp) },
+	TypeSgpd: func() Box { return new(Sgpd) },
+	TypeSubs: func() Box { return new(Subs) },
+	TypeSaiz: func() Box { return new(Saiz) },
+	TypeSaio: func() Box { return new(Saio) },
+
+	TypeMvex: func() Box { return &Container{BoxType: TypeMvex} },
+	TypeMehd: func() Box { return new(Mehd) },
+	TypeTrex: func() Box { return new(Trex) },
+	TypeLeva: func() Box { return new(Leva) },
+	TypeMoof: func() Box { return &Container{BoxType: TypeMoof} },
+	TypeMfhd: func() Box { return new(Mfhd) },
+	TypeTraf: func() Box { return &Container{BoxType: TypeTraf} },
+	TypeTfhd: func() Box { return new(Tfhd) },
+	TypeTfdt: func() Box { return new(Tfdt) },
+	TypeTrun: func() Box { return new(Trun) },
+	TypeSidx: func() Box { return new(Sidx) },
+	TypeEmsg: func() Box { return new(Emsg) },
+
+	TypeMeta: func() Box { return new(Meta) },
+	TypeUdta: func() Box { return &Container{BoxType: TypeUdta} },
+	TypeIlst: func() Box { return &Container{BoxType: TypeIlst} },
+
+	TypeUuid: func() Box { return new(UUIDBox) },
+	TypeMdat: func() Box { return new(Mdat) },
+	TypeFree: func() Box { return &Free{BoxType: TypeFree} },
+	TypeSkip: func() Box { return &Free{BoxType: TypeSkip} },
+
+	TypeAvc1: func() Box { return &VisualSampleEntry{BoxType: TypeAvc1} },
+	TypeAvcC: func() Box { return new(AvcC) },
+	TypeAv01: func() Box { return &VisualSampleEntry{BoxType: TypeAv01} },
+	TypeAv1C: func() Box { return new(Av1C) },
+	TypeBtrt: func() Box { return new(Btrt) },
+	TypePasp: func() Box { return new(Pasp) },
+	TypeMp4a: func() Box { return &AudioSampleEntry{BoxType: TypeMp4a} },
+	TypeEsds: func() Box { return new(Esds) },
+}
+
+// RegisterBox makes NewBox return newBox() for boxes of type t, replacing the
+// built-in struct for t if there is one. It is meant to be called from init
+// functions and is not safe for concurrent use with decoding.
+func RegisterBox(t BoxType, newBox func() Box) {
+	registry[t] = newBox
+}
+
+// NewBox returns an empty box of type t: the registered struct, or a
+// [RawBox] for unknown types.
+func NewBox(t BoxType) Box {
+	if newBox, ok := registry[t]; ok {
+		return newBox()
+	}
+	return &RawBox{BoxType: t}
+}
+
+// DecodeBoxes decodes the sequence of boxes in buf, descending into
+// containers. Errors are reported as a [*ParseError] whose offset is relative
+// to buf. As with [Reader.Next], fewer than 8 bytes after the last box are
+// ignored.
+func DecodeBoxes(buf []byte) ([]Box, error) {
+	boxes, _, err := decodeChildren(buf)
+	return boxes, err
+}
+
+// ReadBox decodes the current box, descending into it if it is a container.
+// It does not move the reader. A decoding error is recorded as with the other
+// typed accessors and returned.
+func (r *Reader) ReadBox() (Box, error) {
+	b := NewBox(r.boxType)
+	data := r.Data()
+	if r.boxType == TypeUuid {
+		data = r.buf[r.dataStart-uuidSize : r.boxEnd]
+	}
+	err := b.Decode(data, r.version, r.flags)
+	if err == nil {
+		return b, nil
+	}
+	var perr *ParseError
+	if pe, ok := errors.AsType[*ParseError](err); ok {
+		// A box nested inside the current one failed. Its path and offset are
+		// relative to the current box's data.
+		perr = &ParseError{
+			Path:   r.path() + "/" + pe.Path,
+			Offset: r.baseOffset + int64(r.dataStart) + pe.Offset,
+			Type:   pe.Type,
+			Err:    pe.Err,
+		}
+	} else {
+		perr = r.parseError(err)
+	}
+	if r.err == nil {
+		r.err = perr
+	}
+	return nil, perr
+}
+
+// WriteBox writes b, including its header and any children.
+func (w *Writer) WriteBox(b Box) {
+	b.Encode(w)
+}
+
+// decodeChildren decodes the boxes in data. It returns any bytes after the
+// last whole box, such as the zero terminator some writers put at the end of
+// udta, as trailer.
+func decodeChildren(data []byte) (boxes []Box, trailer []byte, err error) {
+	r := NewReader(data)
+	end := 0
+	for r.Next() {
+		b, err := r.ReadBox()
+		if err != nil {
+			return nil, nil, err
+		}
+		boxes = append(boxes, b)
+		end = r.boxEnd
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	return boxes, data[end:], nil
+}
+
+// decodeChildrenAt decodes the boxes in data[off:], reporting error offsets
+// relative to data.
+func decodeChildrenAt(data []byte, off int) ([]Box, []byte, error) {
+	boxes, trailer, err := decodeChildren(data[off:])
+	if pe, ok := errors.AsType[*ParseError](err); ok {
+		pe.Offset += int64(off)
+	}
+	return boxes, trailer, err
+}
+
+// encodeAll writes each box in boxes.
+func encodeAll(w *Writer, boxes []Box) {
+	for _, b := range boxes {
+		b.Encode(w)
+	}
+}
+
+// beginBox reserves room for a box with n bytes of data and begins it, as a
+// full box when t is one. It reports false when the box does not fit, in
+// which case nothing is written.
+func (w *Writer) beginBox(t BoxType, fh FullHeader, n int) bool {
+	if IsFullBox(t) {
+		if !w.reserve(fullBoxHeaderSize + n) {
+			return false
+		}
+		w.StartFullBox(t, fh.Version, fh.Flags)
+		return true
+	}
+	if !w.reserve(boxHeaderSize + n) {
+		return false
+	}
+	w.StartBox(t)
+	return true
+}
+
+// RawBox holds a box whose type has no registered struct. Its data is kept
+// as is.
+type RawBox struct {
+	BoxType BoxType
+	FullHeader
+	Data []byte
+}
+
+func (b *RawBox) Type() BoxType { return b.BoxType }
+
+func (b *RawBox) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	b.Data = data
+	return nil
+}
+
+func (b *RawBox) Encode(w *Writer) {
+	if w.beginBox(b.BoxType, b.FullHeader, len(b.Data)) {
+		w.putBytes(b.Data)
+		w.EndBox()
+	}
+}
+
+// UUIDBox holds a uuid box. Its data is kept as is.
+type UUIDBox struct {
+	ExtendedType [16]byte
+	Data         []byte
+}
+
+func (b *UUIDBox) Type() BoxType { return TypeUuid }
+
+func (b *UUIDBox) Decode(data []byte, _ uint8, _ uint32) error {
+	d := decoder{data: data}
+	copy(b.ExtendedType[:], d.take(uuidSize))
+	b.Data = d.rest()
+	return d.err
+}
+
+func (b *UUIDBox) Encode(w *Writer) {
+	if !w.reserve(boxHeaderSize + uuidSize + len(b.Data)) {
+		return
+	}
+	w.StartUUIDBox(b.ExtendedType)
+	w.putBytes(b.Data)
+	w.EndBox()
+}
+
+// Container holds a box that only contains other boxes, such as moov, trak or
+// stbl.
+type Container struct {
+	BoxType  BoxType
+	Children []Box
+
+	// Trailer holds bytes after the last child that do not form a box.
+	Trailer []byte
+}
+
+func (b *Container) Type() BoxType { return b.BoxType }
+
+func (b *Container) Decode(data []byte, _ uint8, _ uint32) (err error) {
+	b.Children, b.Trailer, err = decodeChildren(data)
+	return err
+}
+
+func (b *Container) Encode(w *Writer) {
+	if !w.beginBox(b.BoxType, FullHeader{}, 0) {
+		return
+	}
+	encodeAll(w, b.Children)
+	w.Write(b.Trailer)
+	w.EndBox()
+}
+
+// Child returns the first child of type t, or nil.
+func (b *Container) Child(t BoxType) Box {
+	return childOf(b.Children, t)
+}
+
+func childOf(boxes []Box, t BoxType) Box {
+	for _, c := range boxes {
+		if c.Type() == t {
+			return c
+		}
+	}
+	return nil
+}
+
+// decoder reads big-endian fields from box data. The first read past the end
+// records [ErrShortBox]; later reads return zero values, so a Decode method
+// can read its whole layout and check err once.
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// take returns the next n bytes, or nil once the data is exhausted.
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data)-d.pos {
+		d.err = ErrShortBox
+		return nil
+	}
+	p := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return p
+}
+
+func (d *decoder) u8() uint8 {
+	if p := d.take(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (d *decoder) u16() uint16 {
+	if p := d.take(2); p != nil {
+		return be.Uint16(p)
+	}
+	return 0
+}
+
+func (d *decoder) u24() uint32 {
+	if p := d.take(3); p != nil {
+		return uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+	}
+	return 0
+}
+
+func (d *decoder) u32() uint32 {
+	if p := d.take(4); p != nil {
+		return be.Uint32(p)
+	}
+	return 0
+}
+
+func (d *decoder) u64() uint64 {
+	if p := d.take(8); p != nil {
+		return be.Uint64(p)
+	}
+	return 0
+}
+
+// uv reads a 64-bit field in version 1 boxes and a 32-bit one otherwise.
+func (d *decoder) uv(version uint8) uint64 {
+	if version == 1 {
+		return d.u64()
+	}
+	return uint64(d.u32())
+}
+
+func (d *decoder) fourCC() (t [4]byte) {
+	if p := d.take(4); p != nil {
+		copy(t[:], p)
+	}
+	return t
+}
+
+// cstring reads a null-terminated string. A string that runs to the end of
+// the data without a terminator is accepted.
+func (d *decoder) cstring() string {
+	if d.err != nil {
+		return ""
+	}
+	rest := d.data[d.pos:]
+	for i, c := range rest {
+		if c == 0 {
+			d.pos += i + 1
+			return string(rest[:i])
+		}
+	}
+	d.pos = len(d.data)
+	return string(rest)
+}
+
+// rest returns the unread data.
+func (d *decoder) rest() []byte {
+	if d.err != nil {
+		return nil
+	}
+	p := d.data[d.pos:]
+	d.pos = len(d.data)
+	return p
+}
+
+// count reads a 32-bit entry count and checks that count entries of size
+// bytes each remain, so a corrupt count cannot force a huge allocation.
+func (d *decoder) count(size int) int {
+	n := d.u32()
+	return d.checkCount(int64(n), size)
+}
+
+// checkCount validates n entries of size bytes against the unread data.
+func (d *decoder) checkCount(n int64, size int) int {
+	if d.err != nil {
+		return 0
+	}
+	if n*int64(size) > int64(len(d.data)-d.pos) {
+		d.err = ErrShortBox
+		return 0
+	}
+	return int(n)
+}
+
+// putUV writes a 64-bit field for version 1 and a 32-bit one otherwise.
+func (w *Writer) putUV(version uint8, v uint64) {
+	if version == 1 {
+		w.putUint64(v)
+	} else {
+		w.putUint32(uint32(v))
+	}
+}
+
+// putUint24 appends a big-endian 24-bit value.
+func (w *Writer) putUint24(v uint32) {
+	w.putUint8(byte(v >> 16))
+	w.putUint16(uint16(v))
+}
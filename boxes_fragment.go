@@ -0,0 +1,454 @@
+package mp4
+
+import "math/bits"
+
+// Mehd is a movie extends header box.
+type Mehd struct {
+	FullHeader
+	FragmentDuration uint64
+}
+
+func (b *Mehd) Type() BoxType { return TypeMehd }
+
+func (b *Mehd) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.FragmentDuration = d.uv(version)
+	return d.err
+}
+
+func (b *Mehd) Encode(w *Writer) {
+	v := max(b.Version, versionFor(b.FragmentDuration))
+	if !w.beginBox(TypeMehd, FullHeader{v, b.Flags}, versionedSize(v, 4, 8)) {
+		return
+	}
+	w.putUV(v, b.FragmentDuration)
+	w.EndBox()
+}
+
+// Trex is a track extends box holding the sample defaults for a track's
+// fragments.
+type Trex struct {
+	FullHeader
+	TrackID                       uint32
+	DefaultSampleDescriptionIndex uint32
+	DefaultSampleDuration         uint32
+	DefaultSampleSize             uint32
+	DefaultSampleFlags            uint32
+}
+
+func (b *Trex) Type() BoxType { return TypeTrex }
+
+func (b *Trex) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.TrackID = d.u32()
+	b.DefaultSampleDescriptionIndex = d.u32()
+	b.DefaultSampleDuration = d.u32()
+	b.DefaultSampleSize = d.u32()
+	b.DefaultSampleFlags = d.u32()
+	return d.err
+}
+
+func (b *Trex) Encode(w *Writer) {
+	if !w.beginBox(TypeTrex, b.FullHeader, 20) {
+		return
+	}
+	w.putUint32(b.TrackID)
+	w.putUint32(b.DefaultSampleDescriptionIndex)
+	w.putUint32(b.DefaultSampleDuration)
+	w.putUint32(b.DefaultSampleSize)
+	w.putUint32(b.DefaultSampleFlags)
+	w.EndBox()
+}
+
+// Level assignment types.
+const (
+	LevaAssignSampleGroup          = 0
+	LevaAssignSampleGroupParameter = 1
+	LevaAssignTrack                = 2
+	LevaAssignTrackFragment        = 3
+	LevaAssignSubTrack             = 4
+)
+
+// LevaLevel assigns one level. Which of the trailing fields are present
+// depends on AssignmentType.
+type LevaLevel struct {
+	TrackID               uint32
+	PaddingFlag           bool
+	AssignmentType        uint8
+	GroupingType          [4]byte // assignment types 0 and 1
+	GroupingTypeParameter uint32  // assignment type 1
+	SubTrackID            uint32  // assignment type 4
+}
+
+func (l *LevaLevel) size() int {
+	switch l.AssignmentType {
+	case LevaAssignSampleGroup, LevaAssignSubTrack:
+		return 9
+	case LevaAssignSampleGroupParameter:
+		return 13
+	}
+	return 5
+}
+
+// Leva is a level assignment box.
+type Leva struct {
+	FullHeader
+	Levels []LevaLevel
+}
+
+func (b *Leva) Type() BoxType { return TypeLeva }
+
+func (b *Leva) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	n := d.checkCount(int64(d.u8()), 5)
+	b.Levels = make([]LevaLevel, n)
+	for i := range b.Levels {
+		l := &b.Levels[i]
+		l.TrackID = d.u32()
+		v := d.u8()
+		l.PaddingFlag = v&0x80 != 0
+		l.AssignmentType = v & 0x7f
+		switch l.AssignmentType {
+		case LevaAssignSampleGroup:
+			l.GroupingType = d.fourCC()
+		case LevaAssignSampleGroupParameter:
+			l.GroupingType = d.fourCC()
+			l.GroupingTypeParameter = d.u32()
+		case LevaAssignSubTrack:
+			l.SubTrackID = d.u32()
+		}
+	}
+	return d.err
+}
+
+func (b *Leva) Encode(w *Writer) {
+	n := 1
+	for i := range b.Levels {
+		n += b.Levels[i].size()
+	}
+	if !w.beginBox(TypeLeva, b.FullHeader, n) {
+		return
+	}
+	w.putUint8(uint8(len(b.Levels)))
+	for _, l := range b.Levels {
+		w.putUint32(l.TrackID)
+		w.putUint8(bit(l.PaddingFlag, 7) | l.AssignmentType&0x7f)
+		switch l.AssignmentType {
+		case LevaAssignSampleGroup:
+			w.putBytes(l.GroupingType[:])
+		case LevaAssignSampleGroupParameter:
+			w.putBytes(l.GroupingType[:])
+			w.putUint32(l.GroupingTypeParameter)
+		case LevaAssignSubTrack:
+			w.putUint32(l.SubTrackID)
+		}
+	}
+	w.EndBox()
+}
+
+// Mfhd is a movie fragment header box.
+type Mfhd struct {
+	FullHeader
+	SequenceNumber uint32
+}
+
+func (b *Mfhd) Type() BoxType { return TypeMfhd }
+
+func (b *Mfhd) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.SequenceNumber = d.u32()
+	return d.err
+}
+
+func (b *Mfhd) Encode(w *Writer) {
+	if !w.beginBox(TypeMfhd, b.FullHeader, 4) {
+		return
+	}
+	w.putUint32(b.SequenceNumber)
+	w.EndBox()
+}
+
+// Tfhd is a track fragment header box. The optional fields are present when
+// the matching Tfhd flag is set.
+type Tfhd struct {
+	FullHeader
+	TrackID                uint32
+	BaseDataOffset         uint64
+	SampleDescriptionIndex uint32
+	DefaultSampleDuration  uint32
+	DefaultSampleSize      uint32
+	DefaultSampleFlags     uint32
+}
+
+func (b *Tfhd) Type() BoxType { return TypeTfhd }
+
+func (b *Tfhd) Decode(data []byte, version uint8, flags uint32) error {
+	t, err := ReadTfhdInfo(data, flags)
+	*b = Tfhd{
+		FullHeader:             FullHeader{version, flags},
+		TrackID:                t.TrackID,
+		BaseDataOffset:         t.BaseDataOffset,
+		SampleDescriptionIndex: t.SampleDescriptionIndex,
+		DefaultSampleDuration:  t.DefaultSampleDuration,
+		DefaultSampleSize:      t.DefaultSampleSize,
+		DefaultSampleFlags:     t.DefaultSampleFlags,
+	}
+	return err
+}
+
+func (b *Tfhd) Encode(w *Writer) {
+	f := b.Flags
+	n := 4 + 4*bits.OnesCount32(f&(TfhdSampleDescriptionIndexPresent|TfhdDefaultSampleDurationPresent|
+		TfhdDefaultSampleSizePresent|TfhdDefaultSampleFlagsPresent))
+	if f&TfhdBaseDataOffsetPresent != 0 {
+		n += 8
+	}
+	if !w.beginBox(TypeTfhd, b.FullHeader, n) {
+		return
+	}
+	w.putUint32(b.TrackID)
+	if f&TfhdBaseDataOffsetPresent != 0 {
+		w.putUint64(b.BaseDataOffset)
+	}
+	if f&TfhdSampleDescriptionIndexPresent != 0 {
+		w.putUint32(b.SampleDescriptionIndex)
+	}
+	if f&TfhdDefaultSampleDurationPresent != 0 {
+		w.putUint32(b.DefaultSampleDuration)
+	}
+	if f&TfhdDefaultSampleSizePresent != 0 {
+		w.putUint32(b.DefaultSampleSize)
+	}
+	if f&TfhdDefaultSampleFlagsPresent != 0 {
+		w.putUint32(b.DefaultSampleFlags)
+	}
+	w.EndBox()
+}
+
+// Tfdt is a track fragment decode time box.
+type Tfdt struct {
+	FullHeader
+	BaseMediaDecodeTime uint64
+}
+
+func (b *Tfdt) Type() BoxType { return TypeTfdt }
+
+func (b *Tfdt) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.BaseMediaDecodeTime = d.uv(version)
+	return d.err
+}
+
+func (b *Tfdt) Encode(w *Writer) {
+	v := max(b.Version, versionFor(b.BaseMediaDecodeTime))
+	if !w.beginBox(TypeTfdt, FullHeader{v, b.Flags}, versionedSize(v, 4, 8)) {
+		return
+	}
+	w.putUV(v, b.BaseMediaDecodeTime)
+	w.EndBox()
+}
+
+// Trun is a track run box. The Trun flags select which per-sample fields
+// are stored; fields that are absent decode as zero.
+type Trun struct {
+	FullHeader
+	DataOffset       int32
+	FirstSampleFlags uint32
+	Entries          []TrunEntry
+}
+
+func (b *Trun) Type() BoxType { return TypeTrun }
+
+func (b *Trun) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	count := d.u32()
+	b.DataOffset, b.FirstSampleFlags = 0, 0
+	if flags&TrunDataOffsetPresent != 0 {
+		b.DataOffset = int32(d.u32())
+	}
+	if flags&TrunFirstSampleFlagsPresent != 0 {
+		b.FirstSampleFlags = d.u32()
+	}
+	b.Entries = make([]TrunEntry, d.checkCount(int64(count), trunStride(flags)))
+	for i := range b.Entries {
+		e := &b.Entries[i]
+		if flags&TrunSampleDurationPresent != 0 {
+			e.Duration = d.u32()
+		}
+		if flags&TrunSampleSizePresent != 0 {
+			e.Size = d.u32()
+		}
+		if flags&TrunSampleFlagsPresent != 0 {
+			e.Flags = d.u32()
+		}
+		if flags&TrunSampleCompositionTimeOffsetPresent != 0 {
+			e.CompositionTimeOffset = int32(d.u32())
+		}
+	}
+	return d.err
+}
+
+// Encode keeps the stored version: version 1 only changes whether
+// composition offsets are read as signed.
+func (b *Trun) Encode(w *Writer) {
+	n := 4 + 4*bits.OnesCount32(b.Flags&(TrunDataOffsetPresent|TrunFirstSampleFlagsPresent)) +
+		trunStride(b.Flags)*len(b.Entries)
+	if !w.beginBox(TypeTrun, b.FullHeader, n) {
+		return
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	if b.Flags&TrunDataOffsetPresent != 0 {
+		w.putInt32(b.DataOffset)
+	}
+	if b.Flags&TrunFirstSampleFlagsPresent != 0 {
+		w.putUint32(b.FirstSampleFlags)
+	}
+	for _, e := range b.Entries {
+		if b.Flags&TrunSampleDurationPresent != 0 {
+			w.putUint32(e.Duration)
+		}
+		if b.Flags&TrunSampleSizePresent != 0 {
+			w.putUint32(e.Size)
+		}
+		if b.Flags&TrunSampleFlagsPresent != 0 {
+			w.putUint32(e.Flags)
+		}
+		if b.Flags&TrunSampleCompositionTimeOffsetPresent != 0 {
+			w.putInt32(e.CompositionTimeOffset)
+		}
+	}
+	w.EndBox()
+}
+
+// trunStride returns the size of one trun sample entry for flags.
+func trunStride(flags uint32) int {
+	return 4 * bits.OnesCount32(flags&(TrunSampleDurationPresent|TrunSampleSizePresent|
+		TrunSampleFlagsPresent|TrunSampleCompositionTimeOffsetPresent))
+}
+
+// Sidx is a segment index box.
+type Sidx struct {
+	FullHeader
+	ReferenceID              uint32
+	Timescale                uint32
+	EarliestPresentationTime uint64
+	FirstOffset              uint64
+	Entries                  []SidxEntry
+}
+
+func (b *Sidx) Type() BoxType { return TypeSidx }
+
+func (b *Sidx) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.ReferenceID = d.u32()
+	b.Timescale = d.u32()
+	b.EarliestPresentationTime = d.uv(version)
+	b.FirstOffset = d.uv(version)
+	d.u16() // reserved
+	b.Entries = make([]SidxEntry, d.checkCount(int64(d.u16()), sidxEntrySize))
+	for i := range b.Entries {
+		if p := d.take(sidxEntrySize); p != nil {
+			b.Entries[i] = readSidxEntry(p)
+		}
+	}
+	return d.err
+}
+
+func (b *Sidx) Encode(w *Writer) {
+	v := max(b.Version, versionFor(b.EarliestPresentationTime), versionFor(b.FirstOffset))
+	if !w.beginBox(TypeSidx, FullHeader{v, b.Flags}, 12+2*versionedSize(v, 4, 8)+sidxEntrySize*len(b.Entries)) {
+		return
+	}
+	w.putUint32(b.ReferenceID)
+	w.putUint32(b.Timescale)
+	w.putUV(v, b.EarliestPresentationTime)
+	w.putUV(v, b.FirstOffset)
+	w.putUint16(0) // reserved
+	w.putUint16(uint16(len(b.Entries)))
+	for _, e := range b.Entries {
+		w.putSidxEntry(e)
+	}
+	w.EndBox()
+}
+
+// Emsg is an event message box. Version 0 stores PresentationTimeDelta
+// relative to the segment; version 1 stores an absolute PresentationTime.
+type Emsg struct {
+	FullHeader
+	SchemeIDURI           string
+	Value                 string
+	Timescale             uint32
+	PresentationTimeDelta uint32 // version 0
+	PresentationTime      uint64 // version 1
+	EventDuration         uint32
+	ID                    uint32
+	MessageData           []byte
+}
+
+func (b *Emsg) Type() BoxType { return TypeEmsg }
+
+// ReadEmsg parses emsg box data with the given version.
+func ReadEmsg(data []byte, version uint8) (Emsg, error) {
+	var b Emsg
+	err := b.Decode(data, version, 0)
+	return b, err
+}
+
+func (b *Emsg) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.PresentationTimeDelta, b.PresentationTime = 0, 0
+	if version == 0 {
+		b.SchemeIDURI = d.cstring()
+		b.Value = d.cstring()
+		b.Timescale = d.u32()
+		b.PresentationTimeDelta = d.u32()
+		b.EventDuration = d.u32()
+		b.ID = d.u32()
+	} else {
+		b.Timescale = d.u32()
+		b.PresentationTime = d.u64()
+		b.EventDuration = d.u32()
+		b.ID = d.u32()
+		b.SchemeIDURI = d.cstring()
+		b.Value = d.cstring()
+	}
+	b.MessageData = d.rest()
+	return d.err
+}
+
+func (b *Emsg) Encode(w *Writer) {
+	n := len(b.SchemeIDURI) + len(b.Value) + 2 + 12 + len(b.MessageData)
+	if b.Version == 0 {
+		n += 4
+	} else {
+		n += 8
+	}
+	if !w.beginBox(TypeEmsg, b.FullHeader, n) {
+		return
+	}
+	if b.Version == 0 {
+		w.putCString(b.SchemeIDURI, false)
+		w.putCString(b.Value, false)
+		w.putUint32(b.Timescale)
+		w.putUint32(b.PresentationTimeDelta)
+		w.putUint32(b.EventDuration)
+		w.putUint32(b.ID)
+	} else {
+		w.putUint32(b.Timescale)
+		w.putUint64(b.PresentationTime)
+		w.putUint32(b.EventDuration)
+		w.putUint32(b.ID)
+		w.putCString(b.SchemeIDURI, false)
+		w.putCString(b.Value, false)
+	}
+	w.putBytes(b.MessageData)
+	w.EndBox()
+}
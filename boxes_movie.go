@@ -0,0 +1,791 @@
+package mp4
+
+import "time"
+
+// Ftyp is a file type box (ftyp) or, with BoxType set to [TypeStyp], a
+// segment type box, which shares its layout.
+type Ftyp struct {
+	BoxType          BoxType
+	MajorBrand       [4]byte
+	MinorVersion     uint32
+	CompatibleBrands [][4]byte
+}
+
+func (b *Ftyp) Type() BoxType { return b.BoxType }
+
+func (b *Ftyp) Decode(data []byte, _ uint8, _ uint32) error {
+	d := decoder{data: data}
+	b.MajorBrand = d.fourCC()
+	b.MinorVersion = d.u32()
+	n := d.checkCount(int64(len(data)-d.pos)/4, 4)
+	b.CompatibleBrands = make([][4]byte, n)
+	for i := range b.CompatibleBrands {
+		b.CompatibleBrands[i] = d.fourCC()
+	}
+	return d.err
+}
+
+func (b *Ftyp) Encode(w *Writer) {
+	if !w.beginBox(b.BoxType, FullHeader{}, 8+4*len(b.CompatibleBrands)) {
+		return
+	}
+	w.putBytes(b.MajorBrand[:])
+	w.putUint32(b.MinorVersion)
+	for _, c := range b.CompatibleBrands {
+		w.putBytes(c[:])
+	}
+	w.EndBox()
+}
+
+// Free is a free space box (free, or skip when BoxType is [TypeSkip]).
+type Free struct {
+	BoxType BoxType
+	Data    []byte
+}
+
+func (b *Free) Type() BoxType { return b.BoxType }
+
+func (b *Free) Decode(data []byte, _ uint8, _ uint32) error {
+	b.Data = data
+	return nil
+}
+
+func (b *Free) Encode(w *Writer) {
+	if w.beginBox(b.BoxType, FullHeader{}, len(b.Data)) {
+		w.putBytes(b.Data)
+		w.EndBox()
+	}
+}
+
+// Mdat is a media data box. Decoding it keeps a reference to the payload; use
+// [Scanner] to locate large mdat boxes without loading them.
+type Mdat struct {
+	Data []byte
+}
+
+func (b *Mdat) Type() BoxType { return TypeMdat }
+
+func (b *Mdat) Decode(data []byte, _ uint8, _ uint32) error {
+	b.Data = data
+	return nil
+}
+
+func (b *Mdat) Encode(w *Writer) {
+	if w.beginBox(TypeMdat, FullHeader{}, len(b.Data)) {
+		w.putBytes(b.Data)
+		w.EndBox()
+	}
+}
+
+// Mvhd is a movie header box.
+//
+// The creation and modification times of mvhd, tkhd and mdhd are stored as
+// seconds since 1904-01-01 UTC. A stored zero decodes to the zero [time.Time]
+// and the zero time encodes as zero.
+type Mvhd struct {
+	FullHeader
+	CreationTime     time.Time
+	ModificationTime time.Time
+	Timescale        uint32
+	Duration         uint64
+	Rate             int32 // 16.16 fixed point, 0x00010000 is normal rate
+	Volume           int16 // 8.8 fixed point, 0x0100 is full volume
+	Matrix           Matrix
+	NextTrackID      uint32
+}
+
+func (b *Mvhd) Type() BoxType { return TypeMvhd }
+
+func (b *Mvhd) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.CreationTime = d.time(version)
+	b.ModificationTime = d.time(version)
+	b.Timescale = d.u32()
+	b.Duration = d.uv(version)
+	b.Rate = int32(d.u32())
+	b.Volume = int16(d.u16())
+	d.take(10) // reserved
+	d.matrix(&b.Matrix)
+	d.take(24) // pre_defined
+	b.NextTrackID = d.u32()
+	return d.err
+}
+
+func (b *Mvhd) Encode(w *Writer) {
+	ctime, mtime := encodeTime(b.CreationTime), encodeTime(b.ModificationTime)
+	v := max(b.Version, versionFor(ctime), versionFor(mtime), versionFor(b.Duration))
+	if !w.beginBox(TypeMvhd, FullHeader{v, b.Flags}, mvhdSize(v)) {
+		return
+	}
+	w.putUV(v, ctime)
+	w.putUV(v, mtime)
+	w.putUint32(b.Timescale)
+	w.putUV(v, b.Duration)
+	w.putInt32(b.Rate)
+	w.putUint16(uint16(b.Volume))
+	w.putZeros(10) // reserved
+	w.putMatrix(&b.Matrix)
+	w.putZeros(24) // pre_defined
+	w.putUint32(b.NextTrackID)
+	w.EndBox()
+}
+
+// Tkhd is a track header box.
+type Tkhd struct {
+	FullHeader
+	CreationTime     time.Time
+	ModificationTime time.Time
+	TrackID          uint32
+	Duration         uint64 // in the movie timescale
+	Layer            int16
+	AlternateGroup   int16
+	Volume           int16 // 8.8 fixed point
+	Matrix           Matrix
+	Width            uint32 // 16.16 fixed point
+	Height           uint32 // 16.16 fixed point
+}
+
+func (b *Tkhd) Type() BoxType { return TypeTkhd }
+
+func (b *Tkhd) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.CreationTime = d.time(version)
+	b.ModificationTime = d.time(version)
+	b.TrackID = d.u32()
+	d.take(4) // reserved
+	b.Duration = d.uv(version)
+	d.take(8) // reserved
+	b.Layer = int16(d.u16())
+	b.AlternateGroup = int16(d.u16())
+	b.Volume = int16(d.u16())
+	d.take(2) // reserved
+	d.matrix(&b.Matrix)
+	b.Width = d.u32()
+	b.Height = d.u32()
+	return d.err
+}
+
+func (b *Tkhd) Encode(w *Writer) {
+	ctime, mtime := encodeTime(b.CreationTime), encodeTime(b.ModificationTime)
+	v := max(b.Version, versionFor(ctime), versionFor(mtime), versionFor(b.Duration))
+	if !w.beginBox(TypeTkhd, FullHeader{v, b.Flags}, tkhdSize(v)) {
+		return
+	}
+	w.putUV(v, ctime)
+	w.putUV(v, mtime)
+	w.putUint32(b.TrackID)
+	w.putUint32(0) // reserved
+	w.putUV(v, b.Duration)
+	w.putZeros(8) // reserved
+	w.putUint16(uint16(b.Layer))
+	w.putUint16(uint16(b.AlternateGroup))
+	w.putUint16(uint16(b.Volume))
+	w.putUint16(0) // reserved
+	w.putMatrix(&b.Matrix)
+	w.putUint32(b.Width)
+	w.putUint32(b.Height)
+	w.EndBox()
+}
+
+// Mdhd is a media header box.
+type Mdhd struct {
+	FullHeader
+	CreationTime     time.Time
+	ModificationTime time.Time
+	Timescale        uint32
+	Duration         uint64
+	Language         uint16 // ISO-639-2/T code packed into three 5-bit fields; see [DecodeLanguage]
+	PreDefined       uint16
+}
+
+func (b *Mdhd) Type() BoxType { return TypeMdhd }
+
+func (b *Mdhd) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.CreationTime = d.time(version)
+	b.ModificationTime = d.time(version)
+	b.Timescale = d.u32()
+	b.Duration = d.uv(version)
+	b.Language = d.u16()
+	b.PreDefined = d.u16()
+	return d.err
+}
+
+func (b *Mdhd) Encode(w *Writer) {
+	ctime, mtime := encodeTime(b.CreationTime), encodeTime(b.ModificationTime)
+	v := max(b.Version, versionFor(ctime), versionFor(mtime), versionFor(b.Duration))
+	if !w.beginBox(TypeMdhd, FullHeader{v, b.Flags}, mdhdSize(v)) {
+		return
+	}
+	w.putUV(v, ctime)
+	w.putUV(v, mtime)
+	w.putUint32(b.Timescale)
+	w.putUV(v, b.Duration)
+	w.putUint16(b.Language)
+	w.putUint16(b.PreDefined)
+	w.EndBox()
+}
+
+// undLanguage is the packed code of "und", for undetermined languages.
+const undLanguage = 0x55c4
+
+// DecodeLanguage unpacks an mdhd language into its ISO-639-2/T code, such as
+// "eng". QuickTime files may instead hold a Macintosh language code below
+// 0x400; 0, English, decodes as "eng" and the others as "und", as do packed
+// values with a letter out of range.
+func DecodeLanguage(packed uint16) string {
+	switch packed {
+	case undLanguage:
+		return "und"
+	case 0x15c7, 0: // "eng", Macintosh English
+		return "eng"
+	}
+	if packed < 0x400 {
+		return "und"
+	}
+	var c [3]byte
+	for i := range c {
+		v := packed >> (10 - 5*i) & 0x1f
+		if v < 1 || v > 26 {
+			return "und"
+		}
+		c[i] = byte(v) + 0x60
+	}
+	return string(c[:])
+}
+
+// EncodeLanguage packs an ISO-639-2/T code for mdhd. A code that is not three
+// lowercase ASCII letters packs as "und".
+func EncodeLanguage(code string) uint16 {
+	if len(code) != 3 {
+		return undLanguage
+	}
+	var packed uint16
+	for i := range 3 {
+		c := code[i]
+		if c < 'a' || c > 'z' {
+			return undLanguage
+		}
+		packed = packed<<5 | uint16(c-0x60)
+	}
+	return packed
+}
+
+// Hdlr is a handler reference box.
+type Hdlr struct {
+	FullHeader
+	PreDefined  uint32 // QuickTime stores the component type ('mhlr', 'dhlr') here
+	HandlerType [4]byte
+	Name        string
+
+	unterminated bool // Name was not null-terminated in the decoded box
+}
+
+func (b *Hdlr) Type() BoxType { return TypeHdlr }
+
+func (b *Hdlr) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.PreDefined = d.u32()
+	b.HandlerType = d.fourCC()
+	d.take(12) // reserved
+	b.Name, b.unterminated = d.cstringTerm()
+	return d.err
+}
+
+func (b *Hdlr) Encode(w *Writer) {
+	if !w.beginBox(TypeHdlr, b.FullHeader, 20+cstringSize(b.Name, b.unterminated)) {
+		return
+	}
+	w.putUint32(b.PreDefined)
+	w.putBytes(b.HandlerType[:])
+	w.putZeros(12) // reserved
+	w.putCString(b.Name, b.unterminated)
+	w.EndBox()
+}
+
+// Elng is an extended language tag box holding a BCP 47 tag such as "en-US".
+type Elng struct {
+	FullHeader
+	ExtendedLanguage string
+}
+
+func (b *Elng) Type() BoxType { return TypeElng }
+
+func (b *Elng) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.ExtendedLanguage = d.cstring()
+	return d.err
+}
+
+func (b *Elng) Encode(w *Writer) {
+	if w.beginBox(TypeElng, b.FullHeader, len(b.ExtendedLanguage)+1) {
+		w.putCString(b.ExtendedLanguage, false)
+		w.EndBox()
+	}
+}
+
+// Vmhd is a video media header box. Its flags are 1 in conforming files.
+type Vmhd struct {
+	FullHeader
+	GraphicsMode uint16
+	OpColor      [3]uint16
+}
+
+func (b *Vmhd) Type() BoxType { return TypeVmhd }
+
+func (b *Vmhd) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.GraphicsMode = d.u16()
+	for i := range b.OpColor {
+		b.OpColor[i] = d.u16()
+	}
+	return d.err
+}
+
+func (b *Vmhd) Encode(w *Writer) {
+	if !w.beginBox(TypeVmhd, b.FullHeader, 8) {
+		return
+	}
+	w.putUint16(b.GraphicsMode)
+	for _, c := range b.OpColor {
+		w.putUint16(c)
+	}
+	w.EndBox()
+}
+
+// Smhd is a sound media header box.
+type Smhd struct {
+	FullHeader
+	Balance int16 // 8.8 fixed point, 0 is centre
+}
+
+func (b *Smhd) Type() BoxType { return TypeSmhd }
+
+func (b *Smhd) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Balance = int16(d.u16())
+	d.take(2) // reserved
+	return d.err
+}
+
+func (b *Smhd) Encode(w *Writer) {
+	if !w.beginBox(TypeSmhd, b.FullHeader, 4) {
+		return
+	}
+	w.putUint16(uint16(b.Balance))
+	w.putUint16(0) // reserved
+	w.EndBox()
+}
+
+// Hmhd is a hint media header box.
+type Hmhd struct {
+	FullHeader
+	MaxPDUSize uint16
+	AvgPDUSize uint16
+	MaxBitrate uint32
+	AvgBitrate uint32
+}
+
+func (b *Hmhd) Type() BoxType { return TypeHmhd }
+
+func (b *Hmhd) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.MaxPDUSize = d.u16()
+	b.AvgPDUSize = d.u16()
+	b.MaxBitrate = d.u32()
+	b.AvgBitrate = d.u32()
+	d.take(4) // reserved
+	return d.err
+}
+
+func (b *Hmhd) Encode(w *Writer) {
+	if !w.beginBox(TypeHmhd, b.FullHeader, 16) {
+		return
+	}
+	w.putUint16(b.MaxPDUSize)
+	w.putUint16(b.AvgPDUSize)
+	w.putUint32(b.MaxBitrate)
+	w.putUint32(b.AvgBitrate)
+	w.putUint32(0) // reserved
+	w.EndBox()
+}
+
+// EmptyFullBox is a full box with no fields beyond its version and flags,
+// such as the subtitle (sthd) and null (nmhd) media headers.
+type EmptyFullBox struct {
+	BoxType BoxType
+	FullHeader
+}
+
+func (b *EmptyFullBox) Type() BoxType { return b.BoxType }
+
+func (b *EmptyFullBox) Decode(_ []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	return nil
+}
+
+func (b *EmptyFullBox) Encode(w *Writer) {
+	if w.beginBox(b.BoxType, b.FullHeader, 0) {
+		w.EndBox()
+	}
+}
+
+// Dref is a data reference box. Its entries are usually [Url] or [Urn] boxes.
+type Dref struct {
+	FullHeader
+	Entries []Box
+}
+
+func (b *Dref) Type() BoxType { return TypeDref }
+
+func (b *Dref) Decode(data []byte, version uint8, flags uint32) (err error) {
+	b.FullHeader = FullHeader{version, flags}
+	b.Entries, err = decodeEntries(data)
+	return err
+}
+
+func (b *Dref) Encode(w *Writer) {
+	if !w.beginBox(TypeDref, b.FullHeader, 4) {
+		return
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	encodeAll(w, b.Entries)
+	w.EndBox()
+}
+
+// UrlSelfContained marks a url or urn data entry whose media data is in
+// the same file.
+const UrlSelfContained = 0x000001
+
+// Url is a URL data entry. With [UrlSelfContained] set the location is
+// empty and the media is in the same file.
+type Url struct {
+	FullHeader
+	Location string
+}
+
+func (b *Url) Type() BoxType { return TypeUrl }
+
+func (b *Url) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	b.Location = ""
+	if len(data) > 0 {
+		d := decoder{data: data}
+		b.Location = d.cstring()
+	}
+	return nil
+}
+
+func (b *Url) Encode(w *Writer) {
+	withLocation := b.Location != "" || b.Flags&UrlSelfContained == 0
+	n := 0
+	if withLocation {
+		n = len(b.Location) + 1
+	}
+	if !w.beginBox(TypeUrl, b.FullHeader, n) {
+		return
+	}
+	if withLocation {
+		w.putCString(b.Location, false)
+	}
+	w.EndBox()
+}
+
+// Urn is a URN data entry.
+type Urn struct {
+	FullHeader
+	Name     string
+	Location string
+}
+
+func (b *Urn) Type() BoxType { return TypeUrn }
+
+func (b *Urn) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Name = d.cstring()
+	b.Location = ""
+	if d.pos < len(data) {
+		b.Location = d.cstring()
+	}
+	return d.err
+}
+
+func (b *Urn) Encode(w *Writer) {
+	n := len(b.Name) + 1
+	if b.Location != "" {
+		n += len(b.Location) + 1
+	}
+	if !w.beginBox(TypeUrn, b.FullHeader, n) {
+		return
+	}
+	w.putCString(b.Name, false)
+	if b.Location != "" {
+		w.putCString(b.Location, false)
+	}
+	w.EndBox()
+}
+
+// Elst is an edit list box.
+type Elst struct {
+	FullHeader
+	Entries []ElstEntry
+}
+
+func (b *Elst) Type() BoxType { return TypeElst }
+
+func (b *Elst) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Entries = make([]ElstEntry, d.count(versionedSize(version, 12, 20)))
+	for i := range b.Entries {
+		e := &b.Entries[i]
+		e.SegmentDuration = d.uv(version)
+		if version == 1 {
+			e.MediaTime = int64(d.u64())
+		} else {
+			e.MediaTime = int64(int32(d.u32()))
+		}
+		e.MediaRateInt = int16(d.u16())
+		e.MediaRateFrac = int16(d.u16())
+	}
+	return d.err
+}
+
+func (b *Elst) Encode(w *Writer) {
+	v := b.Version
+	for _, e := range b.Entries {
+		if e.SegmentDuration > uint32Max || e.MediaTime != int64(int32(e.MediaTime)) {
+			v = 1
+			break
+		}
+	}
+	if !w.beginBox(TypeElst, FullHeader{v, b.Flags}, 4+versionedSize(v, 12, 20)*len(b.Entries)) {
+		return
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	for _, e := range b.Entries {
+		w.putUV(v, e.SegmentDuration)
+		w.putUV(v, uint64(e.MediaTime))
+		w.putUint16(uint16(e.MediaRateInt))
+		w.putUint16(uint16(e.MediaRateFrac))
+	}
+	w.EndBox()
+}
+
+// Tref is a track reference box. Each child names a reference type, such as
+// 'chap' or 'hint', and lists the referenced track IDs.
+type Tref struct {
+	References []TrackReference
+}
+
+// TrackReference is one reference type box inside a [Tref].
+type TrackReference struct {
+	BoxType  BoxType
+	TrackIDs []uint32
+}
+
+func (b *Tref) Type() BoxType { return TypeTref }
+
+func (b *Tref) Decode(data []byte, _ uint8, _ uint32) error {
+	b.References = b.References[:0]
+	r := NewReader(data)
+	for r.Next() {
+		d := decoder{data: r.Data()}
+		ref := TrackReference{BoxType: r.Type()}
+		ref.TrackIDs = make([]uint32, len(d.data)/4)
+		for i := range ref.TrackIDs {
+			ref.TrackIDs[i] = d.u32()
+		}
+		b.References = append(b.References, ref)
+	}
+	return r.Err()
+}
+
+func (b *Tref) Encode(w *Writer) {
+	n := 0
+	for _, ref := range b.References {
+		n += boxHeaderSize + 4*len(ref.TrackIDs)
+	}
+	if !w.beginBox(TypeTref, FullHeader{}, n) {
+		return
+	}
+	for _, ref := range b.References {
+		w.StartBox(ref.BoxType)
+		for _, id := range ref.TrackIDs {
+			w.putUint32(id)
+		}
+		w.EndBox()
+	}
+	w.EndBox()
+}
+
+// Trgr is a track group box. Each child is a full box whose type names the
+// grouping, such as 'msrc', followed by the group ID.
+type Trgr struct {
+	Groups []TrackGroup
+}
+
+// TrackGroup is one track group type box inside a [Trgr].
+type TrackGroup struct {
+	BoxType BoxType
+	FullHeader
+	TrackGroupID uint32
+	Data         []byte // fields defined by the grouping type
+}
+
+func (b *Trgr) Type() BoxType { return TypeTrgr }
+
+func (b *Trgr) Decode(data []byte, _ uint8, _ uint32) error {
+	b.Groups = b.Groups[:0]
+	r := NewReader(data)
+	for r.Next() {
+		// The grouping types are not known to IsFullBox, so the version and
+		// flags are still part of the data.
+		d := decoder{data: r.Data()}
+		vf := d.u32()
+		g := TrackGroup{
+			BoxType:      r.Type(),
+			FullHeader:   FullHeader{uint8(vf >> 24), vf & 0x00ffffff},
+			TrackGroupID: d.u32(),
+			Data:         d.rest(),
+		}
+		if d.err != nil {
+			r.fail(d.err)
+			break
+		}
+		b.Groups = append(b.Groups, g)
+	}
+	return r.Err()
+}
+
+func (b *Trgr) Encode(w *Writer) {
+	n := 0
+	for _, g := range b.Groups {
+		n += fullBoxHeaderSize + 4 + len(g.Data)
+	}
+	if !w.beginBox(TypeTrgr, FullHeader{}, n) {
+		return
+	}
+	for _, g := range b.Groups {
+		w.StartFullBox(g.BoxType, g.Version, g.Flags)
+		w.putUint32(g.TrackGroupID)
+		w.putBytes(g.Data)
+		w.EndBox()
+	}
+	w.EndBox()
+}
+
+// Meta is a metadata box: a full box whose children start with an hdlr.
+type Meta struct {
+	FullHeader
+	Children []Box
+
+	// Trailer holds bytes after the last child that do not form a box.
+	Trailer []byte
+}
+
+func (b *Meta) Type() BoxType { return TypeMeta }
+
+func (b *Meta) Decode(data []byte, version uint8, flags uint32) (err error) {
+	b.FullHeader = FullHeader{version, flags}
+	b.Children, b.Trailer, err = decodeChildren(data)
+	return err
+}
+
+func (b *Meta) Encode(w *Writer) {
+	if !w.beginBox(TypeMeta, b.FullHeader, 0) {
+		return
+	}
+	encodeAll(w, b.Children)
+	w.Write(b.Trailer)
+	w.EndBox()
+}
+
+// Child returns the first child of type t, or nil.
+func (b *Meta) Child(t BoxType) Box {
+	return childOf(b.Children, t)
+}
+
+// epoch1904 is the origin of the creation and modification times in movie,
+// track and media headers.
+var epoch1904 = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// decodeTime converts seconds since 1904 to a time. Zero means the time is
+// not set and maps to the zero [time.Time].
+func decodeTime(secs uint64) time.Time {
+	if secs == 0 {
+		return time.Time{}
+	}
+	return time.Unix(epoch1904.Unix()+int64(secs), 0).UTC()
+}
+
+// encodeTime converts t to seconds since 1904, truncating fractions of a
+// second. The zero time and times before 1904 encode as 0.
+func encodeTime(t time.Time) uint64 {
+	if t.IsZero() || t.Before(epoch1904) {
+		return 0
+	}
+	return uint64(t.Unix() - epoch1904.Unix())
+}
+
+func (d *decoder) time(version uint8) time.Time {
+	return decodeTime(d.uv(version))
+}
+
+// matrix reads a 3x3 transformation matrix.
+func (d *decoder) matrix(m *Matrix) {
+	for i := range m {
+		m[i] = int32(d.u32())
+	}
+}
+
+// putMatrix writes a 3x3 transformation matrix.
+func (w *Writer) putMatrix(m *Matrix) {
+	for _, v := range m {
+		w.putInt32(v)
+	}
+}
+
+// cstringTerm reads a null-terminated string and reports whether the
+// terminator was missing.
+func (d *decoder) cstringTerm() (s string, unterminated bool) {
+	start := d.pos
+	s = d.cstring()
+	return s, d.err == nil && d.pos-start == len(s)
+}
+
+// cstringSize returns the encoded size of s with its terminator, if any.
+func cstringSize(s string, unterminated bool) int {
+	if unterminated {
+		return len(s)
+	}
+	return len(s) + 1
+}
+
+// putCString writes s followed by a null terminator unless unterminated.
+func (w *Writer) putCString(s string, unterminated bool) {
+	w.putString(s)
+	if !unterminated {
+		w.putUint8(0)
+	}
+}
+
+// decodeEntries decodes the entry count and child boxes of an entry table
+// such as dref or stsd.
+func decodeEntries(data []byte) ([]Box, error) {
+	if len(data) < 4 {
+		return nil, ErrShortBox
+	}
+	// The entry count is implied by the boxes that follow.
+	boxes, _, err := decodeChildrenAt(data, 4)
+	return boxes, err
+}
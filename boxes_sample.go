@@ -0,0 +1,308 @@
+package mp4
+
+// Stsd is a sample description box. Its entries are sample entries such as
+// [VisualSampleEntry] (avc1, av01) and [AudioSampleEntry] (mp4a); other
+// formats decode to a [RawBox].
+type Stsd struct {
+	FullHeader
+	Entries []Box
+}
+
+func (b *Stsd) Type() BoxType { return TypeStsd }
+
+func (b *Stsd) Decode(data []byte, version uint8, flags uint32) (err error) {
+	b.FullHeader = FullHeader{version, flags}
+	b.Entries, err = decodeEntries(data)
+	return err
+}
+
+func (b *Stsd) Encode(w *Writer) {
+	if !w.beginBox(TypeStsd, b.FullHeader, 4) {
+		return
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	encodeAll(w, b.Entries)
+	w.EndBox()
+}
+
+func (e *VisualSampleEntry) Type() BoxType { return e.BoxType }
+
+func (e *VisualSampleEntry) Decode(data []byte, _ uint8, _ uint32) (err error) {
+	t := e.BoxType
+	if *e, err = ReadVisualSampleEntry(data); err != nil {
+		return err
+	}
+	e.BoxType = t
+	e.Children, e.Trailer, err = decodeChildrenAt(data, e.ChildOffset)
+	return err
+}
+
+func (e *VisualSampleEntry) Encode(w *Writer) {
+	if !w.beginBox(e.BoxType, FullHeader{}, visualSampleEntrySize) {
+		return
+	}
+	w.putZeros(6) // reserved
+	w.putUint16(e.DataReferenceIndex)
+	w.putZeros(16) // pre_defined + reserved
+	w.putUint16(e.Width)
+	w.putUint16(e.Height)
+	w.putUint32(e.HResolution)
+	w.putUint32(e.VResolution)
+	w.putZeros(4) // reserved
+	w.putUint16(e.FrameCount)
+	w.putUint8(byte(min(len(e.CompressorName), 31)))
+	w.putFixedString(e.CompressorName, 31)
+	w.putUint16(e.Depth)
+	w.putUint16(0xffff) // pre_defined = -1
+	encodeAll(w, e.Children)
+	w.Write(e.Trailer)
+	w.EndBox()
+}
+
+// Child returns the first child of type t, or nil.
+func (e *VisualSampleEntry) Child(t BoxType) Box {
+	return childOf(e.Children, t)
+}
+
+func (e *AudioSampleEntry) Type() BoxType { return e.BoxType }
+
+func (e *AudioSampleEntry) Decode(data []byte, _ uint8, _ uint32) (err error) {
+	t := e.BoxType
+	if *e, err = ReadAudioSampleEntry(data); err != nil {
+		return err
+	}
+	e.BoxType = t
+	e.Children, e.Trailer, err = decodeChildrenAt(data, e.ChildOffset)
+	return err
+}
+
+func (e *AudioSampleEntry) Encode(w *Writer) {
+	if !w.beginBox(e.BoxType, FullHeader{}, audioSampleEntrySize) {
+		return
+	}
+	w.putZeros(6) // reserved
+	w.putUint16(e.DataReferenceIndex)
+	w.putZeros(8) // reserved
+	w.putUint16(e.ChannelCount)
+	w.putUint16(e.SampleSize)
+	w.putZeros(4) // pre_defined + reserved
+	w.putUint32(e.SampleRate)
+	encodeAll(w, e.Children)
+	w.Write(e.Trailer)
+	w.EndBox()
+}
+
+// Child returns the first child of type t, or nil.
+func (e *AudioSampleEntry) Child(t BoxType) Box {
+	return childOf(e.Children, t)
+}
+
+// AvcC is an AVC decoder configuration record box.
+type AvcC struct {
+	ConfigurationVersion uint8
+	Profile              uint8
+	ProfileCompatibility uint8
+	Level                uint8
+	LengthSizeMinusOne   uint8 // NAL unit length field size minus one
+	SPS                  [][]byte
+	PPS                  [][]byte
+
+	// Ext holds the fields after the parameter sets that high profiles add,
+	// such as chroma format and bit depth, undecoded.
+	Ext []byte
+}
+
+func (b *AvcC) Type() BoxType { return TypeAvcC }
+
+func (b *AvcC) Decode(data []byte, _ uint8, _ uint32) error {
+	d := decoder{data: data}
+	b.ConfigurationVersion = d.u8()
+	b.Profile = d.u8()
+	b.ProfileCompatibility = d.u8()
+	b.Level = d.u8()
+	b.LengthSizeMinusOne = d.u8() & 0x03
+	b.SPS = d.paramSets(int(d.u8() & 0x1f))
+	b.PPS = d.paramSets(int(d.u8()))
+	b.Ext = d.rest()
+	return d.err
+}
+
+func (b *AvcC) Encode(w *Writer) {
+	n := 7 + len(b.Ext)
+	for _, ps := range b.SPS {
+		n += 2 + len(ps)
+	}
+	for _, ps := range b.PPS {
+		n += 2 + len(ps)
+	}
+	if !w.beginBox(TypeAvcC, FullHeader{}, n) {
+		return
+	}
+	w.putUint8(b.ConfigurationVersion)
+	w.putUint8(b.Profile)
+	w.putUint8(b.ProfileCompatibility)
+	w.putUint8(b.Level)
+	w.putUint8(0xfc | b.LengthSizeMinusOne&0x03)
+	w.putUint8(0xe0 | byte(len(b.SPS))&0x1f)
+	for _, ps := range b.SPS {
+		w.putUint16(uint16(len(ps)))
+		w.putBytes(ps)
+	}
+	w.putUint8(byte(len(b.PPS)))
+	for _, ps := range b.PPS {
+		w.putUint16(uint16(len(ps)))
+		w.putBytes(ps)
+	}
+	w.putBytes(b.Ext)
+	w.EndBox()
+}
+
+// paramSets reads n length-prefixed parameter sets.
+func (d *decoder) paramSets(n int) [][]byte {
+	sets := make([][]byte, 0, d.checkCount(int64(n), 2))
+	for range n {
+		ps := d.take(int(d.u16()))
+		if d.err != nil {
+			return nil
+		}
+		sets = append(sets, ps)
+	}
+	return sets
+}
+
+// Av1C is an AV1 codec configuration box.
+type Av1C struct {
+	Version              uint8 // 1 in conforming files
+	SeqProfile           uint8
+	SeqLevelIdx0         uint8
+	SeqTier0             uint8
+	HighBitdepth         bool
+	TwelveBit            bool
+	Monochrome           bool
+	ChromaSubsamplingX   bool
+	ChromaSubsamplingY   bool
+	ChromaSamplePosition uint8
+
+	InitialPresentationDelayPresent  bool
+	InitialPresentationDelayMinusOne uint8
+
+	ConfigOBUs []byte
+}
+
+func (b *Av1C) Type() BoxType { return TypeAv1C }
+
+func (b *Av1C) Decode(data []byte, _ uint8, _ uint32) error {
+	d := decoder{data: data}
+	b.Version = d.u8() & 0x7f
+	v := d.u8()
+	b.SeqProfile = v >> 5
+	b.SeqLevelIdx0 = v & 0x1f
+	v = d.u8()
+	b.SeqTier0 = v >> 7
+	b.HighBitdepth = v&0x40 != 0
+	b.TwelveBit = v&0x20 != 0
+	b.Monochrome = v&0x10 != 0
+	b.ChromaSubsamplingX = v&0x08 != 0
+	b.ChromaSubsamplingY = v&0x04 != 0
+	b.ChromaSamplePosition = v & 0x03
+	v = d.u8()
+	b.InitialPresentationDelayPresent = v&0x10 != 0
+	b.InitialPresentationDelayMinusOne = v & 0x0f
+	b.ConfigOBUs = d.rest()
+	return d.err
+}
+
+func (b *Av1C) Encode(w *Writer) {
+	if !w.beginBox(TypeAv1C, FullHeader{}, 4+len(b.ConfigOBUs)) {
+		return
+	}
+	w.putUint8(0x80 | b.Version&0x7f) // marker bit
+	w.putUint8(b.SeqProfile<<5 | b.SeqLevelIdx0&0x1f)
+	w.putUint8(b.SeqTier0<<7 | bit(b.HighBitdepth, 6) | bit(b.TwelveBit, 5) | bit(b.Monochrome, 4) |
+		bit(b.ChromaSubsamplingX, 3) | bit(b.ChromaSubsamplingY, 2) | b.ChromaSamplePosition&0x03)
+	w.putUint8(bit(b.InitialPresentationDelayPresent, 4) | b.InitialPresentationDelayMinusOne&0x0f)
+	w.putBytes(b.ConfigOBUs)
+	w.EndBox()
+}
+
+// bit returns 1<<n if set and 0 otherwise.
+func bit(set bool, n uint) uint8 {
+	if set {
+		return 1 << n
+	}
+	return 0
+}
+
+// Btrt is an MPEG-4 bit rate box.
+type Btrt struct {
+	BufferSizeDB uint32
+	MaxBitrate   uint32
+	AvgBitrate   uint32
+}
+
+func (b *Btrt) Type() BoxType { return TypeBtrt }
+
+func (b *Btrt) Decode(data []byte, _ uint8, _ uint32) error {
+	d := decoder{data: data}
+	b.BufferSizeDB = d.u32()
+	b.MaxBitrate = d.u32()
+	b.AvgBitrate = d.u32()
+	return d.err
+}
+
+func (b *Btrt) Encode(w *Writer) {
+	if !w.beginBox(TypeBtrt, FullHeader{}, 12) {
+		return
+	}
+	w.putUint32(b.BufferSizeDB)
+	w.putUint32(b.MaxBitrate)
+	w.putUint32(b.AvgBitrate)
+	w.EndBox()
+}
+
+// Pasp is a pixel aspect ratio box.
+type Pasp struct {
+	HSpacing uint32
+	VSpacing uint32
+}
+
+func (b *Pasp) Type() BoxType { return TypePasp }
+
+func (b *Pasp) Decode(data []byte, _ uint8, _ uint32) error {
+	d := decoder{data: data}
+	b.HSpacing = d.u32()
+	b.VSpacing = d.u32()
+	return d.err
+}
+
+func (b *Pasp) Encode(w *Writer) {
+	if !w.beginBox(TypePasp, FullHeader{}, 8) {
+		return
+	}
+	w.putUint32(b.HSpacing)
+	w.putUint32(b.VSpacing)
+	w.EndBox()
+}
+
+// Esds is an elementary stream descriptor box. Descriptor holds the MPEG-4
+// ES_Descriptor; decode it with [ReadESDescriptor] and write a typed one with
+// [Writer.WriteEsds].
+type Esds struct {
+	FullHeader
+	Descriptor []byte
+}
+
+func (b *Esds) Type() BoxType { return TypeEsds }
+
+func (b *Esds) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	b.Descriptor = data
+	return nil
+}
+
+func (b *Esds) Encode(w *Writer) {
+	if w.beginBox(TypeEsds, b.FullHeader, len(b.Descriptor)) {
+		w.putBytes(b.Descriptor)
+		w.EndBox()
+	}
+}
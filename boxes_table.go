@@ -0,0 +1,795 @@
+package mp4
+
+import "fmt"
+
+// Stts is a decoding time-to-sample box.
+type Stts struct {
+	FullHeader
+	Entries []SttsEntry
+}
+
+func (b *Stts) Type() BoxType { return TypeStts }
+
+func (b *Stts) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Entries = make([]SttsEntry, d.count(8))
+	for i := range b.Entries {
+		b.Entries[i] = SttsEntry{Count: d.u32(), Duration: d.u32()}
+	}
+	return d.err
+}
+
+func (b *Stts) Encode(w *Writer) {
+	if !w.beginBox(TypeStts, b.FullHeader, 4+8*len(b.Entries)) {
+		return
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	for _, e := range b.Entries {
+		w.putUint32(e.Count)
+		w.putUint32(e.Duration)
+	}
+	w.EndBox()
+}
+
+// Ctts is a composition time-to-sample box. Version 1 offsets are signed;
+// version 0 offsets are unsigned but stored in the same int32 field.
+type Ctts struct {
+	FullHeader
+	Entries []CttsEntry
+}
+
+func (b *Ctts) Type() BoxType { return TypeCtts }
+
+func (b *Ctts) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Entries = make([]CttsEntry, d.count(8))
+	for i := range b.Entries {
+		b.Entries[i] = CttsEntry{Count: d.u32(), Offset: int32(d.u32())}
+	}
+	return d.err
+}
+
+func (b *Ctts) Encode(w *Writer) {
+	if !w.beginBox(TypeCtts, b.FullHeader, 4+8*len(b.Entries)) {
+		return
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	for _, e := range b.Entries {
+		w.putUint32(e.Count)
+		w.putInt32(e.Offset)
+	}
+	w.EndBox()
+}
+
+// Cslg is a composition to decode timeline mapping box.
+type Cslg struct {
+	FullHeader
+	CompositionToDTSShift        int64
+	LeastDecodeToDisplayDelta    int64
+	GreatestDecodeToDisplayDelta int64
+	CompositionStartTime         int64
+	CompositionEndTime           int64
+}
+
+func (b *Cslg) Type() BoxType { return TypeCslg }
+
+func (b *Cslg) fields() [5]*int64 {
+	return [5]*int64{
+		&b.CompositionToDTSShift,
+		&b.LeastDecodeToDisplayDelta,
+		&b.GreatestDecodeToDisplayDelta,
+		&b.CompositionStartTime,
+		&b.CompositionEndTime,
+	}
+}
+
+func (b *Cslg) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	for _, f := range b.fields() {
+		if version == 1 {
+			*f = int64(d.u64())
+		} else {
+			*f = int64(int32(d.u32()))
+		}
+	}
+	return d.err
+}
+
+func (b *Cslg) Encode(w *Writer) {
+	v := b.Version
+	for _, f := range b.fields() {
+		if *f != int64(int32(*f)) {
+			v = 1
+		}
+	}
+	if !w.beginBox(TypeCslg, FullHeader{v, b.Flags}, 5*versionedSize(v, 4, 8)) {
+		return
+	}
+	for _, f := range b.fields() {
+		w.putUV(v, uint64(*f))
+	}
+	w.EndBox()
+}
+
+// Stsc is a sample-to-chunk box.
+type Stsc struct {
+	FullHeader
+	Entries []StscEntry
+}
+
+func (b *Stsc) Type() BoxType { return TypeStsc }
+
+func (b *Stsc) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Entries = make([]StscEntry, d.count(12))
+	for i := range b.Entries {
+		b.Entries[i] = StscEntry{
+			FirstChunk:          d.u32(),
+			SamplesPerChunk:     d.u32(),
+			SampleDescriptionId: d.u32(),
+		}
+	}
+	return d.err
+}
+
+func (b *Stsc) Encode(w *Writer) {
+	if !w.beginBox(TypeStsc, b.FullHeader, 4+12*len(b.Entries)) {
+		return
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	for _, e := range b.Entries {
+		w.putUint32(e.FirstChunk)
+		w.putUint32(e.SamplesPerChunk)
+		w.putUint32(e.SampleDescriptionId)
+	}
+	w.EndBox()
+}
+
+// Stsz is a sample size box. When SampleSize is non-zero every sample has
+// that size, SampleCount gives the number of samples and Entries is empty.
+type Stsz struct {
+	FullHeader
+	SampleSize  uint32
+	SampleCount uint32
+	Entries     []uint32
+}
+
+func (b *Stsz) Type() BoxType { return TypeStsz }
+
+func (b *Stsz) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.SampleSize = d.u32()
+	b.SampleCount = d.u32()
+	b.Entries = nil
+	if b.SampleSize == 0 {
+		b.Entries = d.uint32s(d.checkCount(int64(b.SampleCount), 4))
+	}
+	return d.err
+}
+
+func (b *Stsz) Encode(w *Writer) {
+	count, n := b.SampleCount, 0
+	if b.SampleSize == 0 {
+		count, n = uint32(len(b.Entries)), len(b.Entries)
+	}
+	if !w.beginBox(TypeStsz, b.FullHeader, 8+4*n) {
+		return
+	}
+	w.putUint32(b.SampleSize)
+	w.putUint32(count)
+	for _, e := range b.Entries[:n] {
+		w.putUint32(e)
+	}
+	w.EndBox()
+}
+
+// Stz2 is a compact sample size box. FieldSize is 4, 8 or 16 bits.
+type Stz2 struct {
+	FullHeader
+	FieldSize uint8
+	Entries   []uint16
+}
+
+func (b *Stz2) Type() BoxType { return TypeStz2 }
+
+func (b *Stz2) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	d.u24() // reserved
+	b.FieldSize = d.u8()
+	count := int64(d.u32())
+	switch b.FieldSize {
+	case 4:
+		d.checkCount((count+1)/2, 1)
+	case 8, 16:
+		d.checkCount(count, int(b.FieldSize/8))
+	default:
+		return fmt.Errorf("mp4: stz2 field size %d, want 4, 8 or 16", b.FieldSize)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	b.Entries = make([]uint16, count)
+	for i := range b.Entries {
+		switch b.FieldSize {
+		case 4:
+			v := d.data[d.pos+i/2]
+			if i%2 == 0 {
+				b.Entries[i] = uint16(v >> 4)
+			} else {
+				b.Entries[i] = uint16(v & 0x0f)
+			}
+		case 8:
+			b.Entries[i] = uint16(d.u8())
+		case 16:
+			b.Entries[i] = d.u16()
+		}
+	}
+	return nil
+}
+
+func (b *Stz2) Encode(w *Writer) {
+	n := len(b.Entries) * int(b.FieldSize) / 8
+	if b.FieldSize == 4 {
+		n = (len(b.Entries) + 1) / 2
+	}
+	if !w.beginBox(TypeStz2, b.FullHeader, 8+n) {
+		return
+	}
+	w.putUint24(0) // reserved
+	w.putUint8(b.FieldSize)
+	w.putUint32(uint32(len(b.Entries)))
+	switch b.FieldSize {
+	case 4:
+		for i := 0; i < len(b.Entries); i += 2 {
+			v := byte(b.Entries[i]&0x0f) << 4
+			if i+1 < len(b.Entries) {
+				v |= byte(b.Entries[i+1] & 0x0f)
+			}
+			w.putUint8(v)
+		}
+	case 8:
+		for _, e := range b.Entries {
+			w.putUint8(byte(e))
+		}
+	case 16:
+		for _, e := range b.Entries {
+			w.putUint16(e)
+		}
+	}
+	w.EndBox()
+}
+
+// Stco is a 32-bit chunk offset box.
+type Stco struct {
+	FullHeader
+	Entries []uint32
+}
+
+func (b *Stco) Type() BoxType { return TypeStco }
+
+func (b *Stco) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Entries = d.uint32s(d.count(4))
+	return d.err
+}
+
+func (b *Stco) Encode(w *Writer) {
+	w.writeUint32Table(TypeStco, b.FullHeader, b.Entries)
+}
+
+// Co64 is a 64-bit chunk offset box.
+type Co64 struct {
+	FullHeader
+	Entries []uint64
+}
+
+func (b *Co64) Type() BoxType { return TypeCo64 }
+
+func (b *Co64) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Entries = make([]uint64, d.count(8))
+	for i := range b.Entries {
+		b.Entries[i] = d.u64()
+	}
+	return d.err
+}
+
+func (b *Co64) Encode(w *Writer) {
+	if !w.beginBox(TypeCo64, b.FullHeader, 4+8*len(b.Entries)) {
+		return
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	for _, e := range b.Entries {
+		w.putUint64(e)
+	}
+	w.EndBox()
+}
+
+// Stss is a sync sample box listing 1-based sample numbers of sync samples.
+type Stss struct {
+	FullHeader
+	Entries []uint32
+}
+
+func (b *Stss) Type() BoxType { return TypeStss }
+
+func (b *Stss) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Entries = d.uint32s(d.count(4))
+	return d.err
+}
+
+func (b *Stss) Encode(w *Writer) {
+	w.writeUint32Table(TypeStss, b.FullHeader, b.Entries)
+}
+
+// StshEntry maps a shadowed sample to the sync sample that can replace it.
+type StshEntry struct {
+	ShadowedSampleNumber uint32
+	SyncSampleNumber     uint32
+}
+
+// Stsh is a shadow sync sample box.
+type Stsh struct {
+	FullHeader
+	Entries []StshEntry
+}
+
+func (b *Stsh) Type() BoxType { return TypeStsh }
+
+func (b *Stsh) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Entries = make([]StshEntry, d.count(8))
+	for i := range b.Entries {
+		b.Entries[i] = StshEntry{ShadowedSampleNumber: d.u32(), SyncSampleNumber: d.u32()}
+	}
+	return d.err
+}
+
+func (b *Stsh) Encode(w *Writer) {
+	if !w.beginBox(TypeStsh, b.FullHeader, 4+8*len(b.Entries)) {
+		return
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	for _, e := range b.Entries {
+		w.putUint32(e.ShadowedSampleNumber)
+		w.putUint32(e.SyncSampleNumber)
+	}
+	w.EndBox()
+}
+
+// Padb is a padding bits box. Pads holds the number of padding bits, 0 to 7,
+// at the end of each sample.
+type Padb struct {
+	FullHeader
+	Pads []uint8
+}
+
+func (b *Padb) Type() BoxType { return TypePadb }
+
+func (b *Padb) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	count := int64(d.u32())
+	d.checkCount((count+1)/2, 1)
+	if d.err != nil {
+		return d.err
+	}
+	b.Pads = make([]uint8, count)
+	for i := range b.Pads {
+		v := d.data[d.pos+i/2]
+		if i%2 == 0 {
+			b.Pads[i] = v >> 4 & 0x07
+		} else {
+			b.Pads[i] = v & 0x07
+		}
+	}
+	return nil
+}
+
+func (b *Padb) Encode(w *Writer) {
+	if !w.beginBox(TypePadb, b.FullHeader, 4+(len(b.Pads)+1)/2) {
+		return
+	}
+	w.putUint32(uint32(len(b.Pads)))
+	for i := 0; i < len(b.Pads); i += 2 {
+		v := (b.Pads[i] & 0x07) << 4
+		if i+1 < len(b.Pads) {
+			v |= b.Pads[i+1] & 0x07
+		}
+		w.putUint8(v)
+	}
+	w.EndBox()
+}
+
+// Stdp is a sample degradation priority box with one priority per sample.
+type Stdp struct {
+	FullHeader
+	Priorities []uint16
+}
+
+func (b *Stdp) Type() BoxType { return TypeStdp }
+
+func (b *Stdp) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.Priorities = make([]uint16, len(data)/2)
+	for i := range b.Priorities {
+		b.Priorities[i] = d.u16()
+	}
+	return d.err
+}
+
+func (b *Stdp) Encode(w *Writer) {
+	if !w.beginBox(TypeStdp, b.FullHeader, 2*len(b.Priorities)) {
+		return
+	}
+	for _, p := range b.Priorities {
+		w.putUint16(p)
+	}
+	w.EndBox()
+}
+
+// Sdtp is an independent and disposable samples box. Each entry packs
+// is_leading, sample_depends_on, sample_is_depended_on and
+// sample_has_redundancy into two bits each, most significant first.
+type Sdtp struct {
+	FullHeader
+	Entries []uint8
+}
+
+func (b *Sdtp) Type() BoxType { return TypeSdtp }
+
+func (b *Sdtp) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	b.Entries = data
+	return nil
+}
+
+func (b *Sdtp) Encode(w *Writer) {
+	if w.beginBox(TypeSdtp, b.FullHeader, len(b.Entries)) {
+		w.putBytes(b.Entries)
+		w.EndBox()
+	}
+}
+
+// Sbgp is a sample-to-group box.
+type Sbgp struct {
+	FullHeader
+	GroupingType          [4]byte
+	GroupingTypeParameter uint32 // version 1 only
+	Entries               []SbgpEntry
+}
+
+func (b *Sbgp) Type() BoxType { return TypeSbgp }
+
+func (b *Sbgp) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.GroupingType = d.fourCC()
+	b.GroupingTypeParameter = 0
+	if version == 1 {
+		b.GroupingTypeParameter = d.u32()
+	}
+	b.Entries = make([]SbgpEntry, d.count(8))
+	for i := range b.Entries {
+		b.Entries[i] = SbgpEntry{SampleCount: d.u32(), GroupDescriptionIndex: d.u32()}
+	}
+	return d.err
+}
+
+func (b *Sbgp) Encode(w *Writer) {
+	n := 8 + 8*len(b.Entries)
+	if b.Version == 1 {
+		n += 4
+	}
+	if !w.beginBox(TypeSbgp, b.FullHeader, n) {
+		return
+	}
+	w.putBytes(b.GroupingType[:])
+	if b.Version == 1 {
+		w.putUint32(b.GroupingTypeParameter)
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	for _, e := range b.Entries {
+		w.putUint32(e.SampleCount)
+		w.putUint32(e.GroupDescriptionIndex)
+	}
+	w.EndBox()
+}
+
+// Sgpd is a sample group description box. Each entry holds the undecoded
+// description for the grouping type.
+//
+// Only version 1 records entry lengths. For other versions the entries are
+// assumed to share one length, as they do for the common grouping types.
+type Sgpd struct {
+	FullHeader
+	GroupingType                  [4]byte
+	DefaultLength                 uint32 // version 1; 0 means entries have their own lengths
+	DefaultSampleDescriptionIndex uint32 // version 2 and later
+	Entries                       [][]byte
+}
+
+func (b *Sgpd) Type() BoxType { return TypeSgpd }
+
+func (b *Sgpd) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.GroupingType = d.fourCC()
+	b.DefaultLength, b.DefaultSampleDescriptionIndex = 0, 0
+	if version == 1 {
+		b.DefaultLength = d.u32()
+	}
+	if version >= 2 {
+		b.DefaultSampleDescriptionIndex = d.u32()
+	}
+	count := d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	rest := len(data) - d.pos
+	size := sgpdEntrySize(version, b.DefaultLength, count, rest)
+	if size < 0 {
+		return fmt.Errorf("mp4: sgpd version %d: %d bytes do not divide into %d entries", version, rest, count)
+	}
+	b.Entries = make([][]byte, 0, d.checkCount(int64(count), max(size, 4)))
+	for range count {
+		n := size
+		if version == 1 && size == 0 {
+			n = int(d.u32())
+		}
+		e := d.take(n)
+		if d.err != nil {
+			return d.err
+		}
+		b.Entries = append(b.Entries, e)
+	}
+	return nil
+}
+
+// lengthPrefixed reports whether each entry carries its own length.
+func (b *Sgpd) lengthPrefixed() bool {
+	return b.Version == 1 && b.DefaultLength == 0
+}
+
+func (b *Sgpd) Encode(w *Writer) {
+	n := 8
+	if b.Version >= 1 {
+		n += 4
+	}
+	for _, e := range b.Entries {
+		n += len(e)
+		if b.lengthPrefixed() {
+			n += 4
+		}
+	}
+	if !w.beginBox(TypeSgpd, b.FullHeader, n) {
+		return
+	}
+	w.putBytes(b.GroupingType[:])
+	if b.Version == 1 {
+		w.putUint32(b.DefaultLength)
+	}
+	if b.Version >= 2 {
+		w.putUint32(b.DefaultSampleDescriptionIndex)
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	for _, e := range b.Entries {
+		if b.lengthPrefixed() {
+			w.putUint32(uint32(len(e)))
+		}
+		w.putBytes(e)
+	}
+	w.EndBox()
+}
+
+// Subs is a sub-sample information box.
+type Subs struct {
+	FullHeader
+	Entries []SubsEntry
+}
+
+func (b *Subs) Type() BoxType { return TypeSubs }
+
+func (b *Subs) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	sizeField := versionedSize(version, 2, 4)
+	b.Entries = make([]SubsEntry, d.count(6))
+	for i := range b.Entries {
+		e := &b.Entries[i]
+		e.SampleDelta = d.u32()
+		e.Subsamples = make([]Subsample, d.checkCount(int64(d.u16()), sizeField+6))
+		for j := range e.Subsamples {
+			s := &e.Subsamples[j]
+			if version == 1 {
+				s.Size = d.u32()
+			} else {
+				s.Size = uint32(d.u16())
+			}
+			s.Priority = d.u8()
+			s.Discardable = d.u8()
+			s.CodecSpecificParameters = d.u32()
+		}
+	}
+	return d.err
+}
+
+func (b *Subs) Encode(w *Writer) {
+	v := b.Version
+	n := 4
+	for _, e := range b.Entries {
+		n += 6
+		for _, s := range e.Subsamples {
+			if s.Size > 0xffff {
+				v = 1
+			}
+		}
+	}
+	for _, e := range b.Entries {
+		n += len(e.Subsamples) * (versionedSize(v, 2, 4) + 6)
+	}
+	if !w.beginBox(TypeSubs, FullHeader{v, b.Flags}, n) {
+		return
+	}
+	w.putUint32(uint32(len(b.Entries)))
+	for _, e := range b.Entries {
+		w.putUint32(e.SampleDelta)
+		w.putUint16(uint16(len(e.Subsamples)))
+		for _, s := range e.Subsamples {
+			if v == 1 {
+				w.putUint32(s.Size)
+			} else {
+				w.putUint16(uint16(s.Size))
+			}
+			w.putUint8(s.Priority)
+			w.putUint8(s.Discardable)
+			w.putUint32(s.CodecSpecificParameters)
+		}
+	}
+	w.EndBox()
+}
+
+// SaizAuxInfoTypePresent is the saiz and saio flag signalling that the
+// auxiliary information type and parameter fields are present.
+const SaizAuxInfoTypePresent = 0x000001
+
+// Saiz is a sample auxiliary information sizes box. When
+// DefaultSampleInfoSize is non-zero every sample has that size and
+// SampleInfoSizes is empty.
+type Saiz struct {
+	FullHeader
+	AuxInfoType           [4]byte
+	AuxInfoTypeParameter  uint32
+	DefaultSampleInfoSize uint8
+	SampleCount           uint32
+	SampleInfoSizes       []uint8
+}
+
+func (b *Saiz) Type() BoxType { return TypeSaiz }
+
+func (b *Saiz) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.AuxInfoType, b.AuxInfoTypeParameter = d.auxInfoType(flags)
+	b.DefaultSampleInfoSize = d.u8()
+	b.SampleCount = d.u32()
+	b.SampleInfoSizes = nil
+	if b.DefaultSampleInfoSize == 0 {
+		b.SampleInfoSizes = d.take(d.checkCount(int64(b.SampleCount), 1))
+	}
+	return d.err
+}
+
+func (b *Saiz) Encode(w *Writer) {
+	count, sizes := b.SampleCount, []uint8(nil)
+	if b.DefaultSampleInfoSize == 0 {
+		count, sizes = uint32(len(b.SampleInfoSizes)), b.SampleInfoSizes
+	}
+	if !w.beginBox(TypeSaiz, b.FullHeader, auxInfoTypeSize(b.Flags)+5+len(sizes)) {
+		return
+	}
+	w.putAuxInfoType(b.Flags, b.AuxInfoType, b.AuxInfoTypeParameter)
+	w.putUint8(b.DefaultSampleInfoSize)
+	w.putUint32(count)
+	w.putBytes(sizes)
+	w.EndBox()
+}
+
+// Saio is a sample auxiliary information offsets box.
+type Saio struct {
+	FullHeader
+	AuxInfoType          [4]byte
+	AuxInfoTypeParameter uint32
+	Offsets              []uint64
+}
+
+func (b *Saio) Type() BoxType { return TypeSaio }
+
+func (b *Saio) Decode(data []byte, version uint8, flags uint32) error {
+	b.FullHeader = FullHeader{version, flags}
+	d := decoder{data: data}
+	b.AuxInfoType, b.AuxInfoTypeParameter = d.auxInfoType(flags)
+	b.Offsets = make([]uint64, d.count(versionedSize(version, 4, 8)))
+	for i := range b.Offsets {
+		b.Offsets[i] = d.uv(version)
+	}
+	return d.err
+}
+
+func (b *Saio) Encode(w *Writer) {
+	v := b.Version
+	for _, o := range b.Offsets {
+		v = max(v, versionFor(o))
+	}
+	n := auxInfoTypeSize(b.Flags) + 4 + versionedSize(v, 4, 8)*len(b.Offsets)
+	if !w.beginBox(TypeSaio, FullHeader{v, b.Flags}, n) {
+		return
+	}
+	w.putAuxInfoType(b.Flags, b.AuxInfoType, b.AuxInfoTypeParameter)
+	w.putUint32(uint32(len(b.Offsets)))
+	for _, o := range b.Offsets {
+		w.putUV(v, o)
+	}
+	w.EndBox()
+}
+
+// auxInfoType reads the optional aux_info_type fields of saiz and saio.
+func (d *decoder) auxInfoType(flags uint32) (t [4]byte, param uint32) {
+	if flags&SaizAuxInfoTypePresent != 0 {
+		t = d.fourCC()
+		param = d.u32()
+	}
+	return t, param
+}
+
+func auxInfoTypeSize(flags uint32) int {
+	if flags&SaizAuxInfoTypePresent != 0 {
+		return 8
+	}
+	return 0
+}
+
+func (w *Writer) putAuxInfoType(flags uint32, t [4]byte, param uint32) {
+	if flags&SaizAuxInfoTypePresent != 0 {
+		w.putBytes(t[:])
+		w.putUint32(param)
+	}
+}
+
+// uint32s reads n uint32 values.
+func (d *decoder) uint32s(n int) []uint32 {
+	p := d.take(4 * n)
+	if p == nil {
+		return nil
+	}
+	v := make([]uint32, n)
+	for i := range v {
+		v[i] = be.Uint32(p[4*i:])
+	}
+	return v
+}
+
+// writeUint32Table writes a full box holding an entry count and uint32
+// entries, the layout of stco and stss.
+func (w *Writer) writeUint32Table(t BoxType, fh FullHeader, entries []uint32) {
+	if !w.beginBox(t, fh, 4+4*len(entries)) {
+		return
+	}
+	w.putUint32(uint32(len(entries)))
+	for _, e := range entries {
+		w.putUint32(e)
+	}
+	w.EndBox()
+}
@@ -0,0 +1,249 @@
+package mp4_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tetsuo/mp4"
+)
+
+// encodeExact encodes boxes into a buffer of exactly n bytes, so a box that
+// reserves too little or too much space fails.
+func encodeExact(t *testing.T, boxes []mp4.Box, n int) []byte {
+	t.Helper()
+	w := mp4.NewWriter(make([]byte, n))
+	for _, b := range boxes {
+		w.WriteBox(b)
+	}
+	if err := w.Err(); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return w.Bytes()
+}
+
+func TestBoxRoundTrip(t *testing.T) {
+	boxes := []mp4.Box{
+		&mp4.Ftyp{BoxType: mp4.TypeFtyp, MajorBrand: [4]byte{'i', 's', 'o', '6'}, CompatibleBrands: [][4]byte{{'d', 'a', 's', 'h'}}},
+		&mp4.Container{BoxType: mp4.TypeMoov, Children: []mp4.Box{
+			&mp4.Mvhd{Timescale: 1000, Duration: 1 << 33, Rate: 0x00010000, NextTrackID: 2},
+			&mp4.Container{BoxType: mp4.TypeStbl, Children: []mp4.Box{
+				&mp4.Stsd{Entries: []mp4.Box{&mp4.VisualSampleEntry{
+					BoxType: mp4.TypeAvc1, DataReferenceIndex: 1, Width: 640, Height: 360,
+					CompressorName: "x264", Depth: 24,
+					Children: []mp4.Box{&mp4.AvcC{
+						ConfigurationVersion: 1, Profile: 100, Level: 30, LengthSizeMinusOne: 3,
+						SPS: [][]byte{{0x67, 0x64}}, PPS: [][]byte{{0x68}},
+					}},
+				}}},
+				&mp4.Stts{Entries: []mp4.SttsEntry{{Count: 3, Duration: 512}}},
+				&mp4.Ctts{FullHeader: mp4.FullHeader{Version: 1}, Entries: []mp4.CttsEntry{{Count: 1, Offset: -512}}},
+				&mp4.Stsz{Entries: []uint32{10, 20, 30}},
+				&mp4.Stz2{FieldSize: 4, Entries: []uint16{1, 2, 3}},
+				&mp4.Padb{Pads: []uint8{1, 7, 3}},
+				&mp4.Sbgp{FullHeader: mp4.FullHeader{Version: 1}, GroupingType: [4]byte{'r', 'o', 'l', 'l'}, Entries: []mp4.SbgpEntry{{SampleCount: 3, GroupDescriptionIndex: 1}}},
+				&mp4.Sgpd{FullHeader: mp4.FullHeader{Version: 1}, GroupingType: [4]byte{'r', 'o', 'l', 'l'}, Entries: [][]byte{{0xff, 0xff}, {0, 1, 2}}},
+				&mp4.Subs{Entries: []mp4.SubsEntry{{SampleDelta: 1, Subsamples: []mp4.Subsample{{Size: 1 << 20, Priority: 1}}}}},
+				&mp4.Saio{Offsets: []uint64{1 << 40}},
+			}},
+		}},
+		&mp4.Container{BoxType: mp4.TypeMoof, Children: []mp4.Box{
+			&mp4.Mfhd{SequenceNumber: 1},
+			&mp4.Container{BoxType: mp4.TypeTraf, Children: []mp4.Box{
+				&mp4.Tfhd{FullHeader: mp4.FullHeader{Flags: mp4.TfhdBaseDataOffsetPresent | mp4.TfhdDefaultSampleSizePresent}, TrackID: 1, BaseDataOffset: 1 << 32, DefaultSampleSize: 100},
+				&mp4.Tfdt{BaseMediaDecodeTime: 90000},
+				&mp4.Trun{FullHeader: mp4.FullHeader{Flags: mp4.TrunDataOffsetPresent | mp4.TrunSampleDurationPresent}, DataOffset: 8, Entries: []mp4.TrunEntry{{Duration: 512}, {Duration: 512}}},
+			}},
+		}},
+		&mp4.Sidx{ReferenceID: 1, Timescale: 90000, Entries: []mp4.SidxEntry{{ReferencedSize: 1000, SubsegDuration: 90000, StartsWithSAP: true, SAPType: 1, SAPDeltaTime: 3}}},
+		&mp4.Emsg{FullHeader: mp4.FullHeader{Version: 1}, SchemeIDURI: "urn:test", Value: "1", Timescale: 1000, PresentationTime: 5, MessageData: []byte("hi")},
+		&mp4.RawBox{BoxType: mp4.BoxType{'a', 'b', 'c', 'd'}, Data: []byte{1, 2, 3}},
+	}
+
+	w := mp4.NewGrowWriter(nil)
+	for _, b := range boxes {
+		w.WriteBox(b)
+	}
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := w.Bytes()
+
+	decoded, err := mp4.DecodeBoxes(want)
+	if err != nil {
+		t.Fatalf("DecodeBoxes: %v", err)
+	}
+	if got := encodeExact(t, decoded, len(want)); !bytes.Equal(got, want) {
+		t.Errorf("re-encoded boxes differ:\n got %x\nwant %x", got, want)
+	}
+
+	moov := decoded[1].(*mp4.Container)
+	if mvhd := moov.Child(mp4.TypeMvhd).(*mp4.Mvhd); mvhd.Version != 1 || mvhd.Duration != 1<<33 {
+		t.Errorf("mvhd version %d duration %d, want version 1 for a 64-bit duration", mvhd.Version, mvhd.Duration)
+	}
+	stbl := moov.Child(mp4.TypeStbl).(*mp4.Container)
+	avc1 := stbl.Child(mp4.TypeStsd).(*mp4.Stsd).Entries[0].(*mp4.VisualSampleEntry)
+	if avcC, ok := avc1.Child(mp4.TypeAvcC).(*mp4.AvcC); !ok || avcC.Profile != 100 {
+		t.Errorf("avc1 child = %#v, want avcC with profile 100", avc1.Child(mp4.TypeAvcC))
+	}
+	if stz2 := stbl.Child(mp4.TypeStz2).(*mp4.Stz2); len(stz2.Entries) != 3 || stz2.Entries[2] != 3 {
+		t.Errorf("stz2 entries = %v, want [1 2 3]", stz2.Entries)
+	}
+	if sidx := decoded[3].(*mp4.Sidx); sidx.Entries[0].SAPDeltaTime != 3 {
+		t.Errorf("sidx SAPDeltaTime = %d, want 3", sidx.Entries[0].SAPDeltaTime)
+	}
+}
+
+func TestBoxRoundTripFile(t *testing.T) {
+	data, err := os.ReadFile("video-media-samples/big-buck-bunny-480p-30sec.mp4")
+	if err != nil {
+		t.Skipf("test file not available: %v", err)
+	}
+	r := mp4.NewReader(data)
+	for r.Next() {
+		if r.Type() != mp4.TypeMoov {
+			continue
+		}
+		b, err := r.ReadBox()
+		if err != nil {
+			t.Fatalf("ReadBox: %v", err)
+		}
+		want := data[r.Offset() : r.Offset()+int(r.Size())]
+		if got := encodeExact(t, []mp4.Box{b}, len(want)); !bytes.Equal(got, want) {
+			t.Error("re-encoded moov differs from the file")
+		}
+		return
+	}
+	t.Fatal("no moov found")
+}
+
+func TestReadBoxError(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	w.StartBox(mp4.TypeMoov)
+	w.StartFullBox(mp4.TypeMvhd, 0, 0)
+	w.Write(make([]byte, 10)) // far short of a version 0 mvhd
+	w.EndBox()
+	w.EndBox()
+
+	r := mp4.NewReader(w.Bytes())
+	r.Next()
+	if _, err := r.ReadBox(); err == nil {
+		t.Fatal("ReadBox succeeded on a truncated mvhd")
+	}
+	pe, ok := errors.AsType[*mp4.ParseError](r.Err())
+	if !ok {
+		t.Fatalf("Err = %v, want a *ParseError", r.Err())
+	}
+	if pe.Path != "moov/mvhd" || pe.Offset != 8 || !errors.Is(pe, mp4.ErrShortBox) {
+		t.Errorf("ParseError = %+v, want moov/mvhd at offset 8 wrapping ErrShortBox", pe)
+	}
+}
+
+func TestHeaderTimes(t *testing.T) {
+	created := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	modified := time.Date(2041, time.January, 1, 0, 0, 0, 0, time.UTC) // past 2^32 seconds since 1904
+
+	w := mp4.NewGrowWriter(nil)
+	tkhd := mp4.Tkhd{
+		CreationTime:     created,
+		ModificationTime: modified,
+		TrackID:          2,
+		AlternateGroup:   1,
+		Volume:           0x0100,
+		Matrix:           mp4.IdentityMatrix,
+	}
+	tkhd.Encode(&w)
+	w.WriteMvhd(1000, 0, 3)
+
+	r := mp4.NewReader(w.Bytes())
+	r.Next()
+	got := r.ReadTrackHeader()
+	if r.Version() != 1 {
+		t.Errorf("tkhd version = %d, want 1 for a time past 2040", r.Version())
+	}
+	if !got.CreationTime.Equal(created) || !got.ModificationTime.Equal(modified) {
+		t.Errorf("tkhd times = %v, %v, want %v, %v", got.CreationTime, got.ModificationTime, created, modified)
+	}
+	if got.AlternateGroup != 1 || got.Matrix != mp4.IdentityMatrix {
+		t.Errorf("tkhd = %+v, want alternate group 1 and the identity matrix", got)
+	}
+
+	r.Next()
+	if mvhd := r.ReadMovieHeader(); !mvhd.CreationTime.IsZero() || mvhd.Rate != 0x00010000 || mvhd.NextTrackID != 3 {
+		t.Errorf("mvhd = %+v, want unset times, rate 1.0 and next track 3", mvhd)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatrixRotation(t *testing.T) {
+	for _, deg := range []int{0, 90, 180, 270} {
+		for _, flip := range []bool{false, true} {
+			m := mp4.RotationMatrix(deg, flip)
+			if gotDeg, gotFlip := m.Rotation(); gotDeg != deg || gotFlip != flip {
+				t.Errorf("RotationMatrix(%d, %v).Rotation() = %d, %v", deg, flip, gotDeg, gotFlip)
+			}
+		}
+	}
+
+	// The matrix phones write for portrait recordings.
+	portrait := mp4.Matrix{0, 0x00010000, 0, -0x00010000, 0, 0, 0x01e00000, 0, 0x40000000}
+	if deg, flipped := portrait.Rotation(); deg != 90 || flipped {
+		t.Errorf("portrait rotation = %d, %v, want 90, false", deg, flipped)
+	}
+	if mp4.RotationMatrix(0, false) != mp4.IdentityMatrix {
+		t.Error("RotationMatrix(0, false) is not the identity matrix")
+	}
+}
+
+func TestReadAudioSpecificConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		data  []byte
+		want  mp4.AudioSpecificConfig
+		codec uint8
+	}{
+		{"AAC-LC", []byte{0x12, 0x10}, mp4.AudioSpecificConfig{
+			ObjectType: 2, SampleRate: 44100, ChannelConfig: 2, Channels: 2,
+		}, 2},
+		{"HE-AAC", []byte{0x2b, 0x11, 0x88, 0x00}, mp4.AudioSpecificConfig{
+			ObjectType: 2, SampleRate: 24000, ChannelConfig: 2, Channels: 2, SBR: true, ExtSampleRate: 48000,
+		}, 5},
+		{"HE-AAC v2", []byte{0xeb, 0x09, 0x88, 0x00}, mp4.AudioSpecificConfig{
+			ObjectType: 2, SampleRate: 24000, ChannelConfig: 1, Channels: 2, SBR: true, PS: true, ExtSampleRate: 48000,
+		}, 29},
+		// AAC-LC followed by the 0x2b7 SBR and 0x548 PS sync extensions.
+		{"explicit PS", []byte{0x13, 0x08, 0x56, 0xe5, 0x9d, 0x48, 0x80}, mp4.AudioSpecificConfig{
+			ObjectType: 2, SampleRate: 24000, ChannelConfig: 1, Channels: 2, SBR: true, PS: true, ExtSampleRate: 48000,
+		}, 29},
+		// Escaped object type 42 with an explicit 24-bit frequency.
+		{"USAC", []byte{0xf9, 0x5e, 0x01, 0x58, 0x88, 0x40}, mp4.AudioSpecificConfig{
+			ObjectType: 42, SampleRate: 44100, ChannelConfig: 2, Channels: 2,
+		}, 42},
+		// Channel configuration 0 with a 5.1 program config element.
+		{"PCE", []byte{0x11, 0x80, 0x04, 0xc8, 0x05, 0x00, 0x01, 0x08, 0x80, 0x00}, mp4.AudioSpecificConfig{
+			ObjectType: 2, SampleRate: 48000, Channels: 6,
+		}, 2},
+	} {
+		got, err := mp4.ReadAudioSpecificConfig(tc.data)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+		if c := got.CodecObjectType(); c != tc.codec {
+			t.Errorf("%s: CodecObjectType = %d, want %d", tc.name, c, tc.codec)
+		}
+	}
+
+	for _, data := range [][]byte{nil, {0x12}, {0x11, 0x80, 0x04, 0xc8}} {
+		if _, err := mp4.ReadAudioSpecificConfig(data); !errors.Is(err, mp4.ErrShortBox) {
+			t.Errorf("ReadAudioSpecificConfig(% x) error = %v, want ErrShortBox", data, err)
+		}
+	}
+}
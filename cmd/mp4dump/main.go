@@ -2,13 +2,17 @@
 package main
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/metadata"
 )
 
 // Format specifies the output format.
@@ -33,7 +37,7 @@ type BoxNode struct {
 func main() {
 	formatFlag := flag.String("format", "text", "output format: text (default), json")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "usage: %s [--format=text|json] <file.mp4>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "usage: %s [--format=text|json] <file.mp4 | ->\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -54,312 +58,435 @@ func main() {
 		os.Exit(1)
 	}
 
-	f, err := os.Open(flag.Arg(0))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error opening file: %v\n", err)
-		os.Exit(1)
-	}
-	defer f.Close()
-
-	// Build tree structure
-	var root []BoxNode
-
-	sc := mp4.NewScanner(f)
-	for sc.Next() {
-		e := sc.Entry()
-		node := BoxNode{
-			Type: string(e.Type[:]),
-			Size: uint64(e.Size),
+	// A path of "-" reads from standard input, which may be a pipe.
+	var (
+		ra   io.ReaderAt
+		size int64
+	)
+	if name := flag.Arg(0); name == "-" {
+		sf, err := readStream(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading input: %v\n", err)
+			os.Exit(1)
 		}
-
-		// Only load metadata boxes into memory for deep parsing
-		if e.Type == mp4.TypeMoov || e.Type == mp4.TypeMoof {
-			buf := make([]byte, e.DataSize())
-			if err := sc.ReadBody(buf); err != nil {
-				fmt.Fprintf(os.Stderr, "error reading %s: %v\n", e.Type, err)
-				continue
-			}
-			r := mp4.NewReader(buf)
-			node.Children = buildTree(&r)
-		} else if e.Type == mp4.TypeFtyp {
-			buf := make([]byte, e.DataSize())
-			if err := sc.ReadBody(buf); err != nil {
-				fmt.Fprintf(os.Stderr, "error reading ftyp: %v\n", err)
-				continue
-			}
-			f := mp4.ReadFtyp(buf)
-			node.Info = make(map[string]any)
-			node.Info["brand"] = string(f.MajorBrand[:])
-			node.Info["version"] = f.MinorVersion
-			if len(f.Compatible) > 0 {
-				compat := make([]string, len(f.Compatible))
-				for i, c := range f.Compatible {
-					compat[i] = string(c[:])
-				}
-				node.Info["compatible"] = compat
-			}
-		} else if e.Type == mp4.TypeMdat {
-			dataLen := int(e.DataSize())
-			node.DataLength = &dataLen
+		ra, size = sf, sf.size
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error opening file: %v\n", err)
+			os.Exit(1)
 		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error opening file: %v\n", err)
+			os.Exit(1)
+		}
+		ra, size = f, fi.Size()
+	}
 
-		root = append(root, node)
+	tree, err := mp4.ParseTree(ra, size, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse error: %v\n", err)
 	}
-	if err := sc.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "scan error: %v\n", err)
-		os.Exit(1)
+	root := make([]BoxNode, 0, len(tree))
+	for _, n := range tree {
+		root = append(root, buildNode(n, mp4.BoxType{}))
 	}
 
 	printTree(root, format)
 }
 
-func buildTree(r *mp4.Reader) []BoxNode {
-	var nodes []BoxNode
+// sparseFile is an io.ReaderAt over the parts of a stream that were kept:
+// every top-level box except mdat, and the header of each mdat. It lets
+// mp4.ParseTree run over input that cannot seek.
+type sparseFile struct {
+	parts []sparsePart
+	size  int64
+}
 
-	for r.Next() {
-		boxType := r.Type()
-		node := BoxNode{
-			Type: string(boxType[:]),
-			Size: r.Size(),
-		}
+type sparsePart struct {
+	offset int64
+	data   []byte
+}
 
-		if mp4.IsFullBox(r.Type()) {
-			v := r.Version()
-			f := r.Flags()
-			node.Version = &v
-			node.Flags = &f
+// readStream reads r to the end, keeping what mp4.ParseTree loads by default.
+func readStream(r io.Reader) (*sparseFile, error) {
+	sf := new(sparseFile)
+	sc := mp4.NewStreamScanner(r)
+	for sc.Next() {
+		e := sc.Entry()
+		if e.Size == 0 {
+			// The box runs to the end of the stream. Its header keeps the 0
+			// size, which mp4.ParseTree resolves against the stream length.
+			return sf, readToEnd(sf, &sc, e)
 		}
-
-		// Collect box-specific info
-		node.Info = collectBoxInfo(r)
-
-		// Descend into containers
-		if mp4.IsContainerBox(r.Type()) {
-			r.Enter()
-			node.Children = buildTree(r)
-			r.Exit()
-		} else if r.Type() == mp4.TypeStsd {
-			// Handle stsd: entry count + sub-boxes
-			r.Enter()
-			r.Skip(4) // skip entry count
-			for r.Next() {
-				child := buildSampleEntryNode(r)
-				node.Children = append(node.Children, child)
+		var data []byte
+		if e.Type == mp4.TypeMdat {
+			data = boxHeader(e)
+		} else {
+			data = make([]byte, e.Size)
+			if err := sc.ReadBox(data); err != nil {
+				return nil, err
 			}
-			r.Exit()
 		}
+		sf.parts = append(sf.parts, sparsePart{e.Offset, data})
+		sf.size = e.Offset + e.Size
+	}
+	return sf, sc.Err()
+}
 
-		nodes = append(nodes, node)
+// readToEnd adds the last box of the stream, whose size field is 0, to sf.
+func readToEnd(sf *sparseFile, sc *mp4.StreamScanner, e mp4.ScanEntry) error {
+	data := boxHeader(e)
+	var n int64
+	var err error
+	if e.Type == mp4.TypeMdat {
+		n, err = io.Copy(io.Discard, sc.Body())
+	} else {
+		var body []byte
+		body, err = io.ReadAll(sc.Body())
+		data = append(data, body...)
+		n = int64(len(body))
 	}
+	if err != nil {
+		return err
+	}
+	sf.parts = append(sf.parts, sparsePart{e.Offset, data})
+	sf.size = e.Offset + int64(e.HeaderSize) + n
+	return nil
+}
+
+// boxHeader rebuilds the header of the box described by e.
+func boxHeader(e mp4.ScanEntry) []byte {
+	hdr := make([]byte, 8, e.HeaderSize)
+	if large := e.HeaderSize == 16 || e.HeaderSize == 32; large {
+		binary.BigEndian.PutUint32(hdr, 1)
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(e.Size))
+	} else {
+		binary.BigEndian.PutUint32(hdr, uint32(e.Size))
+	}
+	copy(hdr[4:8], e.Type[:])
+	if e.Type == mp4.TypeUuid {
+		hdr = append(hdr, e.ExtendedType[:]...)
+	}
+	return hdr
+}
 
-	return nodes
+// ReadAt reads from the kept part that holds all of p's range.
+func (f *sparseFile) ReadAt(p []byte, off int64) (int, error) {
+	for _, part := range f.parts {
+		if off >= part.offset && off+int64(len(p)) <= part.offset+int64(len(part.data)) {
+			return copy(p, part.data[off-part.offset:]), nil
+		}
+	}
+	return 0, io.ErrUnexpectedEOF
 }
 
-func buildSampleEntryNode(r *mp4.Reader) BoxNode {
-	boxType := r.Type()
+// buildNode converts a parsed box and its children for printing. parent is
+// the type of the box that holds it.
+func buildNode(n *mp4.Node, parent mp4.BoxType) BoxNode {
+	if parent == mp4.TypeIlst {
+		return buildItemNode(n)
+	}
 	node := BoxNode{
-		Type: string(boxType[:]),
-		Size: r.Size(),
-		Info: make(map[string]any),
-	}
-
-	switch r.Type() {
-	case mp4.TypeAvc1:
-		v := mp4.ReadVisualSampleEntry(r.Data())
-		node.Info["width"] = v.Width
-		node.Info["height"] = v.Height
-		node.Info["compressor"] = v.CompressorName
-
-		// Enter to find avcC and other children
-		r.Enter()
-		r.Skip(v.ChildOffset)
-		for r.Next() {
-			childType := r.Type()
-			child := BoxNode{
-				Type: string(childType[:]),
-				Size: r.Size(),
-			}
-			if mp4.IsFullBox(r.Type()) {
-				ver := r.Version()
-				flg := r.Flags()
-				child.Version = &ver
-				child.Flags = &flg
-			}
-			if r.Type() == mp4.TypeAvcC {
-				codec := mp4.ReadAvcC(r.Data())
-				child.Info = map[string]any{"codec": codec}
+		Type: string(n.Type[:]),
+		Size: uint64(n.Size),
+		Info: boxInfo(n, parent),
+	}
+	if n.FullBox {
+		v, f := n.Version, n.Flags
+		node.Version = &v
+		node.Flags = &f
+	}
+	if n.Err != nil {
+		fmt.Fprintf(os.Stderr, "error decoding %s: %v\n", n.Type, n.Err)
+	}
+	if n.Type == mp4.TypeMdat {
+		dataLen := int(n.Size) - n.HeaderSize
+		node.DataLength = &dataLen
+	} else if parent == mp4.TypeStsd && n.Box == nil {
+		dataLen := len(n.Data)
+		node.DataLength = &dataLen
+	}
+	for _, c := range n.Children {
+		node.Children = append(node.Children, buildNode(c, n.Type))
+	}
+	return node
+}
+
+// buildItemNode converts an ilst item, decoding the value of each of its
+// data boxes.
+func buildItemNode(n *mp4.Node) BoxNode {
+	node := BoxNode{Type: itemKey(n.Type), Size: uint64(n.Size)}
+	for _, c := range n.Children {
+		child := BoxNode{Type: string(c.Type[:]), Size: uint64(c.Size)}
+		switch d := c.Data; c.Type {
+		case mp4.BoxType{'m', 'e', 'a', 'n'}, mp4.BoxType{'n', 'a', 'm', 'e'}:
+			if len(d) >= 4 {
+				child.Info = map[string]any{"name": string(d[4:])}
 			}
-			node.Children = append(node.Children, child)
-		}
-		r.Exit()
-
-	case mp4.TypeMp4a:
-		a := mp4.ReadAudioSampleEntry(r.Data())
-		node.Info["channelCount"] = a.ChannelCount
-		node.Info["sampleSize"] = a.SampleSize
-		node.Info["sampleRate"] = a.SampleRate >> 16
-
-		// Enter to find esds and other children
-		r.Enter()
-		r.Skip(a.ChildOffset)
-		for r.Next() {
-			childType := r.Type()
-			child := BoxNode{
-				Type: string(childType[:]),
-				Size: r.Size(),
+		case mp4.BoxType{'d', 'a', 't', 'a'}:
+			if len(d) < 8 {
+				fmt.Fprintf(os.Stderr, "error parsing %s: %v\n", node.Type, mp4.ErrShortBox)
+				break
 			}
-			if mp4.IsFullBox(r.Type()) {
-				ver := r.Version()
-				flg := r.Flags()
-				child.Version = &ver
-				child.Flags = &flg
+			it := metadata.Item{
+				Key:      n.Type,
+				DataType: metadata.DataType(binary.BigEndian.Uint32(d) & 0x00ffffff),
+				Value:    d[8:],
 			}
-			if r.Type() == mp4.TypeEsds {
-				codec := mp4.ReadEsdsCodec(r.Data())
-				child.Info = map[string]any{"codec": codec}
+			child.Info = itemInfo(&it)
+			if child.Info == nil {
+				dataLen := len(it.Value)
+				child.DataLength = &dataLen
 			}
-			node.Children = append(node.Children, child)
 		}
-		r.Exit()
+		node.Children = append(node.Children, child)
+	}
+	return node
+}
 
-	default:
-		if mp4.IsFullBox(r.Type()) {
-			ver := r.Version()
-			flg := r.Flags()
-			node.Version = &ver
-			node.Flags = &flg
+// itemInfo returns the value of a text or integer item, or nil for binary
+// values such as cover art.
+func itemInfo(it *metadata.Item) map[string]any {
+	switch it.DataType {
+	case metadata.DataUTF8, metadata.DataUTF16:
+		return map[string]any{"value": it.Text()}
+	}
+	if it.Key == metadata.KeyTrackNumber || it.Key == metadata.KeyDiscNumber {
+		if n, total, ok := it.Pair(); ok {
+			return map[string]any{"value": fmt.Sprintf("%d/%d", n, total)}
 		}
-		dataLen := len(r.Data())
-		node.DataLength = &dataLen
 	}
+	if v, ok := it.Int(); ok {
+		return map[string]any{"value": v}
+	}
+	return nil
+}
 
-	return node
+// itemKey renders an ilst item key, whose © is a Latin-1 byte, as UTF-8.
+func itemKey(t mp4.BoxType) string {
+	var b strings.Builder
+	for _, c := range t {
+		b.WriteRune(rune(c))
+	}
+	return b.String()
 }
 
-func collectBoxInfo(r *mp4.Reader) map[string]any {
-	info := make(map[string]any)
+// entryCount reads the entry count that starts the data of stsd and dref.
+func entryCount(data []byte) any {
+	if len(data) < 4 {
+		return nil
+	}
+	return binary.BigEndian.Uint32(data)
+}
 
-	switch r.Type() {
-	case mp4.TypeFtyp:
-		f := mp4.ReadFtyp(r.Data())
-		info["brand"] = string(f.MajorBrand[:])
-		info["version"] = f.MinorVersion
-		if len(f.Compatible) > 0 {
-			compat := make([]string, len(f.Compatible))
-			for i, c := range f.Compatible {
+func boxInfo(n *mp4.Node, parent mp4.BoxType) map[string]any {
+	info := make(map[string]any)
+	data := n.Data
+
+	switch b := n.Box.(type) {
+	case *mp4.Ftyp:
+		info["brand"] = string(b.MajorBrand[:])
+		info["version"] = b.MinorVersion
+		if len(b.CompatibleBrands) > 0 {
+			compat := make([]string, len(b.CompatibleBrands))
+			for i, c := range b.CompatibleBrands {
 				compat[i] = string(c[:])
 			}
 			info["compatible"] = compat
 		}
+		return info
+
+	case *mp4.Mvhd:
+		addTimes(info, b.CreationTime, b.ModificationTime)
+		info["timescale"] = b.Timescale
+		info["duration"] = b.Duration
+		info["rate"] = float64(b.Rate) / 0x10000
+		info["volume"] = float64(b.Volume) / 0x100
+		addMatrix(info, b.Matrix)
+		info["nextTrackId"] = b.NextTrackID
+		return info
+
+	case *mp4.Tkhd:
+		addTimes(info, b.CreationTime, b.ModificationTime)
+		info["trackId"] = b.TrackID
+		info["duration"] = b.Duration
+		info["layer"] = b.Layer
+		if b.AlternateGroup != 0 {
+			info["alternateGroup"] = b.AlternateGroup
+		}
+		info["volume"] = float64(b.Volume) / 0x100
+		addMatrix(info, b.Matrix)
+		info["width"] = b.Width >> 16
+		info["height"] = b.Height >> 16
+		return info
+
+	case *mp4.Mdhd:
+		addTimes(info, b.CreationTime, b.ModificationTime)
+		info["timescale"] = b.Timescale
+		info["duration"] = b.Duration
+		info["language"] = mp4.DecodeLanguage(b.Language)
+		return info
+
+	case *mp4.Elng:
+		info["language"] = b.ExtendedLanguage
+		return info
+
+	case *mp4.Hdlr:
+		info["handlerType"] = string(b.HandlerType[:])
+		info["name"] = b.Name
+		return info
+
+	case *mp4.VisualSampleEntry:
+		info["width"] = b.Width
+		info["height"] = b.Height
+		info["compressor"] = b.CompressorName
+		return info
+
+	case *mp4.AudioSampleEntry:
+		info["channelCount"] = b.ChannelCount
+		info["sampleSize"] = b.SampleSize
+		info["sampleRate"] = b.SampleRate >> 16
+		return info
+
+	case *mp4.Mehd:
+		info["fragmentDuration"] = b.FragmentDuration
+		return info
+
+	case *mp4.Trex:
+		info["trackId"] = b.TrackID
+		return info
+
+	case *mp4.Mfhd:
+		info["sequence"] = b.SequenceNumber
+		return info
+
+	case *mp4.Tfdt:
+		info["baseMediaDecodeTime"] = b.BaseMediaDecodeTime
+		return info
+	}
+
+	switch n.Type {
+	case mp4.TypeUuid:
+		info["uuid"] = formatUUID(n.ExtendedType)
+
+	case mp4.TypeAvcC:
+		info["codec"] = mp4.ReadAvcC(data)
 
-	case mp4.TypeMvhd:
-		ts, dur, ntid := r.ReadMvhd()
-		info["timescale"] = ts
-		info["duration"] = dur
-		info["nextTrackId"] = ntid
-
-	case mp4.TypeTkhd:
-		tid, dur, w, h := r.ReadTkhd()
-		info["trackId"] = tid
-		info["duration"] = dur
-		info["width"] = w >> 16
-		info["height"] = h >> 16
-
-	case mp4.TypeMdhd:
-		ts, dur, lang := r.ReadMdhd()
-		info["timescale"] = ts
-		info["duration"] = dur
-		info["language"] = lang
-
-	case mp4.TypeHdlr:
-		ht := r.ReadHdlr()
-		name := r.ReadHdlrName()
-		info["handlerType"] = string(ht[:])
-		info["name"] = name
-
-	case mp4.TypeStsd:
-		if len(r.Data()) >= 4 {
-			info["entries"] = r.EntryCount()
+	case mp4.TypeEsds:
+		info["codec"] = mp4.ReadEsdsCodec(data)
+
+	case mp4.TypeStsd, mp4.TypeDref:
+		if c := entryCount(data); c != nil {
+			info["entries"] = c
 		}
 
 	case mp4.TypeStsz:
-		it := mp4.NewStszIter(r.Data())
+		it := mp4.NewStszIter(data)
+		info["entries"] = it.Count()
+
+	case mp4.TypeStz2:
+		it := mp4.NewStz2Iter(data)
 		info["entries"] = it.Count()
+		info["fieldSize"] = it.FieldSize()
 
 	case mp4.TypeStco, mp4.TypeStss:
-		it := mp4.NewUint32Iter(r.Data())
+		it := mp4.NewUint32Iter(data)
 		info["entries"] = it.Count()
 
 	case mp4.TypeCo64:
-		it := mp4.NewCo64Iter(r.Data())
+		it := mp4.NewCo64Iter(data)
 		info["entries"] = it.Count()
 
 	case mp4.TypeStts:
-		it := mp4.NewSttsIter(r.Data())
+		it := mp4.NewSttsIter(data)
 		info["entries"] = it.Count()
 
 	case mp4.TypeCtts:
-		it := mp4.NewCttsIter(r.Data(), r.Version())
+		it := mp4.NewCttsIter(data, n.Version)
 		info["entries"] = it.Count()
 
 	case mp4.TypeStsc:
-		it := mp4.NewStscIter(r.Data())
+		it := mp4.NewStscIter(data)
 		info["entries"] = it.Count()
 
 	case mp4.TypeElst:
-		it := mp4.NewElstIter(r.Data(), r.Version())
+		it := mp4.NewElstIter(data, n.Version)
 		info["entries"] = it.Count()
 
-	case mp4.TypeDref:
-		if len(r.Data()) >= 4 {
-			info["entries"] = r.EntryCount()
-		}
-
-	case mp4.TypeMehd:
-		dur := r.ReadMehd()
-		info["fragmentDuration"] = dur
-
-	case mp4.TypeTrex:
-		tid, _, _, _, _ := r.ReadTrex()
-		info["trackId"] = tid
-
-	case mp4.TypeMfhd:
-		seq := r.ReadMfhd()
-		info["sequence"] = seq
-
 	case mp4.TypeTfhd:
-		tid := r.ReadTfhd()
-		info["trackId"] = tid
-
-	case mp4.TypeTfdt:
-		bt := r.ReadTfdt()
-		info["baseMediaDecodeTime"] = bt
+		tfhd, err := mp4.ReadTfhdInfo(data, n.Flags)
+		if err != nil {
+			break
+		}
+		info["trackId"] = tfhd.TrackID
+		if tfhd.Flags&mp4.TfhdBaseDataOffsetPresent != 0 {
+			info["baseDataOffset"] = tfhd.BaseDataOffset
+		}
+		if tfhd.Flags&mp4.TfhdSampleDescriptionIndexPresent != 0 {
+			info["sampleDescriptionIndex"] = tfhd.SampleDescriptionIndex
+		}
+		if tfhd.Flags&mp4.TfhdDefaultSampleDurationPresent != 0 {
+			info["defaultSampleDuration"] = tfhd.DefaultSampleDuration
+		}
+		if tfhd.Flags&mp4.TfhdDefaultSampleSizePresent != 0 {
+			info["defaultSampleSize"] = tfhd.DefaultSampleSize
+		}
+		if tfhd.Flags&mp4.TfhdDefaultSampleFlagsPresent != 0 {
+			info["defaultSampleFlags"] = tfhd.DefaultSampleFlags
+		}
 
 	case mp4.TypeTrun:
-		it := mp4.NewTrunIter(r.Data(), r.Flags())
+		it := mp4.NewTrunIter(data, n.Flags)
 		info["entries"] = it.Count()
-		if r.Flags()&mp4.TrunDataOffsetPresent != 0 {
+		if n.Flags&mp4.TrunDataOffsetPresent != 0 {
 			info["dataOffset"] = it.DataOffset()
 		}
 
-	case mp4.TypeMdat:
-		info["dataLength"] = len(r.Data())
+	case mp4.TypeSidx:
+		it := mp4.NewSidxIter(data, n.Version)
+		info["referenceId"] = it.ReferenceID()
+		info["timescale"] = it.Timescale()
+		info["earliestPresentationTime"] = it.EarliestPresentationTime()
+		info["entries"] = it.Count()
+
+	case mp4.TypeMdat, mp4.TypeVmhd, mp4.TypeSmhd:
+		// mdat's length is the node's DataLength
 
-	case mp4.TypeVmhd:
-		// graphicsMode and opcolor
-	case mp4.TypeSmhd:
-		// balance
 	default:
-		if !mp4.IsContainerBox(r.Type()) {
-			if len(r.Data()) > 0 {
-				info["dataLength"] = len(r.Data())
-			}
+		if !mp4.IsContainerBox(n.Type) && parent != mp4.TypeStsd && len(data) > 0 {
+			info["dataLength"] = len(data)
 		}
 	}
-
 	return info
 }
 
+// formatUUID formats an extended box type in the canonical 8-4-4-4-12 form.
+func formatUUID(u [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// addTimes records the creation and modification times of a header box,
+// leaving out those the file does not set.
+func addTimes(info map[string]any, created, modified time.Time) {
+	if !created.IsZero() {
+		info["created"] = created.Format(time.RFC3339)
+	}
+	if !modified.IsZero() {
+		info["modified"] = modified.Format(time.RFC3339)
+	}
+}
+
+// addMatrix records a header's transformation matrix unless it is the
+// identity.
+func addMatrix(info map[string]any, m mp4.Matrix) {
+	if m != mp4.IdentityMatrix {
+		info["matrix"] = m
+	}
+}
+
 // printTree prints the tree in the specified format
 func printTree(nodes []BoxNode, format Format) {
 	switch format {
@@ -409,6 +536,20 @@ func printNodeText(node BoxNode, depth int) {
 				fmt.Printf(" nextTrackId=%v", val)
 			case "trackId":
 				fmt.Printf(" trackId=%v", val)
+			case "alternateGroup":
+				fmt.Printf(" altGroup=%v", val)
+			case "created":
+				fmt.Printf(" created=%v", val)
+			case "modified":
+				fmt.Printf(" modified=%v", val)
+			case "rate":
+				fmt.Printf(" rate=%v", val)
+			case "volume":
+				fmt.Printf(" volume=%v", val)
+			case "layer":
+				fmt.Printf(" layer=%v", val)
+			case "matrix":
+				fmt.Printf(" matrix=%v", val)
 			case "width":
 				if depth > 0 && node.Type == "avc1" {
 					// Special handling for sample entries
@@ -446,6 +587,10 @@ func printNodeText(node BoxNode, depth int) {
 				fmt.Printf(" compressor=%q", val)
 			case "codec":
 				fmt.Printf(" codec=%v", val)
+			case "uuid":
+				fmt.Printf(" uuid=%v", val)
+			case "value":
+				fmt.Printf(" value=%q", fmt.Sprint(val))
 			case "dataLength":
 				// Skip, will be handled by DataLength field
 			}
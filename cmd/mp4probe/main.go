@@ -2,32 +2,57 @@
 package main
 
 import (
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
 
+	"github.com/tetsuo/mp4"
 	"github.com/tetsuo/mp4/fragment"
+	"github.com/tetsuo/mp4/metadata"
 	"github.com/tetsuo/mp4/track"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "usage: %s <file.mp4>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "usage: %s <file.mp4 | ->\n", os.Args[0])
 		os.Exit(1)
 	}
 
-	f, err := os.Open(os.Args[1])
+	var sc boxScanner
+	if os.Args[1] == "-" {
+		// Standard input may be a pipe, so read the moov without seeking.
+		ss := mp4.NewStreamScanner(os.Stdin)
+		sc = &ss
+	} else {
+		f, err := os.Open(os.Args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		fs := mp4.NewScanner(f)
+		sc = &fs
+	}
+	moov, err := readMoov(sc)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
-	defer f.Close()
-
-	fr, initSeg, err := fragment.NewReader(f)
+	// Only sample metadata is needed, so the reader never touches media data.
+	fr, initSeg, err := fragment.NewMoovReader(moov)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
+	// Tags are optional, so a malformed ilst does not stop the probe.
+	tags, err := metadata.Read(moov)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: reading tags: %v\n", err)
+	}
+	if tags != nil {
+		printTags(tags)
+	}
 
 	fmt.Printf("Tracks: %d\n", len(initSeg.Tracks))
 	for _, t := range initSeg.Tracks {
@@ -37,6 +62,7 @@ func main() {
 		}
 		fmt.Printf("\n%s Track (ID=%d):\n", kind, t.ID)
 		fmt.Printf("  Codec: %s\n", t.Codec())
+		fmt.Printf("  Language: %s\n", t.PreferredLanguage())
 		fmt.Printf("  Timescale: %d\n", t.TimeScale)
 		seconds := 0.0
 		if t.TimeScale > 0 {
@@ -46,6 +72,12 @@ func main() {
 
 		if t.Kind == track.TrackVideo {
 			fmt.Printf("  Resolution: %dx%d\n", t.Width, t.Height)
+			deg, flipped := t.Rotation()
+			fmt.Printf("  Rotation: %d°", deg)
+			if flipped {
+				fmt.Printf(" (mirrored)")
+			}
+			fmt.Println()
 		} else {
 			fmt.Printf("  Channels: %d\n", t.ChannelCount)
 			fmt.Printf("  Sample Rate: %d\n", t.SampleRate)
@@ -95,3 +127,86 @@ func main() {
 	fmt.Printf("\nSummary: %d fragments, %d samples, %d video keyframes\n",
 		fragCount, totalSamples, totalVideoSync)
 }
+
+// boxScanner is the part of mp4.Scanner and mp4.StreamScanner used to find
+// the moov box.
+type boxScanner interface {
+	Next() bool
+	Entry() mp4.ScanEntry
+	ReadBox(buf []byte) error
+	Err() error
+}
+
+// readMoov finds the moov box and loads it, skipping media data.
+func readMoov(sc boxScanner) ([]byte, error) {
+	for sc.Next() {
+		e := sc.Entry()
+		if e.Type != mp4.TypeMoov {
+			continue
+		}
+		if ss, ok := sc.(*mp4.StreamScanner); ok && e.Size == 0 {
+			return readMoovToEnd(ss, e)
+		}
+		if e.Size > fragment.DefaultMaxMoovSize {
+			return nil, fragment.ErrMoovTooLarge
+		}
+		moov := make([]byte, e.Size)
+		if err := sc.ReadBox(moov); err != nil {
+			return nil, err
+		}
+		return moov, nil
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fragment.ErrNoMoov
+}
+
+// readMoovToEnd loads a moov box whose size field is 0, so that it runs to the
+// end of the stream, and writes its actual size into the header.
+func readMoovToEnd(ss *mp4.StreamScanner, e mp4.ScanEntry) ([]byte, error) {
+	limit := fragment.DefaultMaxMoovSize - int64(e.HeaderSize)
+	body, err := io.ReadAll(io.LimitReader(ss.Body(), limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fragment.ErrMoovTooLarge
+	}
+	moov := binary.BigEndian.AppendUint32(nil, uint32(e.HeaderSize+len(body)))
+	moov = append(moov, e.Type[:]...)
+	return append(moov, body...), nil
+}
+
+// printTags prints the iTunes metadata tags that are set.
+func printTags(t *metadata.Tags) {
+	fmt.Printf("Tags:\n")
+	for _, f := range []struct{ name, value string }{
+		{"Title", t.Title},
+		{"Artist", t.Artist},
+		{"Album Artist", t.AlbumArtist},
+		{"Album", t.Album},
+		{"Year", t.Year},
+		{"Genre", t.Genre},
+		{"Comment", t.Comment},
+		{"Composer", t.Composer},
+		{"Encoder", t.Encoder},
+	} {
+		if f.value != "" {
+			fmt.Printf("  %s: %s\n", f.name, f.value)
+		}
+	}
+	if t.TrackNumber != 0 || t.TrackTotal != 0 {
+		fmt.Printf("  Track: %d/%d\n", t.TrackNumber, t.TrackTotal)
+	}
+	if t.DiscNumber != 0 || t.DiscTotal != 0 {
+		fmt.Printf("  Disc: %d/%d\n", t.DiscNumber, t.DiscTotal)
+	}
+	for _, p := range t.Covers {
+		fmt.Printf("  Cover: %s, %d bytes\n", p.MIMEType(), len(p.Data))
+	}
+	for _, it := range t.Freeform {
+		fmt.Printf("  %s:%s: %s\n", it.Mean, it.Name, it.Text())
+	}
+	fmt.Println()
+}
@@ -1,88 +1,329 @@
 package mp4
 
-import "strconv"
+import (
+	"errors"
+	"strconv"
+)
 
-// ReadEsdsCodec extracts the MIME codec string from esds box data.
-// It parses the MPEG-4 descriptor chain to find the OTI (Object Type Indication)
-// and audio configuration. Returns a string like "40.2" for AAC-LC.
-func ReadEsdsCodec(data []byte) string {
-	if len(data) < 2 {
-		return ""
-	}
+// ErrInvalidDescriptor is returned for an MPEG-4 descriptor that is not an
+// ES_Descriptor where one is expected, lacks its DecoderConfigDescriptor, or
+// has a malformed or oversized length.
+var ErrInvalidDescriptor = errors.New("mp4: invalid MPEG-4 descriptor")
 
-	// Expect ESDescriptor (tag 0x03)
-	ptr, end := 0, len(data)
-	if data[ptr] != 0x03 {
-		return ""
-	}
-	ptr++
+// MPEG-4 descriptor tags (ISO/IEC 14496-1) found in an esds box.
+const (
+	DescTagES                  = 0x03 // ES_Descriptor
+	DescTagDecoderConfig       = 0x04 // DecoderConfigDescriptor
+	DescTagDecoderSpecificInfo = 0x05 // DecoderSpecificInfo
+	DescTagSLConfig            = 0x06 // SLConfigDescriptor
+)
 
-	// Skip length bytes (variable-length encoding)
-	ptr = skipDescriptorLength(data, ptr, end)
-	if ptr < 0 || ptr+3 > end {
-		return ""
-	}
+// Stream types of a DecoderConfigDescriptor.
+const (
+	StreamTypeVisual = 0x04
+	StreamTypeAudio  = 0x05
+)
+
+// ObjectTypeMPEG4Audio is the object type indication of MPEG-4 audio such as
+// AAC, whose DecoderSpecificInfo is an AudioSpecificConfig.
+const ObjectTypeMPEG4Audio = 0x40
+
+// SLPredefinedMP4 is the predefined SLConfigDescriptor that MP4 files use.
+const SLPredefinedMP4 = 2
+
+// maxDescriptorSize is the largest length the four-byte expandable size field
+// of a descriptor can hold.
+const maxDescriptorSize = 1<<28 - 1
+
+// ESDescriptor is the MPEG-4 ES_Descriptor held in an esds box. Byte slices
+// read by [ReadESDescriptor] point into the decoded data.
+type ESDescriptor struct {
+	ESID           uint16
+	StreamPriority uint8  // 5 bits
+	DependsOnESID  uint16 // zero if the stream depends on no other
+	URL            string // at most 255 bytes; empty if none
+	OCRESID        uint16 // zero if there is no OCR stream
+
+	DecoderConfig DecoderConfigDescriptor
+	SLConfig      SLConfigDescriptor
+
+	// Other holds the remaining descriptors, such as IPI or QoS descriptors,
+	// undecoded.
+	Other []Descriptor
+}
+
+// DecoderConfigDescriptor describes the decoder an elementary stream needs.
+type DecoderConfigDescriptor struct {
+	ObjectTypeIndication uint8 // such as ObjectTypeMPEG4Audio
+	StreamType           uint8 // 6 bits, such as StreamTypeAudio
+	UpStream             bool
+	BufferSizeDB         uint32 // 24 bits, in bytes
+	MaxBitrate           uint32 // bits per second
+	AvgBitrate           uint32 // bits per second; zero for variable bitrate
+
+	// DecoderSpecificInfo holds the codec configuration, such as the
+	// AudioSpecificConfig of AAC, or nil if there is none.
+	DecoderSpecificInfo []byte
+
+	// Other holds the remaining descriptors, such as profile level
+	// indication index descriptors, undecoded.
+	Other []Descriptor
+}
 
-	// ES_ID (2 bytes) + stream dependency flags (1 byte)
-	flags := data[ptr+2]
-	ptr += 3
+// SLConfigDescriptor is the sync layer configuration of a stream.
+type SLConfigDescriptor struct {
+	Predefined uint8  // SLPredefinedMP4 in MP4 files, or zero for Custom
+	Custom     []byte // the fields after Predefined, undecoded
+}
+
+// Descriptor is an MPEG-4 descriptor the package does not decode.
+type Descriptor struct {
+	Tag  uint8
+	Data []byte // the descriptor body, after the tag and length
+}
+
+// ReadESDescriptor decodes the ES_Descriptor in esds box data, after the
+// version and flags. It returns [ErrShortBox] for a descriptor that runs past
+// the data and [ErrInvalidDescriptor] for a malformed one. Bytes after the
+// ES_Descriptor are ignored.
+func ReadESDescriptor(data []byte) (ESDescriptor, error) {
+	d := decoder{data: data}
+	tag, body := d.descriptor()
+	if d.err != nil {
+		return ESDescriptor{}, d.err
+	}
+	if tag != DescTagES {
+		return ESDescriptor{}, ErrInvalidDescriptor
+	}
+	var es ESDescriptor
+	if err := es.decode(body); err != nil {
+		return ESDescriptor{}, err
+	}
+	return es, nil
+}
 
-	// Skip optional fields based on flags
+// decode decodes the body of an ES_Descriptor. The first decoder config and
+// SL config descriptors fill their fields; the rest go to Other.
+func (es *ESDescriptor) decode(data []byte) error {
+	d := decoder{data: data}
+	es.ESID = d.u16()
+	flags := d.u8()
+	es.StreamPriority = flags & 0x1f
 	if flags&0x80 != 0 { // streamDependenceFlag
-		ptr += 2
+		es.DependsOnESID = d.u16()
 	}
 	if flags&0x40 != 0 { // URL_Flag
-		if ptr >= end {
-			return ""
-		}
-		urlLen := int(data[ptr])
-		ptr += 1 + urlLen
+		es.URL = string(d.take(int(d.u8())))
 	}
 	if flags&0x20 != 0 { // OCRstreamFlag
-		ptr += 2
+		es.OCRESID = d.u16()
+	}
+	config, sl := false, false
+	for d.err == nil && d.pos < len(d.data) {
+		tag, body := d.descriptor()
+		switch {
+		case d.err != nil:
+		case tag == DescTagDecoderConfig && !config:
+			config = true
+			d.err = es.DecoderConfig.decode(body)
+		case tag == DescTagSLConfig && !sl:
+			sl = true
+			s := decoder{data: body}
+			es.SLConfig.Predefined = s.u8()
+			if c := s.rest(); len(c) > 0 {
+				es.SLConfig.Custom = c
+			}
+			d.err = s.err
+		default:
+			es.Other = append(es.Other, Descriptor{Tag: tag, Data: body})
+		}
+	}
+	if d.err == nil && !config {
+		return ErrInvalidDescriptor
 	}
+	return d.err
+}
 
-	if ptr >= end {
-		return ""
+// decode decodes the body of a DecoderConfigDescriptor.
+func (c *DecoderConfigDescriptor) decode(data []byte) error {
+	d := decoder{data: data}
+	c.ObjectTypeIndication = d.u8()
+	b := d.u8()
+	c.StreamType = b >> 2
+	c.UpStream = b&0x02 != 0
+	c.BufferSizeDB = d.u24()
+	c.MaxBitrate = d.u32()
+	c.AvgBitrate = d.u32()
+	for d.err == nil && d.pos < len(d.data) {
+		tag, body := d.descriptor()
+		switch {
+		case d.err != nil:
+		case tag == DescTagDecoderSpecificInfo && c.DecoderSpecificInfo == nil:
+			c.DecoderSpecificInfo = body
+		default:
+			c.Other = append(c.Other, Descriptor{Tag: tag, Data: body})
+		}
 	}
+	return d.err
+}
 
-	// Expect DecoderConfigDescriptor (tag 0x04)
-	if data[ptr] != 0x04 {
-		return ""
+// descriptor reads the tag, expandable length and body of a descriptor.
+func (d *decoder) descriptor() (tag uint8, body []byte) {
+	tag = d.u8()
+	n := 0
+	for i := 0; ; i++ {
+		b := d.u8()
+		if d.err != nil {
+			return 0, nil
+		}
+		n = n<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			d.err = ErrInvalidDescriptor
+			return 0, nil
+		}
 	}
-	ptr++
-	ptr = skipDescriptorLength(data, ptr, end)
-	if ptr < 0 || ptr+13 > end {
-		return ""
+	return tag, d.take(n)
+}
+
+// size returns the length of the ES_Descriptor body.
+func (es *ESDescriptor) size() int {
+	n := 3 + descriptorSize(es.DecoderConfig.size()) + descriptorSize(1+len(es.SLConfig.Custom))
+	if es.DependsOnESID != 0 {
+		n += 2
+	}
+	if es.URL != "" {
+		n += 1 + min(len(es.URL), 255)
 	}
+	if es.OCRESID != 0 {
+		n += 2
+	}
+	return n + othersSize(es.Other)
+}
 
-	oti := data[ptr]
-	if oti == 0 {
-		return ""
+// size returns the length of the DecoderConfigDescriptor body.
+func (c *DecoderConfigDescriptor) size() int {
+	n := 13
+	if c.DecoderSpecificInfo != nil {
+		n += descriptorSize(len(c.DecoderSpecificInfo))
+	}
+	return n + othersSize(c.Other)
+}
+
+func othersSize(other []Descriptor) int {
+	n := 0
+	for _, o := range other {
+		n += descriptorSize(len(o.Data))
+	}
+	return n
+}
+
+// descriptorSize returns the encoded size of a descriptor with an n-byte body.
+func descriptorSize(n int) int { return 1 + lengthSize(n) + n }
+
+// lengthSize returns the bytes the shortest expandable length of n takes.
+func lengthSize(n int) int {
+	switch {
+	case n < 1<<7:
+		return 1
+	case n < 1<<14:
+		return 2
+	case n < 1<<21:
+		return 3
+	}
+	return 4
+}
+
+// putESDescriptor writes es, whose body is n bytes long.
+func (w *Writer) putESDescriptor(es *ESDescriptor, n int) {
+	w.putDescriptorHeader(DescTagES, n)
+	w.putUint16(es.ESID)
+	flags := es.StreamPriority & 0x1f
+	if es.DependsOnESID != 0 {
+		flags |= 0x80
+	}
+	if es.URL != "" {
+		flags |= 0x40
+	}
+	if es.OCRESID != 0 {
+		flags |= 0x20
+	}
+	w.putUint8(flags)
+	if es.DependsOnESID != 0 {
+		w.putUint16(es.DependsOnESID)
+	}
+	if es.URL != "" {
+		url := es.URL[:min(len(es.URL), 255)]
+		w.putUint8(uint8(len(url)))
+		w.putString(url)
+	}
+	if es.OCRESID != 0 {
+		w.putUint16(es.OCRESID)
 	}
 
-	// Format OTI as hex
-	otiStr := hexByte(oti)
+	c := &es.DecoderConfig
+	w.putDescriptorHeader(DescTagDecoderConfig, c.size())
+	w.putUint8(c.ObjectTypeIndication)
+	b := c.StreamType<<2 | 0x01 // reserved bit
+	if c.UpStream {
+		b |= 0x02
+	}
+	w.putUint8(b)
+	w.putUint8(uint8(c.BufferSizeDB >> 16))
+	w.putUint16(uint16(c.BufferSizeDB))
+	w.putUint32(c.MaxBitrate)
+	w.putUint32(c.AvgBitrate)
+	if c.DecoderSpecificInfo != nil {
+		w.putDescriptorHeader(DescTagDecoderSpecificInfo, len(c.DecoderSpecificInfo))
+		w.putBytes(c.DecoderSpecificInfo)
+	}
+	w.putDescriptors(c.Other)
 
-	// Skip to DecoderSpecificInfo: OTI(1)+streamType(1)+bufferSizeDB(3)+maxBitrate(4)+avgBitrate(4) = 13
-	ptr += 13
+	w.putDescriptorHeader(DescTagSLConfig, 1+len(es.SLConfig.Custom))
+	w.putUint8(es.SLConfig.Predefined)
+	w.putBytes(es.SLConfig.Custom)
+	w.putDescriptors(es.Other)
+}
 
-	if ptr >= end || data[ptr] != 0x05 {
-		// No DecoderSpecificInfo, return just OTI
-		return otiStr
+func (w *Writer) putDescriptors(other []Descriptor) {
+	for _, o := range other {
+		w.putDescriptorHeader(o.Tag, len(o.Data))
+		w.putBytes(o.Data)
 	}
-	ptr++
-	ptr = skipDescriptorLength(data, ptr, end)
-	if ptr < 0 || ptr >= end {
-		return otiStr
+}
+
+// putDescriptorHeader writes a descriptor tag and the shortest expandable
+// length of n.
+func (w *Writer) putDescriptorHeader(tag uint8, n int) {
+	w.putUint8(tag)
+	for s := 7 * (lengthSize(n) - 1); s > 0; s -= 7 {
+		w.putUint8(byte(n>>s) | 0x80)
 	}
+	w.putUint8(byte(n & 0x7f))
+}
 
-	// Extract audio object type from first byte
-	audioConfig := (data[ptr] & 0xf8) >> 3
-	if audioConfig == 0 {
-		return otiStr
+// ReadEsdsCodec extracts the MIME codec string from esds box data.
+// It parses the MPEG-4 descriptor chain to find the OTI (Object Type Indication)
+// and, for MPEG-4 audio, the audio object type of its AudioSpecificConfig.
+// Returns a string like "40.2" for AAC-LC, "40.5" and "40.29" for HE-AAC and
+// HE-AAC v2, or just the OTI, such as "dd" for Vorbis.
+func ReadEsdsCodec(data []byte) string {
+	es, err := ReadESDescriptor(data)
+	oti := es.DecoderConfig.ObjectTypeIndication
+	if err != nil || oti == 0 {
+		return ""
+	}
+	s := hexByte(oti)
+	if oti != ObjectTypeMPEG4Audio {
+		return s
+	}
+	asc, err := ReadAudioSpecificConfig(es.DecoderConfig.DecoderSpecificInfo)
+	if aot := asc.CodecObjectType(); err == nil && aot != 0 {
+		s += "." + strconv.Itoa(int(aot))
 	}
-	return otiStr + "." + strconv.Itoa(int(audioConfig))
+	return s
 }
 
 // hexByte formats a byte as a lowercase hex string without leading zeros beyond one digit.
@@ -96,19 +337,6 @@ func hexByte(b byte) string {
 	return string(buf[:])
 }
 
-// skipDescriptorLength skips the variable-length descriptor length field.
-// Returns the new position, or -1 on error.
-func skipDescriptorLength(data []byte, ptr, end int) int {
-	for ptr < end {
-		b := data[ptr]
-		ptr++
-		if b&0x80 == 0 {
-			return ptr
-		}
-	}
-	return -1
-}
-
 const hexChars = "0123456789abcdef"
 
 // hexDigit returns the lowercase hex character for a 4-bit nibble.
@@ -0,0 +1,37 @@
+package mp4
+
+import "strconv"
+
+// ParseError describes a malformed or unreadable box. It records where the box
+// sits in the file and wraps the underlying cause, so [errors.Is] still matches
+// sentinels such as [ErrShortBox].
+//
+// Path lists the box types from the outermost box down, separated by slashes.
+// A type that occurs more than once among its siblings carries its zero-based
+// position among them, as in "moov/trak[1]/mdia/minf/stbl/stsz".
+type ParseError struct {
+	Path   string  // box path, e.g. "moov/trak[1]/mdia/minf/stbl/stsz"
+	Offset int64   // byte offset of the box start
+	Type   BoxType // type of the offending box
+	Err    error   // underlying cause
+}
+
+func (e *ParseError) Error() string {
+	return e.Path + " at offset " + strconv.FormatInt(e.Offset, 10) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying cause.
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// JoinPath appends a box path element to parent. index is the box's position
+// among siblings of the same type, or -1 to omit it.
+func JoinPath(parent string, t BoxType, index int) string {
+	elem := t.String()
+	if index >= 0 {
+		elem += "[" + strconv.Itoa(index) + "]"
+	}
+	if parent == "" {
+		return elem
+	}
+	return parent + "/" + elem
+}
@@ -98,6 +98,21 @@ func (s *InitSegment) AudioTrack() *track.Track {
 	return nil
 }
 
+// SetRotation sets the display rotation of the video track to degrees
+// clockwise, mirrored horizontally first if flip is set, and rebuilds the
+// serialized init segment into a new buffer, leaving slices returned by
+// earlier Bytes calls unchanged. It returns [ErrNoVideoTrack] if there is no
+// video track.
+func (s *InitSegment) SetRotation(degrees int, flip bool) error {
+	vt := s.VideoTrack()
+	if vt == nil {
+		return ErrNoVideoTrack
+	}
+	vt.Matrix = mp4.RotationMatrix(degrees, flip)
+	s.buf = buildInitSegment(make([]byte, 0, len(s.buf)), s.Tracks, s.Duration)
+	return nil
+}
+
 // Bytes returns the serialized init segment (ftyp+moov).
 func (s *InitSegment) Bytes() []byte {
 	return s.buf
@@ -107,9 +122,43 @@ func (s *InitSegment) Bytes() []byte {
 //
 // Returned by [Reader.ReadFragment]; valid until the next ReadFragment call.
 // Copy Samples if you need to retain the data.
+//
+// A Fragment built by hand rather than read has no link to its source tracks,
+// so [Writer.WriteFragment] writes no subsample information for it and derives
+// each sample's dependency flags from its sync flag alone, ignoring sdtp.
 type Fragment struct {
 	Samples     []track.Sample
 	SequenceNum uint32
+
+	// Where each track's samples start in their source track, so the writer
+	// can copy per-sample data such as subsample and sdtp dependency
+	// information. Only ReadFragment sets them.
+	sources     [maxTracks]sampleSource
+	sourceCount int
+}
+
+// sampleSource locates a track's run of fragment samples in the track.
+type sampleSource struct {
+	track *track.Track
+	start int
+}
+
+// addSource records that the fragment's samples of t start at sample start.
+func (fr *Fragment) addSource(t *track.Track, start int) {
+	if fr.sourceCount < maxTracks {
+		fr.sources[fr.sourceCount] = sampleSource{t, start}
+		fr.sourceCount++
+	}
+}
+
+// source returns the source of the samples of the track with the given ID.
+func (fr *Fragment) source(trackID uint32) (sampleSource, bool) {
+	for _, s := range fr.sources[:fr.sourceCount] {
+		if s.track.ID == trackID {
+			return s, true
+		}
+	}
+	return sampleSource{}, false
 }
 
 // Reader reads a standard MP4 file and produces fragmented MP4 segments.
@@ -146,7 +195,8 @@ type Reader struct {
 // NewReader creates a new fragment reader. It parses the moov box from
 // the provided reader and builds the init segment for fragmented MP4 output.
 // The returned [InitSegment] contains the serialized ftyp+moov and the parsed
-// track information.
+// track information. A malformed moov is reported as a [*mp4.ParseError]
+// carrying absolute file offsets.
 func NewReader(rs io.ReadSeeker) (*Reader, *InitSegment, error) {
 	f := &Reader{rs: rs, targetDuration: minFragmentDuration}
 	initSeg, err := f.readInit()
@@ -156,6 +206,21 @@ func NewReader(rs io.ReadSeeker) (*Reader, *InitSegment, error) {
 	return f, initSeg, nil
 }
 
+// NewMoovReader creates a fragment reader from a moov box that is already in
+// memory, such as one read by [mp4.StreamScanner] from a non-seekable stream.
+// moov must hold the complete box including its header, and must not be
+// modified while the reader is in use. Sample data is not read by the Reader,
+// so fragments can be produced from metadata alone. Box errors carry offsets
+// relative to moov.
+func NewMoovReader(moov []byte) (*Reader, *InitSegment, error) {
+	f := &Reader{targetDuration: minFragmentDuration}
+	initSeg, err := f.initFromMoov(moov, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, initSeg, nil
+}
+
 // Reset reinitializes the Reader to read from rs, keeping the moov, init, and
 // sample-window buffers allocated for a previous file. It parses the moov box
 // and returns a fresh init segment, like NewReader. The InitSegment and
@@ -211,13 +276,22 @@ func (f *Reader) readInit() (*InitSegment, error) {
 		return f.initSeg, nil
 	}
 
-	moovBuf, err := f.findMoov()
+	moovBuf, moovOffset, err := f.findMoov()
 	if err != nil {
 		return nil, err
 	}
+	return f.initFromMoov(moovBuf, moovOffset)
+}
 
+// initFromMoov parses a loaded moov box found at moovOffset in the file and
+// builds the init segment.
+func (f *Reader) initFromMoov(moovBuf []byte, moovOffset int64) (*InitSegment, error) {
 	tracks, duration, err := track.ParseTracksInto(f.allTracks, moovBuf)
 	if err != nil {
+		// Box offsets are relative to the moov buffer; make them absolute.
+		if pe, ok := errors.AsType[*mp4.ParseError](err); ok {
+			pe.Offset += moovOffset
+		}
 		return nil, err
 	}
 	f.allTracks = tracks
@@ -241,7 +315,9 @@ func (f *Reader) readInit() (*InitSegment, error) {
 	initSeg := &f.initSegStorage
 	initSeg.Tracks = f.filtered
 	initSeg.Duration = duration
-	initSeg.buf = f.buildInitSegment(initSeg.Tracks, initSeg.Duration)
+	initSeg.buf = buildInitSegment(f.initBuf, initSeg.Tracks, initSeg.Duration)
+	// Keep the grown buffer for the next file.
+	f.initBuf = initSeg.buf
 
 	f.initSeg = initSeg
 	f.trackCount = len(initSeg.Tracks)
@@ -440,11 +516,14 @@ func (f *Reader) ReadFragment() (*Fragment, error) {
 	}
 	f.fragSamples = f.fragSamples[:0]
 
+	f.frag.sourceCount = 0
+
 	// Append video samples
 	for i := videoSampleIdx; i < lastVideoIdx; i++ {
 		f.appendSample(videoTrackIdx, videoTrack.Samples[i])
 	}
 	f.trackIdx[videoTrackIdx] = lastVideoIdx
+	f.frag.addSource(videoTrack, videoSampleIdx)
 
 	for i, t := range f.initSeg.Tracks {
 		if t.Kind == track.TrackVideo {
@@ -455,6 +534,9 @@ func (f *Reader) ReadFragment() (*Fragment, error) {
 			f.appendSample(i, t.Samples[j])
 		}
 		f.trackIdx[i] = audioEnd[i]
+		if audioEnd[i] > audioStart[i] {
+			f.frag.addSource(t, audioStart[i])
+		}
 	}
 
 	f.frag.Samples = f.fragSamples
@@ -487,12 +569,12 @@ func (f *Reader) Seek(timeSeconds float64) error {
 	return nil
 }
 
-// findMoov scans for the moov box and returns its raw bytes.
-func (f *Reader) findMoov() ([]byte, error) {
+// findMoov scans for the moov box and returns its raw bytes and file offset.
+func (f *Reader) findMoov() ([]byte, int64, error) {
 	maxSize := int64(DefaultMaxMoovSize)
 
 	if _, err := f.rs.Seek(0, io.SeekStart); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	f.sc.Reset(f.rs)
@@ -501,11 +583,8 @@ func (f *Reader) findMoov() ([]byte, error) {
 		if e.Type != mp4.TypeMoov {
 			continue
 		}
-		if e.Size > maxSize {
-			return nil, ErrMoovTooLarge
-		}
-		if e.Size > int64(^uint(0)>>1) {
-			return nil, ErrMoovTooLarge
+		if e.Size > maxSize || e.Size > int64(^uint(0)>>1) {
+			return nil, 0, &mp4.ParseError{Path: e.Type.String(), Offset: e.Offset, Type: e.Type, Err: ErrMoovTooLarge}
 		}
 		needed := int(e.Size)
 		if cap(f.moovBuf) < needed {
@@ -513,29 +592,21 @@ func (f *Reader) findMoov() ([]byte, error) {
 		}
 		buf := f.moovBuf[:needed]
 		if err := f.sc.ReadBox(buf); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-		return buf, nil
+		return buf, e.Offset, nil
 	}
 
 	if err := f.sc.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return nil, ErrNoMoov
+	return nil, 0, ErrNoMoov
 }
 
-// buildInitSegment constructs ftyp+moov for fragmented MP4.
-func (f *Reader) buildInitSegment(tracks []*track.Track, duration uint64) []byte {
-	estSize := 256
-	for _, track := range tracks {
-		estSize += 256 + len(track.HdlrRaw()) + len(track.DinfRaw()) + len(track.StsdRaw()) + len(track.TkhdRaw()) + len(track.MdhdRaw())
-	}
-
-	if cap(f.initBuf) < estSize {
-		f.initBuf = make([]byte, estSize)
-	}
-	buf := f.initBuf[:estSize]
-	w := mp4.NewWriter(buf)
+// buildInitSegment constructs ftyp+moov for fragmented MP4 in buf, growing
+// it if needed.
+func buildInitSegment(buf []byte, tracks []*track.Track, duration uint64) []byte {
+	w := mp4.NewGrowWriter(buf)
 
 	w.WriteFtyp([4]byte{'i', 's', 'o', '5'}, 0,
 		[][4]byte{{'i', 's', 'o', '5'}, {'a', 'v', 'c', '1'}})
@@ -585,6 +656,9 @@ func writeInitTrak(w *mp4.Writer, track *track.Track) {
 			if track.HdlrRaw() != nil {
 				w.Write(track.HdlrRaw())
 			}
+			if track.ExtendedLanguage != "" {
+				w.WriteElng(track.ExtendedLanguage)
+			}
 
 			w.StartBox(mp4.TypeMinf)
 			{
@@ -622,35 +696,21 @@ func writeInitTrak(w *mp4.Writer, track *track.Track) {
 }
 
 func writeTkhdZeroDuration(w *mp4.Writer, track *track.Track) {
-	data := track.TkhdRaw()
-	if data == nil {
+	var h mp4.Tkhd
+	if h.Decode(track.TkhdRaw(), track.TkhdVersion(), track.TkhdFlags()) != nil {
 		return
 	}
-	w.StartFullBox(mp4.TypeTkhd, track.TkhdVersion(), track.TkhdFlags())
-	start := w.Len()
-	w.Write(data)
-	out := w.Bytes()[start : start+len(data)]
-	if track.TkhdVersion() == 1 {
-		clear(out[24:32])
-	} else {
-		clear(out[16:20])
-	}
-	w.EndBox()
+	h.Duration = 0
+	h.AlternateGroup = track.AlternateGroup
+	h.Matrix = track.Matrix
+	h.Encode(w)
 }
 
 func writeMdhdZeroDuration(w *mp4.Writer, track *track.Track) {
-	data := track.MdhdRaw()
-	if data == nil {
+	var h mp4.Mdhd
+	if h.Decode(track.MdhdRaw(), track.MdhdVersion(), 0) != nil {
 		return
 	}
-	w.StartFullBox(mp4.TypeMdhd, track.MdhdVersion(), 0)
-	start := w.Len()
-	w.Write(data)
-	out := w.Bytes()[start : start+len(data)]
-	if track.MdhdVersion() == 1 {
-		clear(out[20:28])
-	} else {
-		clear(out[12:16])
-	}
-	w.EndBox()
+	h.Duration = 0
+	h.Encode(w)
 }
@@ -1,6 +1,7 @@
 package fragment_test
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"reflect"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/tetsuo/mp4"
 	"github.com/tetsuo/mp4/fragment"
+	"github.com/tetsuo/mp4/track"
 )
 
 const testFile = "../video-media-samples/big-buck-bunny-480p-30sec.mp4"
@@ -318,3 +320,214 @@ func verifyOutputBoxes(t *testing.T, f *os.File) {
 
 	t.Logf("output: ftyp=%v moov=%v moof=%d mdat=%d", hasFtyp, hasMoov, moofCount, mdatCount)
 }
+
+func TestSetRotation(t *testing.T) {
+	f := openTestFile(t)
+	defer f.Close()
+
+	_, initSeg, err := fragment.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deg, flipped := initSeg.VideoTrack().Rotation(); deg != 0 || flipped {
+		t.Fatalf("source rotation = %d, %v, want 0, false", deg, flipped)
+	}
+	before := initSeg.Bytes()
+	saved := bytes.Clone(before)
+	if err := initSeg.SetRotation(270, true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, saved) {
+		t.Error("SetRotation changed the bytes of an earlier Bytes call")
+	}
+
+	r := mp4.NewReader(initSeg.Bytes())
+	for r.Next() && r.Type() != mp4.TypeMoov {
+	}
+	tracks, _, err := track.ParseTracks(r.RawBox())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vt := track.FindTrack(tracks, initSeg.VideoTrack().ID)
+	if deg, flipped := vt.Rotation(); deg != 270 || !flipped {
+		t.Errorf("rotation after SetRotation = %d, %v, want 270, true", deg, flipped)
+	}
+}
+
+// buildVideoMoov writes a moov with one video track of three 10-byte samples,
+// the first of them a sync sample, followed in its stbl by the boxes extra
+// writes.
+func buildVideoMoov(extra func(w *mp4.Writer)) []byte {
+	w := mp4.NewGrowWriter(nil)
+	w.StartBox(mp4.TypeMoov)
+	w.WriteMvhd(30, 3, 2)
+	w.StartBox(mp4.TypeTrak)
+	w.WriteTkhd(3, 1, 3, 64<<16, 64<<16)
+	w.StartBox(mp4.TypeMdia)
+	w.WriteMdhd(30, 3, "und")
+	w.WriteHdlr([4]byte{'v', 'i', 'd', 'e'}, "")
+	w.StartBox(mp4.TypeMinf)
+	w.StartBox(mp4.TypeStbl)
+	w.StartFullBox(mp4.TypeStsd, 0, 0)
+	w.Write([]byte{0, 0, 0, 1})
+	w.StartBox(mp4.TypeAvc1)
+	w.WriteVisualSampleEntry(1, 64, 64, 1, 24, "")
+	w.EndBox() // avc1
+	w.EndBox() // stsd
+	w.WriteStts([]mp4.SttsEntry{{Count: 3, Duration: 1}})
+	w.WriteStsc([]mp4.StscEntry{{FirstChunk: 1, SamplesPerChunk: 3, SampleDescriptionId: 1}})
+	w.WriteStsz(10, make([]uint32, 3))
+	w.WriteStco([]uint32{0})
+	w.WriteStss([]uint32{1})
+	extra(&w)
+	w.EndBox() // stbl
+	w.EndBox() // minf
+	w.EndBox() // mdia
+	w.EndBox() // trak
+	w.EndBox() // moov
+	return w.Bytes()
+}
+
+// prepareMoof prepares frag and returns the moof it builds.
+func prepareMoof(t *testing.T, frag *fragment.Fragment) []byte {
+	t.Helper()
+	fw := fragment.NewWriter(io.Discard)
+	if err := fw.Prepare(frag); err != nil {
+		t.Fatal(err)
+	}
+	var moof bytes.Buffer
+	const mdatSize = 8 + 3*10
+	if err := fw.WriteBodyRange(&moof, nil, 0, fw.BodySize()-mdatSize); err != nil {
+		t.Fatal(err)
+	}
+	return moof.Bytes()
+}
+
+// eachTrafChild calls fn with a reader positioned on each box of type bt
+// inside a traf of moof.
+func eachTrafChild(moof []byte, bt mp4.BoxType, fn func(r *mp4.Reader)) {
+	r := mp4.NewReader(moof)
+	r.Next()
+	r.Enter() // moof
+	for r.Next() {
+		if r.Type() != mp4.TypeTraf {
+			continue
+		}
+		r.Enter()
+		for r.Next() {
+			if r.Type() == bt {
+				fn(&r)
+			}
+		}
+		r.Exit()
+	}
+	r.Exit()
+}
+
+func TestWriteFragmentSampleFlags(t *testing.T) {
+	moov := buildVideoMoov(func(w *mp4.Writer) {
+		w.WriteSdtp([]mp4.SampleDependency{0x24, 0x14, 0x18}) // I, P, disposable B
+	})
+	r, _, err := fragment.NewMoovReader(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frag, err := r.ReadFragment()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moof := prepareMoof(t, frag)
+	var flags []uint32
+	eachTrafChild(moof, mp4.TypeTrun, func(r *mp4.Reader) {
+		it := mp4.NewTrunIter(r.Data(), r.Flags())
+		for e, ok := it.Next(); ok; e, ok = it.Next() {
+			flags = append(flags, e.Flags)
+		}
+	})
+	want := []uint32{0x02400000, 0x01410000, 0x01810000}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("trun sample flags = %#x, want %#x", flags, want)
+	}
+}
+
+func TestWriteFragmentSubs(t *testing.T) {
+	subsamples := []mp4.Subsample{{Size: 4}, {Size: 6, Discardable: 1}}
+	moov := buildVideoMoov(func(w *mp4.Writer) {
+		w.WriteSubs(0, []mp4.SubsEntry{{SampleDelta: 2, Subsamples: subsamples}})
+	})
+	r, _, err := fragment.NewMoovReader(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frag, err := r.ReadFragment()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []mp4.SubsEntry
+	eachTrafChild(prepareMoof(t, frag), mp4.TypeSubs, func(r *mp4.Reader) {
+		it := mp4.NewSubsIter(r.Data(), r.Version())
+		for e, ok := it.Next(nil); ok; e, ok = it.Next(nil) {
+			got = append(got, e)
+		}
+	})
+	want := []mp4.SubsEntry{{SampleDelta: 2, Subsamples: subsamples}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("traf subs entries = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteFragmentEvents(t *testing.T) {
+	r, initSeg, err := fragment.NewMoovReader(buildVideoMoov(func(*mp4.Writer) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	w := fragment.NewWriter(&out)
+	if err := w.WriteInit(initSeg); err != nil {
+		t.Fatal(err)
+	}
+	now := mp4.Emsg{SchemeIDURI: "urn:test", Value: "0", MessageData: []byte("now")}
+	soon := mp4.Emsg{FullHeader: mp4.FullHeader{Version: 1}, SchemeIDURI: "urn:test", Value: "1", Timescale: 1000, PresentationTime: 50}
+	later := mp4.Emsg{FullHeader: mp4.FullHeader{Version: 1}, SchemeIDURI: "urn:test", Value: "2", Timescale: 1000, PresentationTime: 100}
+	w.AddEvent(later)
+	w.AddEvent(now)
+	w.AddEvent(soon)
+
+	// The fragment covers the track's three 1/30 s samples: [0, 100) ms.
+	frag, err := r.ReadFragment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Prepare(frag); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteBodyRange(&out, bytes.NewReader(make([]byte, 30)), 0, w.BodySize()); err != nil {
+		t.Fatal(err)
+	}
+
+	body := mp4.NewReader(out.Bytes()[len(initSeg.Bytes()):])
+	var values []string
+	for body.Next() && body.Type() == mp4.TypeEmsg {
+		e, err := mp4.ReadEmsg(body.Data(), body.Version())
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, e.Value)
+	}
+	if body.Type() != mp4.TypeMoof {
+		t.Fatalf("box after the events is %s, want moof", body.Type())
+	}
+	if want := []string{"0", "1"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("events before the moof = %v, want %v", values, want)
+	}
+
+	// The trun data offset counts from the moof, not from the events.
+	eachTrafChild(body.RawBox(), mp4.TypeTrun, func(r *mp4.Reader) {
+		it := mp4.NewTrunIter(r.Data(), r.Flags())
+		if want := int32(body.Size()) + 8; it.DataOffset() != want {
+			t.Errorf("trun data offset = %d, want %d", it.DataOffset(), want)
+		}
+	})
+}
@@ -3,8 +3,11 @@ package fragment
 import (
 	"encoding/binary"
 	"io"
+	"math"
+	"math/bits"
 
 	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/track"
 )
 
 // Writer writes fragmented MP4 segments.
@@ -15,7 +18,8 @@ type Writer struct {
 	mdatHdr [8]byte      // mdat box header (size + 'mdat'), reused per fragment
 
 	// State carried from Prepare to the body writers. moof points into buf and
-	// holds the finished moof bytes; mdatPayload is the sum of the sample sizes,
+	// holds the finished moof bytes, preceded by any event messages due with
+	// the fragment; mdatPayload is the sum of the sample sizes,
 	// so the body size is known before any media byte is read.
 	moof        []byte
 	mdatPayload int64
@@ -23,7 +27,18 @@ type Writer struct {
 	// Per-track scratch buffers.
 	sampleIdx [maxTracks][]int
 	trunBuf   [maxTracks][]mp4.TrunEntry
+	subsBuf   []mp4.SubsEntry
 	ranges    []byteRange
+
+	// Event messages waiting for the fragment that covers them, and the
+	// track timescales from the init segment to place them by.
+	events     []mp4.Emsg
+	timescales [maxTracks]trackTimescale
+}
+
+type trackTimescale struct {
+	id        uint32
+	timescale uint32
 }
 
 type byteRange struct {
@@ -47,17 +62,34 @@ func NewWriter(w io.Writer) *Writer {
 	return wr
 }
 
-// Reset prepares the [Writer] for reuse with a new [io.Writer].
+// Reset prepares the [Writer] for reuse with a new [io.Writer]. Events not
+// yet written are dropped.
 func (w *Writer) Reset(dst io.Writer) {
 	w.w = dst
+	w.events = w.events[:0]
+	w.timescales = [maxTracks]trackTimescale{}
 }
 
 // WriteInit writes the init segment (ftyp+moov).
 func (w *Writer) WriteInit(s *InitSegment) error {
+	w.timescales = [maxTracks]trackTimescale{}
+	for i, t := range s.Tracks[:min(len(s.Tracks), maxTracks)] {
+		w.timescales[i] = trackTimescale{t.ID, t.TimeScale}
+	}
 	_, err := w.w.Write(s.buf)
 	return err
 }
 
+// AddEvent queues an event message to be written ahead of the moof of a later
+// fragment. A version 1 event goes before the first fragment whose decode
+// time range reaches its PresentationTime, or before the next one if that
+// time has passed. A version 0 event, whose time is relative to the fragment
+// it arrives with, goes before the next fragment. The message data is not
+// copied and must not change until the event is written.
+func (w *Writer) AddEvent(e mp4.Emsg) {
+	w.events = append(w.events, e)
+}
+
 // WriteFragment writes a single moof+mdat fragment.
 // src is used to read sample data at the offsets specified in fragment samples.
 func (w *Writer) WriteFragment(frag *Fragment, src io.ReaderAt) error {
@@ -70,6 +102,7 @@ func (w *Writer) WriteFragment(frag *Fragment, src io.ReaderAt) error {
 // BodySize returns the byte size of the body (moof + mdat) of the fragment last
 // passed to [Writer.Prepare]. It is moofSize + 8 + sum(sample sizes), all known
 // from sample metadata, so the size is available before any media is read.
+// moofSize includes the emsg boxes of events written ahead of the moof.
 func (w *Writer) BodySize() int64 {
 	return int64(len(w.moof)) + 8 + w.mdatPayload
 }
@@ -77,7 +110,9 @@ func (w *Writer) BodySize() int64 {
 // Prepare builds the moof for frag from sample metadata alone, reading no media.
 // It records the moof bytes and the mdat payload size so [Writer.BodySize] and
 // [Writer.WriteBodyRange] can write the body, or a byte window of it, afterward.
-// The recorded state is valid until the next call to Prepare on this writer.
+// Queued events due with the fragment are written ahead of the moof and leave
+// the queue. The recorded state is valid until the next call to Prepare on
+// this writer.
 func (w *Writer) Prepare(frag *Fragment) error {
 	// Group samples by track
 	var trackIDs [maxTracks]uint32
@@ -150,12 +185,17 @@ func (w *Writer) Prepare(frag *Fragment) error {
 			ti.baseDTS = frag.Samples[indices[0]].DTS
 		}
 
-		for _, idx := range indices {
+		src, hasSrc := frag.source(ti.trackID)
+		for k, idx := range indices {
 			s := &frag.Samples[idx]
+			var deps mp4.SampleDependency
+			if hasSrc {
+				deps = src.track.Dependency(src.start + k)
+			}
 			entry := mp4.TrunEntry{
 				Duration: s.Duration,
 				Size:     s.Size(),
-				Flags:    sampleFlags(s.IsSync()),
+				Flags:    sampleFlags(s, deps),
 			}
 			if s.PresentationOffset != 0 {
 				entry.CompositionTimeOffset = s.PresentationOffset
@@ -183,8 +223,12 @@ func (w *Writer) Prepare(frag *Fragment) error {
 	var patches [maxTracks]trunPatch
 	patchCount := 0
 
-	mw := mp4.NewWriter(w.buf)
-	mw.Reset()
+	mw := mp4.NewGrowWriter(w.buf)
+
+	if len(w.events) > 0 && groupCount > 0 {
+		w.writeEvents(&mw, frag, trackIDs[0], trafs[0].baseDTS, w.trunBuf[0])
+	}
+	moofStart := mw.Len()
 
 	mw.StartBox(mp4.TypeMoof)
 	mw.WriteMfhd(frag.SequenceNum)
@@ -255,13 +299,17 @@ func (w *Writer) Prepare(frag *Fragment) error {
 			patchCount++
 		}
 		mw.WriteTrun(trunFlags, 0, firstSampleFlags, entries)
+		w.writeSubs(&mw, frag, ti.trackID, len(entries))
 
 		mw.EndBox() // traf
 	}
 
 	mw.EndBox() // moof
+	if err := mw.Err(); err != nil {
+		return err
+	}
 
-	moofSize := int32(mw.Len())
+	moofSize := int32(mw.Len() - moofStart)
 
 	// Backpatch data_offset fields
 	moofBytes := mw.Bytes()
@@ -272,16 +320,90 @@ func (w *Writer) Prepare(frag *Fragment) error {
 	}
 
 	w.moof = moofBytes
+	w.buf = moofBytes[:cap(moofBytes)] // keep the buffer if it grew
 	w.mdatPayload = mdatPayload
 	return nil
 }
 
+// writeEvents writes the queued events that are due by the end of the
+// fragment and drops them from the queue. The fragment's time range is that of
+// its first track, whose samples start at baseDTS.
+func (w *Writer) writeEvents(mw *mp4.Writer, frag *Fragment, trackID uint32, baseDTS int64, entries []mp4.TrunEntry) {
+	timescale := w.timescale(frag, trackID)
+	end := uint64(max(baseDTS, 0))
+	for _, e := range entries {
+		end += uint64(e.Duration)
+	}
+	kept := w.events[:0]
+	for i := range w.events {
+		e := &w.events[i]
+		if e.Version != 0 && timescale != 0 && e.Timescale != 0 &&
+			rescale(e.PresentationTime, e.Timescale, timescale) >= end {
+			kept = append(kept, *e)
+			continue
+		}
+		e.Encode(mw)
+	}
+	clear(w.events[len(kept):])
+	w.events = kept
+}
+
+// timescale returns the timescale of the track with the given ID, taken from
+// the fragment's source tracks or the init segment, or 0 if unknown.
+func (w *Writer) timescale(frag *Fragment, trackID uint32) uint32 {
+	if src, ok := frag.source(trackID); ok {
+		return src.track.TimeScale
+	}
+	for _, t := range w.timescales {
+		if t.id == trackID {
+			return t.timescale
+		}
+	}
+	return 0
+}
+
+// rescale converts v from timescale from to timescale to, saturating on
+// overflow.
+func rescale(v uint64, from, to uint32) uint64 {
+	hi, lo := bits.Mul64(v, uint64(to))
+	if hi >= uint64(from) {
+		return math.MaxUint64
+	}
+	q, _ := bits.Div64(hi, lo, uint64(from))
+	return q
+}
+
+// writeSubs writes a subs box for the n samples of the given track in frag if
+// their source track has subsample information.
+func (w *Writer) writeSubs(mw *mp4.Writer, frag *Fragment, trackID uint32, n int) {
+	src, ok := frag.source(trackID)
+	if !ok {
+		return
+	}
+	flags, ok := src.track.SubsFlags()
+	if !ok {
+		return
+	}
+	w.subsBuf = w.subsBuf[:0]
+	last := 0
+	for k := range n {
+		if ss := src.track.Subsamples(src.start + k); ss != nil {
+			w.subsBuf = append(w.subsBuf, mp4.SubsEntry{SampleDelta: uint32(k + 1 - last), Subsamples: ss})
+			last = k + 1
+		}
+	}
+	if len(w.subsBuf) > 0 {
+		mw.WriteSubs(flags, w.subsBuf)
+	}
+}
+
 // WriteBodyRange writes the body bytes in [start, end) to dst, reading sample
 // bytes from src only for the portion of the window that overlaps the sample
-// data. Offsets are relative to the start of the body: the moof occupies
-// [0, moofSize), the 8-byte mdat header [moofSize, moofSize+8), and the sample
-// data the remainder up to [Writer.BodySize]. It must be called after
-// [Writer.Prepare]. start and end must satisfy 0 <= start <= end <= BodySize.
+// data. Offsets are relative to the start of the body: the moof, with any
+// event messages ahead of it, occupies [0, moofSize), the 8-byte mdat header
+// [moofSize, moofSize+8), and the sample data the remainder up to
+// [Writer.BodySize]. It must be called after [Writer.Prepare]. start and end
+// must satisfy 0 <= start <= end <= BodySize.
 func (w *Writer) WriteBodyRange(dst io.Writer, src io.ReaderAt, start, end int64) error {
 	moofSize := int64(len(w.moof))
 
@@ -354,9 +476,20 @@ func (w *Writer) writeDataRange(dst io.Writer, src io.ReaderAt, lo, hi int64) er
 	return nil
 }
 
-func sampleFlags(isSync bool) uint32 {
-	if isSync {
-		return 0x02000000
+// sampleFlags returns the trun sample_flags of s. The dependency bits come
+// from deps, read from the source's sdtp; sample_depends_on falls back to the
+// sync flag when the source leaves it unknown.
+func sampleFlags(s *track.Sample, deps mp4.SampleDependency) uint32 {
+	flags := uint32(deps) << 20
+	if deps.DependsOn() == 0 {
+		if s.IsSync() {
+			flags |= 2 << 24 // does not depend on others
+		} else {
+			flags |= 1 << 24 // depends on others
+		}
+	}
+	if !s.IsSync() {
+		flags |= 0x00010000 // sample_is_non_sync_sample
 	}
-	return 0x01010000
+	return flags
 }
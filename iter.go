@@ -2,6 +2,7 @@ package mp4
 
 import (
 	"encoding/binary"
+	"iter"
 	"math"
 )
 
@@ -51,6 +52,133 @@ func (it *StszIter) Next() (uint32, bool) {
 	return size, true
 }
 
+// Read decodes up to len(dst) of the remaining sample sizes into dst and
+// returns how many it decoded, 0 once done. It is the bulk form of Next.
+func (it *StszIter) Read(dst []uint32) int {
+	n := remaining(len(dst), it.count, it.index)
+	if it.sampleSize != 0 {
+		dst = dst[:n]
+		for i := range dst {
+			dst[i] = it.sampleSize
+		}
+	} else {
+		n = readUint32s(dst[:n], it.buf[min(8+int(it.index)*4, len(it.buf)):])
+	}
+	it.index += uint32(n)
+	return n
+}
+
+// All returns a sequence over the remaining sample sizes, keyed by sample
+// index. It ranges over a copy, so it does not advance the iterator.
+func (it *StszIter) All() iter.Seq2[int, uint32] {
+	return all(it, &it.index, (*StszIter).Next)
+}
+
+// Stz2Iter iterates over sample sizes in an stz2 (compact sample size) box.
+type Stz2Iter struct {
+	buf       []byte
+	fieldSize uint8
+	count     uint32
+	index     uint32
+}
+
+// NewStz2Iter creates an iterator from stz2 box data. It returns an empty
+// iterator if the field size is not 4, 8 or 16.
+func NewStz2Iter(data []byte) Stz2Iter {
+	if len(data) < 8 {
+		return Stz2Iter{}
+	}
+	fieldSize := data[3]
+	if fieldSize != 4 && fieldSize != 8 && fieldSize != 16 {
+		return Stz2Iter{}
+	}
+	return Stz2Iter{
+		buf:       data,
+		fieldSize: fieldSize,
+		count:     be.Uint32(data[4:8]),
+	}
+}
+
+// FieldSize returns the size of each entry in bits: 4, 8 or 16.
+func (it *Stz2Iter) FieldSize() uint8 { return it.fieldSize }
+
+// Count returns the total number of samples.
+func (it *Stz2Iter) Count() uint32 { return it.count }
+
+// Next returns the next sample size. Returns (0, false) when done.
+func (it *Stz2Iter) Next() (uint32, bool) {
+	if it.index >= it.count {
+		return 0, false
+	}
+	var size uint32
+	switch it.fieldSize {
+	case 4:
+		offset := 8 + int(it.index/2)
+		if offset >= len(it.buf) {
+			return 0, false
+		}
+		v := it.buf[offset]
+		if it.index%2 == 0 {
+			v >>= 4
+		}
+		size = uint32(v & 0x0f)
+	case 8:
+		offset := 8 + int(it.index)
+		if offset >= len(it.buf) {
+			return 0, false
+		}
+		size = uint32(it.buf[offset])
+	default:
+		offset := 8 + int(it.index)*2
+		if offset+2 > len(it.buf) {
+			return 0, false
+		}
+		size = uint32(be.Uint16(it.buf[offset:]))
+	}
+	it.index++
+	return size, true
+}
+
+// Read decodes up to len(dst) of the remaining sample sizes into dst and
+// returns how many it decoded, 0 once done. It is the bulk form of Next.
+func (it *Stz2Iter) Read(dst []uint32) int {
+	n := remaining(len(dst), it.count, it.index)
+	switch it.fieldSize {
+	case 4:
+		src := it.buf[8+int(it.index/2):]
+		n = min(n, 2*len(src)-int(it.index%2))
+		for i := range dst[:n] {
+			j := int(it.index%2) + i
+			v := src[j/2]
+			if j%2 == 0 {
+				v >>= 4
+			}
+			dst[i] = uint32(v & 0x0f)
+		}
+	case 8:
+		src := it.buf[8+int(it.index):]
+		n = min(n, len(src))
+		for i, v := range src[:n] {
+			dst[i] = uint32(v)
+		}
+	case 16:
+		src := it.buf[8+int(it.index)*2:]
+		n = min(n, len(src)/2)
+		dst = dst[:n]
+		for i := range dst {
+			dst[i] = uint32(be.Uint16(src[2*i:]))
+		}
+	}
+	it.index += uint32(n)
+	return n
+}
+
+// All returns a sequence over the remaining sample sizes, keyed by sample
+// index. It ranges over a copy, so it does not advance the iterator.
+func (it *Stz2Iter) All() iter.Seq2[int, uint32] {
+	return all(it, &it.index, (*Stz2Iter).Next)
+}
+
 // Co64Iter iterates over uint64 chunk offsets in a co64 box.
 type Co64Iter struct {
 	buf   []byte
@@ -86,6 +214,26 @@ func (it *Co64Iter) Next() (uint64, bool) {
 	return v, true
 }
 
+// Read decodes up to len(dst) of the remaining chunk offsets into dst and
+// returns how many it decoded, 0 once done. It is the bulk form of Next.
+func (it *Co64Iter) Read(dst []uint64) int {
+	n := remaining(len(dst), it.count, it.index)
+	src := it.buf[min(4+int(it.index)*8, len(it.buf)):]
+	n = min(n, len(src)/8)
+	dst = dst[:n]
+	for i := range dst {
+		dst[i] = be.Uint64(src[8*i:])
+	}
+	it.index += uint32(n)
+	return n
+}
+
+// All returns a sequence over the remaining chunk offsets, keyed by chunk
+// index. It ranges over a copy, so it does not advance the iterator.
+func (it *Co64Iter) All() iter.Seq2[int, uint64] {
+	return all(it, &it.index, (*Co64Iter).Next)
+}
+
 // SttsEntry is a time-to-sample entry.
 type SttsEntry struct {
 	Count    uint32
@@ -130,6 +278,12 @@ func (it *SttsIter) Next() (SttsEntry, bool) {
 	return e, true
 }
 
+// All returns a sequence over the remaining entries, keyed by entry index. It
+// ranges over a copy, so it does not advance the iterator.
+func (it *SttsIter) All() iter.Seq2[int, SttsEntry] {
+	return all(it, &it.index, (*SttsIter).Next)
+}
+
 // CttsEntry is a composition offset entry.
 type CttsEntry struct {
 	Count  uint32
@@ -187,6 +341,12 @@ func (it *CttsIter) Next() (CttsEntry, bool) {
 	return e, true
 }
 
+// All returns a sequence over the remaining entries, keyed by entry index. It
+// ranges over a copy, so it does not advance the iterator.
+func (it *CttsIter) All() iter.Seq2[int, CttsEntry] {
+	return all(it, &it.index, (*CttsIter).Next)
+}
+
 // StscEntry is a sample-to-chunk entry.
 type StscEntry struct {
 	FirstChunk          uint32
@@ -233,6 +393,12 @@ func (it *StscIter) Next() (StscEntry, bool) {
 	return e, true
 }
 
+// All returns a sequence over the remaining entries, keyed by entry index. It
+// ranges over a copy, so it does not advance the iterator.
+func (it *StscIter) All() iter.Seq2[int, StscEntry] {
+	return all(it, &it.index, (*StscIter).Next)
+}
+
 // ElstEntry is an edit list entry.
 type ElstEntry struct {
 	SegmentDuration uint64
@@ -295,6 +461,12 @@ func (it *ElstIter) Next() (ElstEntry, bool) {
 	return e, true
 }
 
+// All returns a sequence over the remaining edits, keyed by entry index. It
+// ranges over a copy, so it does not advance the iterator.
+func (it *ElstIter) All() iter.Seq2[int, ElstEntry] {
+	return all(it, &it.index, (*ElstIter).Next)
+}
+
 // TrunEntry is a track run sample entry.
 type TrunEntry struct {
 	Duration              uint32
@@ -324,6 +496,70 @@ const (
 	TfhdDefaultBaseIsMoof             = 0x020000
 )
 
+// SampleDefaults holds the sample duration, size and flags a trun falls back
+// on when it leaves them out. They come from the tfhd, or from the movie's
+// trex where the tfhd does not set them either.
+type SampleDefaults struct {
+	Duration uint32
+	Size     uint32
+	Flags    uint32
+}
+
+// TfhdInfo holds parsed fields from a tfhd box. Optional fields are zero
+// unless the matching Tfhd flag is set in Flags.
+type TfhdInfo struct {
+	Flags                  uint32
+	TrackID                uint32
+	BaseDataOffset         uint64
+	SampleDescriptionIndex uint32
+	DefaultSampleDuration  uint32
+	DefaultSampleSize      uint32
+	DefaultSampleFlags     uint32
+}
+
+// ReadTfhdInfo parses tfhd box data with the given flags. It returns
+// [ErrShortBox] if data is shorter than the fields the flags call for.
+func ReadTfhdInfo(data []byte, flags uint32) (TfhdInfo, error) {
+	t := TfhdInfo{Flags: flags}
+	d := decoder{data: data}
+	t.TrackID = d.u32()
+	if flags&TfhdBaseDataOffsetPresent != 0 {
+		t.BaseDataOffset = d.u64()
+	}
+	if flags&TfhdSampleDescriptionIndexPresent != 0 {
+		t.SampleDescriptionIndex = d.u32()
+	}
+	if flags&TfhdDefaultSampleDurationPresent != 0 {
+		t.DefaultSampleDuration = d.u32()
+	}
+	if flags&TfhdDefaultSampleSizePresent != 0 {
+		t.DefaultSampleSize = d.u32()
+	}
+	if flags&TfhdDefaultSampleFlagsPresent != 0 {
+		t.DefaultSampleFlags = d.u32()
+	}
+	if d.err != nil {
+		return TfhdInfo{}, d.err
+	}
+	return t, nil
+}
+
+// Defaults returns the sample defaults of the track fragment: the tfhd's own
+// where its flags set them, and trex's otherwise.
+func (t TfhdInfo) Defaults(trex SampleDefaults) SampleDefaults {
+	d := trex
+	if t.Flags&TfhdDefaultSampleDurationPresent != 0 {
+		d.Duration = t.DefaultSampleDuration
+	}
+	if t.Flags&TfhdDefaultSampleSizePresent != 0 {
+		d.Size = t.DefaultSampleSize
+	}
+	if t.Flags&TfhdDefaultSampleFlagsPresent != 0 {
+		d.Flags = t.DefaultSampleFlags
+	}
+	return d
+}
+
 // TrunIter iterates over trun entries.
 type TrunIter struct {
 	buf              []byte
@@ -334,6 +570,7 @@ type TrunIter struct {
 	firstSampleFlags uint32
 	stride           int
 	entriesStart     int
+	defaults         SampleDefaults
 }
 
 // NewTrunIter creates an iterator from trun box data with the given flags.
@@ -387,7 +624,14 @@ func (it *TrunIter) DataOffset() int32 { return it.dataOffset }
 // FirstSampleFlags returns the first sample flags, if present.
 func (it *TrunIter) FirstSampleFlags() uint32 { return it.firstSampleFlags }
 
-// Next returns the next sample entry. Returns false when done.
+// SetDefaults sets the values Next returns for the sample duration, size and
+// flags when the trun leaves them out, usually from [TfhdInfo.Defaults].
+// Without defaults, absent fields are zero.
+func (it *TrunIter) SetDefaults(d SampleDefaults) { it.defaults = d }
+
+// Next returns the next sample entry. Fields the trun leaves out take the
+// defaults set by SetDefaults, except that the first sample takes the first
+// sample flags when they are present. Returns false when done.
 func (it *TrunIter) Next() (TrunEntry, bool) {
 	if it.index >= it.count {
 		return TrunEntry{}, false
@@ -396,7 +640,14 @@ func (it *TrunIter) Next() (TrunEntry, bool) {
 	if offset+it.stride > len(it.buf) {
 		return TrunEntry{}, false
 	}
-	var e TrunEntry
+	e := TrunEntry{
+		Duration: it.defaults.Duration,
+		Size:     it.defaults.Size,
+		Flags:    it.defaults.Flags,
+	}
+	if it.index == 0 && it.flags&TrunFirstSampleFlagsPresent != 0 {
+		e.Flags = it.firstSampleFlags
+	}
 	p := offset
 	if it.flags&TrunSampleDurationPresent != 0 {
 		e.Duration = be.Uint32(it.buf[p:])
@@ -417,6 +668,418 @@ func (it *TrunIter) Next() (TrunEntry, bool) {
 	return e, true
 }
 
+// All returns a sequence over the remaining samples, keyed by sample index
+// within the run. It ranges over a copy, so it does not advance the iterator.
+func (it *TrunIter) All() iter.Seq2[int, TrunEntry] {
+	return all(it, &it.index, (*TrunIter).Next)
+}
+
+// SidxIter iterates over the references of a sidx (segment index) box.
+type SidxIter struct {
+	buf          []byte
+	referenceID  uint32
+	timescale    uint32
+	earliestPTS  uint64
+	firstOffset  uint64
+	count        uint32
+	index        uint32
+	entriesStart int
+}
+
+// NewSidxIter creates an iterator from sidx box data with the given version.
+// Version 1 has 64-bit earliest presentation time and first offset fields.
+func NewSidxIter(data []byte, version uint8) SidxIter {
+	ptr := 8 + 2*versionedSize(version, 4, 8)
+	if len(data) < ptr+4 {
+		return SidxIter{}
+	}
+	it := SidxIter{
+		buf:          data,
+		referenceID:  be.Uint32(data[0:4]),
+		timescale:    be.Uint32(data[4:8]),
+		count:        uint32(be.Uint16(data[ptr+2:])),
+		entriesStart: ptr + 4,
+	}
+	if version == 1 {
+		it.earliestPTS = be.Uint64(data[8:16])
+		it.firstOffset = be.Uint64(data[16:24])
+	} else {
+		it.earliestPTS = uint64(be.Uint32(data[8:12]))
+		it.firstOffset = uint64(be.Uint32(data[12:16]))
+	}
+	return it
+}
+
+// ReferenceID returns the ID of the stream the index describes.
+func (it *SidxIter) ReferenceID() uint32 { return it.referenceID }
+
+// Timescale returns the timescale of the index's times and durations.
+func (it *SidxIter) Timescale() uint32 { return it.timescale }
+
+// EarliestPresentationTime returns the presentation time of the first
+// referenced subsegment.
+func (it *SidxIter) EarliestPresentationTime() uint64 { return it.earliestPTS }
+
+// FirstOffset returns the distance in bytes from the end of the sidx box to
+// the first referenced byte.
+func (it *SidxIter) FirstOffset() uint64 { return it.firstOffset }
+
+// Count returns the total number of references.
+func (it *SidxIter) Count() uint32 { return it.count }
+
+// Next returns the next reference. Returns false when done.
+func (it *SidxIter) Next() (SidxEntry, bool) {
+	if it.index >= it.count {
+		return SidxEntry{}, false
+	}
+	offset := it.entriesStart + int(it.index)*sidxEntrySize
+	if offset+sidxEntrySize > len(it.buf) {
+		return SidxEntry{}, false
+	}
+	it.index++
+	return readSidxEntry(it.buf[offset:]), true
+}
+
+// All returns a sequence over the remaining references, keyed by reference
+// index. It ranges over a copy, so it does not advance the iterator.
+func (it *SidxIter) All() iter.Seq2[int, SidxEntry] {
+	return all(it, &it.index, (*SidxIter).Next)
+}
+
+// SbgpEntry assigns a run of samples to a sample group description. Index 0
+// means the samples belong to no group of this type.
+type SbgpEntry struct {
+	SampleCount           uint32
+	GroupDescriptionIndex uint32
+}
+
+// SbgpIter iterates over sbgp (sample-to-group) entries.
+type SbgpIter struct {
+	buf                   []byte
+	groupingType          [4]byte
+	groupingTypeParameter uint32
+	count                 uint32
+	index                 uint32
+	entriesStart          int
+}
+
+// NewSbgpIter creates an iterator from sbgp box data with the given version.
+// Version 1 adds a grouping type parameter before the entry count.
+func NewSbgpIter(data []byte, version uint8) SbgpIter {
+	ptr := 4
+	if version == 1 {
+		ptr += 4
+	}
+	if len(data) < ptr+4 {
+		return SbgpIter{}
+	}
+	it := SbgpIter{buf: data}
+	copy(it.groupingType[:], data[0:4])
+	if version == 1 {
+		it.groupingTypeParameter = be.Uint32(data[4:8])
+	}
+	it.count = be.Uint32(data[ptr:])
+	it.entriesStart = ptr + 4
+	return it
+}
+
+// GroupingType returns the grouping type, such as "roll" or "seig".
+func (it *SbgpIter) GroupingType() [4]byte { return it.groupingType }
+
+// GroupingTypeParameter returns the grouping type parameter of a version 1
+// box, or 0.
+func (it *SbgpIter) GroupingTypeParameter() uint32 { return it.groupingTypeParameter }
+
+// Count returns the total number of entries.
+func (it *SbgpIter) Count() uint32 { return it.count }
+
+// Next returns the next entry. Returns false when done.
+func (it *SbgpIter) Next() (SbgpEntry, bool) {
+	if it.index >= it.count {
+		return SbgpEntry{}, false
+	}
+	offset := it.entriesStart + int(it.index)*8
+	if offset+8 > len(it.buf) {
+		return SbgpEntry{}, false
+	}
+	e := SbgpEntry{
+		SampleCount:           be.Uint32(it.buf[offset:]),
+		GroupDescriptionIndex: be.Uint32(it.buf[offset+4:]),
+	}
+	it.index++
+	return e, true
+}
+
+// All returns a sequence over the remaining entries, keyed by entry index. It
+// ranges over a copy, so it does not advance the iterator.
+func (it *SbgpIter) All() iter.Seq2[int, SbgpEntry] {
+	return all(it, &it.index, (*SbgpIter).Next)
+}
+
+// SgpdIter iterates over sgpd (sample group description) entries. Each entry
+// is returned undecoded; see [ReadRollEntry] and the other Read*Entry
+// functions for the common grouping types.
+//
+// Only version 1 records entry lengths. For other versions the entries are
+// assumed to share one length, as they do for the common grouping types.
+type SgpdIter struct {
+	buf                           []byte
+	groupingType                  [4]byte
+	defaultLength                 uint32
+	defaultSampleDescriptionIndex uint32
+	count                         uint32
+	index                         uint32
+	entrySize                     int  // fixed entry size, or -1 if unknown
+	prefixed                      bool // each entry has a 32-bit length prefix
+	pos                           int
+}
+
+// NewSgpdIter creates an iterator from sgpd box data with the given version.
+func NewSgpdIter(data []byte, version uint8) SgpdIter {
+	ptr := 4
+	if version >= 1 {
+		ptr += 4
+	}
+	if len(data) < ptr+4 {
+		return SgpdIter{}
+	}
+	it := SgpdIter{buf: data}
+	copy(it.groupingType[:], data[0:4])
+	if version == 1 {
+		it.defaultLength = be.Uint32(data[4:8])
+	}
+	if version >= 2 {
+		it.defaultSampleDescriptionIndex = be.Uint32(data[4:8])
+	}
+	it.count = be.Uint32(data[ptr:])
+	it.pos = ptr + 4
+	it.prefixed = version == 1 && it.defaultLength == 0
+	it.entrySize = sgpdEntrySize(version, it.defaultLength, it.count, len(data)-it.pos)
+	return it
+}
+
+// sgpdEntrySize returns the size of every entry of an sgpd box holding count
+// entries in rest bytes, or -1 if the entries do not share a size that can be
+// determined.
+func sgpdEntrySize(version uint8, defaultLength, count uint32, rest int) int {
+	switch {
+	case version == 1:
+		return int(defaultLength)
+	case count == 0:
+		return 0
+	case rest%int(count) != 0:
+		return -1
+	}
+	return rest / int(count)
+}
+
+// GroupingType returns the grouping type, such as "roll" or "seig".
+func (it *SgpdIter) GroupingType() [4]byte { return it.groupingType }
+
+// DefaultLength returns the entry length of a version 1 box, or 0 when each
+// entry carries its own length.
+func (it *SgpdIter) DefaultLength() uint32 { return it.defaultLength }
+
+// DefaultSampleDescriptionIndex returns the description index, from version
+// 2 on, that applies to samples no sbgp box maps to a group. 0 means none.
+func (it *SgpdIter) DefaultSampleDescriptionIndex() uint32 {
+	return it.defaultSampleDescriptionIndex
+}
+
+// Count returns the total number of entries.
+func (it *SgpdIter) Count() uint32 { return it.count }
+
+// Next returns the next entry. The slice points into the box data. Returns
+// false when done.
+func (it *SgpdIter) Next() ([]byte, bool) {
+	if it.index >= it.count {
+		return nil, false
+	}
+	p, n := it.pos, it.entrySize
+	if it.prefixed {
+		if p+4 > len(it.buf) {
+			return nil, false
+		}
+		n = int(be.Uint32(it.buf[p:]))
+		p += 4
+	}
+	if n < 0 || n > len(it.buf)-p {
+		return nil, false
+	}
+	it.pos = p + n
+	it.index++
+	return it.buf[p:it.pos], true
+}
+
+// All returns a sequence over the remaining group descriptions, keyed by entry
+// index. It ranges over a copy, so it does not advance the iterator.
+func (it *SgpdIter) All() iter.Seq2[int, []byte] {
+	return all(it, &it.index, (*SgpdIter).Next)
+}
+
+// SampleDependency describes how a sample depends on others, packed as in an
+// sdtp entry or in the middle of a trun sample_flags field. Leading, DependsOn,
+// DependedOn and Redundancy return the raw 2-bit fields, where 0 means
+// unknown; the Is methods answer for the common cases.
+type SampleDependency uint8
+
+// Leading returns 1 for a leading sample that depends on samples before the
+// preceding random access point, 2 for a sample that is not leading, and 3 for
+// a leading sample that decodes without them.
+func (d SampleDependency) Leading() uint8 { return uint8(d) >> 6 }
+
+// DependsOn returns 1 if the sample depends on others and 2 if it does not,
+// as an I-frame does.
+func (d SampleDependency) DependsOn() uint8 { return uint8(d) >> 4 & 0x03 }
+
+// DependedOn returns 1 if other samples depend on this one and 2 if none
+// do, making it disposable.
+func (d SampleDependency) DependedOn() uint8 { return uint8(d) >> 2 & 0x03 }
+
+// Redundancy returns 1 if the sample has redundant coding and 2 if not.
+func (d SampleDependency) Redundancy() uint8 { return uint8(d) & 0x03 }
+
+// IsLeadingSample reports whether the sample is a leading sample, one that
+// follows a random access point in decoding order but precedes it in
+// presentation order.
+func (d SampleDependency) IsLeadingSample() bool { return d.Leading()&1 != 0 }
+
+// IsDependent reports whether the sample is known to depend on others.
+func (d SampleDependency) IsDependent() bool { return d.DependsOn() == 1 }
+
+// IsDependedOn reports whether other samples are known to depend on this one.
+func (d SampleDependency) IsDependedOn() bool { return d.DependedOn() == 1 }
+
+// IsDisposable reports whether no other sample depends on this one, so it can
+// be dropped, as when fast-forwarding, without breaking decoding.
+func (d SampleDependency) IsDisposable() bool { return d.DependedOn() == 2 }
+
+// SdtpIter iterates over sdtp entries, one per sample.
+type SdtpIter struct {
+	buf   []byte
+	index uint32
+}
+
+// NewSdtpIter creates an iterator from sdtp box data. The box has no entry
+// count; it holds one entry per sample of the track.
+func NewSdtpIter(data []byte) SdtpIter {
+	return SdtpIter{buf: data}
+}
+
+// Count returns the total number of entries.
+func (it *SdtpIter) Count() uint32 { return uint32(len(it.buf)) }
+
+// Next returns the next entry. Returns (0, false) when done.
+func (it *SdtpIter) Next() (SampleDependency, bool) {
+	if int(it.index) >= len(it.buf) {
+		return 0, false
+	}
+	d := SampleDependency(it.buf[it.index])
+	it.index++
+	return d, true
+}
+
+// All returns a sequence over the remaining entries, keyed by sample index. It
+// ranges over a copy, so it does not advance the iterator.
+func (it *SdtpIter) All() iter.Seq2[int, SampleDependency] {
+	return all(it, &it.index, (*SdtpIter).Next)
+}
+
+// Subsample describes one byte range within a sample.
+type Subsample struct {
+	Size                    uint32 // 16 bits in version 0
+	Priority                uint8
+	Discardable             uint8
+	CodecSpecificParameters uint32
+}
+
+// SubsEntry lists the subsamples of one sample. SampleDelta is the difference
+// between this sample's number and that of the previous entry.
+type SubsEntry struct {
+	SampleDelta uint32
+	Subsamples  []Subsample
+}
+
+// SubsIter iterates over subs (sub-sample information) entries, one per
+// sample that has subsamples.
+type SubsIter struct {
+	buf     []byte
+	version uint8
+	count   uint32
+	index   uint32
+	pos     int
+}
+
+// NewSubsIter creates an iterator from subs box data with the given version.
+// Version 1 has 32-bit subsample sizes.
+func NewSubsIter(data []byte, version uint8) SubsIter {
+	if len(data) < 4 {
+		return SubsIter{}
+	}
+	return SubsIter{
+		buf:     data,
+		version: version,
+		count:   be.Uint32(data[0:4]),
+		pos:     4,
+	}
+}
+
+// Count returns the total number of entries.
+func (it *SubsIter) Count() uint32 { return it.count }
+
+// Next returns the next entry. Its subsamples are appended to dst[:0], so
+// passing the previous entry's Subsamples back in reuses their storage.
+// Returns false when done.
+func (it *SubsIter) Next(dst []Subsample) (SubsEntry, bool) {
+	if it.index >= it.count || it.pos+6 > len(it.buf) {
+		return SubsEntry{}, false
+	}
+	p := it.pos
+	e := SubsEntry{SampleDelta: be.Uint32(it.buf[p:])}
+	n := int(be.Uint16(it.buf[p+4:]))
+	p += 6
+	stride := versionedSize(it.version, 8, 10)
+	if n*stride > len(it.buf)-p {
+		return SubsEntry{}, false
+	}
+	e.Subsamples = dst[:0]
+	for range n {
+		var s Subsample
+		if it.version == 1 {
+			s.Size = be.Uint32(it.buf[p:])
+		} else {
+			s.Size = uint32(be.Uint16(it.buf[p:]))
+		}
+		q := p + stride - 6
+		s.Priority = it.buf[q]
+		s.Discardable = it.buf[q+1]
+		s.CodecSpecificParameters = be.Uint32(it.buf[q+2:])
+		e.Subsamples = append(e.Subsamples, s)
+		p += stride
+	}
+	it.pos = p
+	it.index++
+	return e, true
+}
+
+// All returns a sequence over the remaining entries, keyed by entry index. It
+// ranges over a copy, so it does not advance the iterator. Each entry's
+// Subsamples reuse the storage of the previous one's.
+func (it *SubsIter) All() iter.Seq2[int, SubsEntry] {
+	return func(yield func(int, SubsEntry) bool) {
+		c := *it
+		var dst []Subsample
+		for {
+			i := int(c.index)
+			e, ok := c.Next(dst)
+			if !ok || !yield(i, e) {
+				return
+			}
+			dst = e.Subsamples
+		}
+	}
+}
+
 // Uint32Iter iterates over uint32 entries (stco, stss).
 type Uint32Iter struct {
 	buf   []byte
@@ -452,6 +1115,54 @@ func (it *Uint32Iter) Next() (uint32, bool) {
 	return v, true
 }
 
+// Read decodes up to len(dst) of the remaining entries into dst and returns
+// how many it decoded, 0 once done. It is the bulk form of Next.
+func (it *Uint32Iter) Read(dst []uint32) int {
+	n := remaining(len(dst), it.count, it.index)
+	n = readUint32s(dst[:n], it.buf[min(4+int(it.index)*4, len(it.buf)):])
+	it.index += uint32(n)
+	return n
+}
+
+// all returns a sequence over the entries left in it, keyed by index, the
+// iterator field holding the index of the next entry. It ranges over a copy
+// of the iterator. next is a method expression, so once all is inlined into
+// an All method the call is direct and the copy stays on the stack.
+func all[T, I any](it *I, index *uint32, next func(*I) (T, bool)) iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		c := *it
+		for i := int(*index); ; i++ {
+			v, ok := next(&c)
+			if !ok || !yield(i, v) {
+				return
+			}
+		}
+	}
+}
+
+// remaining returns how many of the count entries after index fit in a
+// destination of length n.
+func remaining(n int, count, index uint32) int {
+	return min(n, int(count-index))
+}
+
+// readUint32s decodes big-endian uint32s from src into dst, as many as both
+// hold, and returns how many.
+func readUint32s(dst []uint32, src []byte) int {
+	n := min(len(dst), len(src)/4)
+	dst, src = dst[:n], src[:4*n]
+	for i := range dst {
+		dst[i] = be.Uint32(src[4*i:])
+	}
+	return n
+}
+
+// All returns a sequence over the remaining entries, keyed by entry index. It
+// ranges over a copy, so it does not advance the iterator.
+func (it *Uint32Iter) All() iter.Seq2[int, uint32] {
+	return all(it, &it.index, (*Uint32Iter).Next)
+}
+
 // FtypInfo holds parsed fields from an ftyp box.
 type FtypInfo struct {
 	MajorBrand   [4]byte
@@ -459,8 +1170,12 @@ type FtypInfo struct {
 	Compatible   [][4]byte
 }
 
-// ReadFtyp parses an ftyp box.
-func ReadFtyp(data []byte) FtypInfo {
+// ReadFtyp parses an ftyp box. It returns [ErrShortBox] if data is shorter
+// than the major brand and minor version.
+func ReadFtyp(data []byte) (FtypInfo, error) {
+	if len(data) < 8 {
+		return FtypInfo{}, ErrShortBox
+	}
 	f := FtypInfo{
 		MinorVersion: be.Uint32(data[4:8]),
 	}
@@ -470,7 +1185,7 @@ func ReadFtyp(data []byte) FtypInfo {
 		copy(b[:], data[i:i+4])
 		f.Compatible = append(f.Compatible, b)
 	}
-	return f
+	return f, nil
 }
 
 // VisualSampleEntry holds parsed fields from a visual sample entry (e.g. avc1).
@@ -484,11 +1199,26 @@ type VisualSampleEntry struct {
 	CompressorName     string
 	Depth              uint16
 	ChildOffset        int // byte offset within data where child boxes begin
+
+	// The fields below are set only when the entry is decoded as a [Box].
+	BoxType  BoxType // sample entry format, such as avc1
+	Children []Box   // child boxes, such as avcC and pasp
+	Trailer  []byte  // bytes after the last child that do not form a box
 }
 
+// visualSampleEntrySize is the size of the fixed visual sample entry header.
+const visualSampleEntrySize = 78
+
+// audioSampleEntrySize is the size of the fixed audio sample entry header.
+const audioSampleEntrySize = 28
+
 // ReadVisualSampleEntry parses a visual sample entry from box data.
 // Child boxes (e.g. avcC) start at ChildOffset within the data.
-func ReadVisualSampleEntry(data []byte) VisualSampleEntry {
+// It returns [ErrShortBox] if data is shorter than the 78-byte header.
+func ReadVisualSampleEntry(data []byte) (VisualSampleEntry, error) {
+	if len(data) < visualSampleEntrySize {
+		return VisualSampleEntry{}, ErrShortBox
+	}
 	nameLen := min(int(data[42]), 31)
 	return VisualSampleEntry{
 		DataReferenceIndex: be.Uint16(data[6:8]),
@@ -499,8 +1229,8 @@ func ReadVisualSampleEntry(data []byte) VisualSampleEntry {
 		FrameCount:         be.Uint16(data[40:42]),
 		CompressorName:     string(data[43 : 43+nameLen]),
 		Depth:              be.Uint16(data[74:76]),
-		ChildOffset:        78,
-	}
+		ChildOffset:        visualSampleEntrySize,
+	}, nil
 }
 
 // AudioSampleEntry holds parsed fields from an audio sample entry (e.g. mp4a).
@@ -510,18 +1240,27 @@ type AudioSampleEntry struct {
 	SampleSize         uint16
 	SampleRate         uint32 // 16.16 fixed point
 	ChildOffset        int    // byte offset within data where child boxes begin
+
+	// The fields below are set only when the entry is decoded as a [Box].
+	BoxType  BoxType // sample entry format, such as mp4a
+	Children []Box   // child boxes, such as esds and btrt
+	Trailer  []byte  // bytes after the last child that do not form a box
 }
 
 // ReadAudioSampleEntry parses an audio sample entry from box data.
 // Child boxes (e.g. esds) start at ChildOffset within the data.
-func ReadAudioSampleEntry(data []byte) AudioSampleEntry {
+// It returns [ErrShortBox] if data is shorter than the 28-byte header.
+func ReadAudioSampleEntry(data []byte) (AudioSampleEntry, error) {
+	if len(data) < audioSampleEntrySize {
+		return AudioSampleEntry{}, ErrShortBox
+	}
 	return AudioSampleEntry{
 		DataReferenceIndex: be.Uint16(data[6:8]),
 		ChannelCount:       be.Uint16(data[16:18]),
 		SampleSize:         be.Uint16(data[18:20]),
 		SampleRate:         be.Uint32(data[24:28]),
-		ChildOffset:        28,
-	}
+		ChildOffset:        audioSampleEntrySize,
+	}, nil
 }
 
 // ReadAvcC extracts the codec profile string from avcC box data.
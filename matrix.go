@@ -0,0 +1,46 @@
+package mp4
+
+import "math"
+
+// Matrix is the transformation matrix of a movie or track header. It maps a
+// point (x, y) to (a*x + c*y + tx, b*x + d*y + ty), with the elements stored
+// in the order a, b, u, c, d, v, tx, ty, w. All are 16.16 fixed point except
+// u, v and w, which are 2.30.
+type Matrix [9]int32
+
+// IdentityMatrix leaves video unchanged. It is the value movie and track
+// headers normally carry.
+var IdentityMatrix = Matrix{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+// RotationMatrix returns the matrix that rotates video clockwise by degrees,
+// after mirroring it horizontally if flip is set. The translation is zero;
+// players place the rotated picture themselves.
+func RotationMatrix(degrees int, flip bool) Matrix {
+	rad := float64(degrees) * math.Pi / 180
+	cos := int32(math.Round(math.Cos(rad) * 0x10000))
+	sin := int32(math.Round(math.Sin(rad) * 0x10000))
+	m := Matrix{cos, sin, 0, -sin, cos, 0, 0, 0, 0x40000000}
+	if flip {
+		m[0], m[1] = -m[0], -m[1]
+	}
+	return m
+}
+
+// Rotation returns the clockwise rotation m applies, in whole degrees from 0
+// to 359, and whether it also mirrors the video. A mirrored matrix is read as
+// a horizontal flip followed by the rotation, the inverse of
+// [RotationMatrix].
+func (m Matrix) Rotation() (degrees int, flipped bool) {
+	a, b, c, d := float64(m[0]), float64(m[1]), float64(m[3]), float64(m[4])
+	if a*d-b*c < 0 {
+		a, b, flipped = -a, -b, true
+	}
+	if a == 0 && b == 0 {
+		return 0, flipped
+	}
+	degrees = int(math.Round(math.Atan2(b, a) * 180 / math.Pi))
+	if degrees < 0 {
+		degrees += 360
+	}
+	return degrees % 360, flipped
+}
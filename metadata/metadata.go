@@ -0,0 +1,302 @@
+// Package metadata reads and writes iTunes-style metadata: the items of the
+// ilst box in moov/udta/meta, such as the title, artist and cover art.
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+
+	"github.com/tetsuo/mp4"
+)
+
+var be = binary.BigEndian
+
+// ErrMoovNotFound is returned by [Read] when the buffer does not start with a
+// moov box.
+var ErrMoovNotFound = errors.New("moov box not found in buffer")
+
+// Item keys: the box types of the ilst items. Keys starting with © hold the
+// byte 0xa9.
+var (
+	KeyTitle       = mp4.BoxType{0xa9, 'n', 'a', 'm'}
+	KeyArtist      = mp4.BoxType{0xa9, 'A', 'R', 'T'}
+	KeyAlbumArtist = mp4.BoxType{'a', 'A', 'R', 'T'}
+	KeyAlbum       = mp4.BoxType{0xa9, 'a', 'l', 'b'}
+	KeyYear        = mp4.BoxType{0xa9, 'd', 'a', 'y'}
+	KeyGenre       = mp4.BoxType{0xa9, 'g', 'e', 'n'}
+	KeyGenreID     = mp4.BoxType{'g', 'n', 'r', 'e'} // ID3v1 genre number plus one
+	KeyComment     = mp4.BoxType{0xa9, 'c', 'm', 't'}
+	KeyComposer    = mp4.BoxType{0xa9, 'w', 'r', 't'}
+	KeyEncoder     = mp4.BoxType{0xa9, 't', 'o', 'o'}
+	KeyTrackNumber = mp4.BoxType{'t', 'r', 'k', 'n'}
+	KeyDiscNumber  = mp4.BoxType{'d', 'i', 's', 'k'}
+	KeyCover       = mp4.BoxType{'c', 'o', 'v', 'r'}
+	KeyFreeform    = mp4.BoxType{'-', '-', '-', '-'} // named by mean and name
+)
+
+// Boxes inside an ilst item.
+var (
+	typeData = mp4.BoxType{'d', 'a', 't', 'a'}
+	typeMean = mp4.BoxType{'m', 'e', 'a', 'n'}
+	typeName = mp4.BoxType{'n', 'a', 'm', 'e'}
+)
+
+// handlerMdir is the hdlr type of a meta box holding an ilst.
+var handlerMdir = [4]byte{'m', 'd', 'i', 'r'}
+
+// DataType is the well-known type of an item value, recorded in its data box.
+type DataType uint32
+
+const (
+	DataImplicit DataType = 0  // binary; the key implies the format
+	DataUTF8     DataType = 1  // UTF-8 text
+	DataUTF16    DataType = 2  // UTF-16BE text
+	DataJPEG     DataType = 13 // JPEG image
+	DataPNG      DataType = 14 // PNG image
+	DataInt      DataType = 21 // big-endian signed integer of 1 to 8 bytes
+	DataUint     DataType = 22 // big-endian unsigned integer of 1 to 8 bytes
+	DataBMP      DataType = 27 // Windows bitmap image
+)
+
+// Item is one value of an ilst item. An item box holding several data boxes,
+// such as covr with more than one image, yields an Item for each.
+type Item struct {
+	Key mp4.BoxType
+
+	// Mean and Name identify a freeform (----) item, as in
+	// "com.apple.iTunes" and "iTunSMPB". They are empty for other keys.
+	Mean string
+	Name string
+
+	DataType DataType
+	Locale   uint32
+	Value    []byte
+}
+
+// Text returns the value of a UTF-8 or UTF-16 item, or "" for other types.
+func (it *Item) Text() string {
+	switch it.DataType {
+	case DataUTF8:
+		return string(it.Value)
+	case DataUTF16:
+		u := make([]uint16, len(it.Value)/2)
+		for i := range u {
+			u[i] = be.Uint16(it.Value[2*i:])
+		}
+		return string(utf16.Decode(u))
+	}
+	return ""
+}
+
+// Int returns the value of an integer item. ok is false if the item is not of
+// type DataInt, DataUint or DataImplicit, or its value is not 1, 2, 3, 4 or 8
+// bytes long.
+func (it *Item) Int() (v int64, ok bool) {
+	switch it.DataType {
+	case DataInt, DataUint, DataImplicit:
+	default:
+		return 0, false
+	}
+	switch n := len(it.Value); n {
+	case 1:
+		v = int64(int8(it.Value[0]))
+	case 2:
+		v = int64(int16(be.Uint16(it.Value)))
+	case 3:
+		v = int64(int32(uint32(it.Value[0])<<24|uint32(it.Value[1])<<16|uint32(it.Value[2])<<8) >> 8)
+	case 4:
+		v = int64(int32(be.Uint32(it.Value)))
+	case 8:
+		v = int64(be.Uint64(it.Value))
+	default:
+		return 0, false
+	}
+	if it.DataType == DataUint && len(it.Value) < 8 {
+		v &= 1<<(8*len(it.Value)) - 1
+	}
+	return v, true
+}
+
+// Pair returns the number and total of a trkn or disk item. ok is false if
+// the value is shorter than 6 bytes.
+func (it *Item) Pair() (n, total uint16, ok bool) {
+	if len(it.Value) < 6 {
+		return 0, 0, false
+	}
+	return be.Uint16(it.Value[2:]), be.Uint16(it.Value[4:]), true
+}
+
+// Read returns the tags of the movie-level ilst in moov, which must hold the
+// complete box including its header. It returns nil and no error if the movie
+// has no ilst. Box errors are reported as a [*mp4.ParseError] with offsets
+// relative to moov.
+func Read(moov []byte) (*Tags, error) {
+	r := mp4.NewReader(moov)
+	if !r.Next() {
+		if err := r.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrMoovNotFound
+	}
+	if r.Type() != mp4.TypeMoov {
+		return nil, &mp4.ParseError{Path: r.Type().String(), Type: r.Type(), Err: ErrMoovNotFound}
+	}
+	var items []Item
+	found := false
+	r.Enter()
+	for !found && r.Next() {
+		if r.Type() != mp4.TypeUdta {
+			continue
+		}
+		r.Enter()
+		for !found && r.Next() {
+			if r.Type() != mp4.TypeMeta {
+				continue
+			}
+			// QuickTime writes meta as a plain box, so what the reader took
+			// for version and flags is the size of the first child.
+			off := r.DataOffset()
+			if d := r.Data(); len(d) >= 4 && mp4.BoxType(d[:4]) == mp4.TypeHdlr {
+				off -= 4
+			}
+			var err error
+			items, found, err = readMeta(moov[off:r.Offset()+int(r.Size())], int64(off))
+			if err != nil {
+				return nil, err
+			}
+		}
+		r.Exit()
+	}
+	r.Exit()
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+	return NewTags(items), nil
+}
+
+// readMeta reads the ilst among the children of a meta box, held in data at
+// offset off of the moov buffer, and reports whether there is one.
+func readMeta(data []byte, off int64) ([]Item, bool, error) {
+	const path = "moov/udta/meta"
+	r := mp4.NewReader(data)
+	r.SetOrigin(path, off)
+	for r.Next() {
+		if r.Type() == mp4.TypeIlst {
+			items, err := readItems(r.Data(), mp4.JoinPath(path, mp4.TypeIlst, -1), off+int64(r.DataOffset()))
+			return items, true, err
+		}
+	}
+	return nil, false, r.Err()
+}
+
+// ReadIlst decodes the items of an ilst box from its data. Box errors are
+// reported as a [*mp4.ParseError] with offsets relative to data.
+func ReadIlst(data []byte) ([]Item, error) {
+	return readItems(data, "", 0)
+}
+
+// readItems decodes the items in data, the body of the ilst box at path,
+// found at offset off.
+func readItems(data []byte, path string, off int64) ([]Item, error) {
+	var items []Item
+	r := mp4.NewReader(data)
+	r.SetOrigin(path, off)
+	for r.Next() {
+		key := r.Type()
+		itemPath := mp4.JoinPath(path, key, -1)
+		var mean, name string
+		r.Enter()
+		for r.Next() {
+			d := r.Data()
+			if len(d) < 4 {
+				return nil, &mp4.ParseError{
+					Path:   mp4.JoinPath(itemPath, r.Type(), -1),
+					Offset: off + int64(r.Offset()),
+					Type:   r.Type(),
+					Err:    mp4.ErrShortBox,
+				}
+			}
+			switch r.Type() {
+			case typeMean:
+				mean = string(d[4:]) // after version and flags
+			case typeName:
+				name = string(d[4:])
+			case typeData:
+				if len(d) < 8 {
+					return nil, &mp4.ParseError{
+						Path:   mp4.JoinPath(itemPath, typeData, -1),
+						Offset: off + int64(r.Offset()),
+						Type:   typeData,
+						Err:    mp4.ErrShortBox,
+					}
+				}
+				items = append(items, Item{
+					Key:      key,
+					Mean:     mean,
+					Name:     name,
+					DataType: DataType(be.Uint32(d) & 0x00ffffff),
+					Locale:   be.Uint32(d[4:]),
+					Value:    d[8:],
+				})
+			}
+		}
+		r.Exit()
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Write writes a udta box holding a meta box with the given tags. It belongs
+// in moov.
+func Write(w *mp4.Writer, t *Tags) {
+	w.StartBox(mp4.TypeUdta)
+	w.StartFullBox(mp4.TypeMeta, 0, 0)
+	w.WriteHdlr(handlerMdir, "")
+	WriteIlst(w, t.Items())
+	w.EndBox()
+	w.EndBox()
+}
+
+// WriteIlst writes an ilst box holding items. Adjacent items with the same key,
+// mean and name share one item box, each value in its own data box.
+func WriteIlst(w *mp4.Writer, items []Item) {
+	var hdr [8]byte
+	w.StartBox(mp4.TypeIlst)
+	for i, it := range items {
+		if i == 0 || !sameItem(&items[i-1], &it) {
+			if i > 0 {
+				w.EndBox()
+			}
+			w.StartBox(it.Key)
+			if it.Key == KeyFreeform {
+				w.StartFullBox(typeMean, 0, 0)
+				w.Write([]byte(it.Mean))
+				w.EndBox()
+				w.StartFullBox(typeName, 0, 0)
+				w.Write([]byte(it.Name))
+				w.EndBox()
+			}
+		}
+		be.PutUint32(hdr[:], uint32(it.DataType)&0x00ffffff)
+		be.PutUint32(hdr[4:], it.Locale)
+		w.StartBox(typeData)
+		w.Write(hdr[:])
+		w.Write(it.Value)
+		w.EndBox()
+	}
+	if len(items) > 0 {
+		w.EndBox()
+	}
+	w.EndBox()
+}
+
+// sameItem reports whether a and b are values of the same item box.
+func sameItem(a, b *Item) bool {
+	return a.Key == b.Key && a.Mean == b.Mean && a.Name == b.Name
+}
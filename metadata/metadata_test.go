@@ -0,0 +1,120 @@
+package metadata_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/metadata"
+)
+
+// buildMoov wraps udta in a moov box next to an mvhd.
+func buildMoov(udta func(w *mp4.Writer)) []byte {
+	w := mp4.NewGrowWriter(nil)
+	w.StartBox(mp4.TypeMoov)
+	w.WriteMvhd(1000, 0, 2)
+	udta(&w)
+	w.EndBox()
+	return w.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	want := &metadata.Tags{
+		Title:       "Big Buck Bunny",
+		Artist:      "Blender Foundation",
+		AlbumArtist: "Blender",
+		Album:       "Open Movies",
+		Year:        "2008",
+		Genre:       "Animation",
+		Comment:     "CC BY 3.0",
+		Encoder:     "Lavf61.1.100",
+		TrackNumber: 3,
+		TrackTotal:  12,
+		DiscNumber:  1,
+		DiscTotal:   2,
+		Covers: []metadata.Picture{
+			{Format: metadata.DataJPEG, Data: []byte{0xff, 0xd8, 0xff}},
+			{Format: metadata.DataPNG, Data: []byte{0x89, 'P', 'N', 'G'}},
+		},
+		Freeform: []metadata.Item{
+			{Key: metadata.KeyFreeform, Mean: "com.apple.iTunes", Name: "iTunSMPB", DataType: metadata.DataUTF8, Value: []byte(" 00000000 00000840")},
+		},
+		Other: []metadata.Item{
+			{Key: mp4.BoxType{'t', 'm', 'p', 'o'}, DataType: metadata.DataInt, Value: []byte{0, 120}},
+		},
+	}
+	moov := buildMoov(func(w *mp4.Writer) { metadata.Write(w, want) })
+
+	got, err := metadata.Read(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read = %+v\nwant %+v", got, want)
+	}
+	if v, ok := got.Other[0].Int(); !ok || v != 120 {
+		t.Errorf("tmpo = %d, %v, want 120", v, ok)
+	}
+	if v, ok := got.FreeformText("com.apple.iTunes", "iTunSMPB"); !ok || v != " 00000000 00000840" {
+		t.Errorf("FreeformText = %q, %v", v, ok)
+	}
+
+	// Both covers share one covr box.
+	r := mp4.NewReader(moov)
+	covr := 0
+	for r.Next() {
+		if r.Type() == metadata.KeyCover {
+			covr++
+		}
+		if mp4.IsContainerBox(r.Type()) {
+			r.Enter()
+		}
+	}
+	if covr != 1 {
+		t.Errorf("found %d covr boxes, want 1", covr)
+	}
+}
+
+func TestReadQuickTimeMeta(t *testing.T) {
+	moov := buildMoov(func(w *mp4.Writer) {
+		w.StartBox(mp4.TypeUdta)
+		w.StartBox(mp4.TypeMeta) // no version and flags
+		w.WriteHdlr([4]byte{'m', 'd', 'i', 'r'}, "")
+		metadata.WriteIlst(w, []metadata.Item{
+			{Key: metadata.KeyTitle, DataType: metadata.DataUTF16, Value: []byte{0, 'H', 0, 'i'}},
+			{Key: metadata.KeyGenreID, Value: []byte{0, 18}},
+		})
+		w.EndBox()
+		w.EndBox()
+	})
+	got, err := metadata.Read(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Hi" || got.Genre != "Rock" {
+		t.Errorf("title %q genre %q, want Hi and Rock", got.Title, got.Genre)
+	}
+}
+
+func TestReadNoTags(t *testing.T) {
+	moov := buildMoov(func(w *mp4.Writer) {})
+	if got, err := metadata.Read(moov); got != nil || err != nil {
+		t.Errorf("Read = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestReadIlstError(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	w.StartBox(metadata.KeyTitle)
+	w.StartBox(mp4.BoxType{'d', 'a', 't', 'a'})
+	w.Write([]byte{0, 0, 0, 1}) // no locale
+	w.EndBox()
+	w.EndBox()
+
+	_, err := metadata.ReadIlst(w.Bytes())
+	pe, ok := errors.AsType[*mp4.ParseError](err)
+	if !ok || pe.Offset != 8 || !errors.Is(err, mp4.ErrShortBox) {
+		t.Errorf("ReadIlst error = %v, want ErrShortBox at offset 8", err)
+	}
+}
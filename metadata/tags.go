@@ -0,0 +1,173 @@
+package metadata
+
+import "github.com/tetsuo/mp4"
+
+// Tags holds the common ilst items as typed values. Items with other keys,
+// or with a value a field cannot hold, are kept in Other so that writing the
+// tags back loses nothing.
+type Tags struct {
+	Title       string
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Year        string // release date: a year such as "2008" or an ISO 8601 date
+	Genre       string
+	Comment     string
+	Composer    string
+	Encoder     string
+
+	TrackNumber, TrackTotal uint16
+	DiscNumber, DiscTotal   uint16
+
+	Covers   []Picture
+	Freeform []Item // ---- items, named by Mean and Name
+	Other    []Item
+}
+
+// Picture is a cover image.
+type Picture struct {
+	Format DataType // DataJPEG, DataPNG or DataBMP
+	Data   []byte
+}
+
+// MIMEType returns the media type of the image, or "" if the format is not an
+// image type.
+func (p Picture) MIMEType() string {
+	switch p.Format {
+	case DataJPEG:
+		return "image/jpeg"
+	case DataPNG:
+		return "image/png"
+	case DataBMP:
+		return "image/bmp"
+	}
+	return ""
+}
+
+// NewTags sorts items into the fields of a Tags. When a key occurs more than
+// once, the first value is used and the rest are kept in Other.
+func NewTags(items []Item) *Tags {
+	t := new(Tags)
+	genreID := -1
+	for _, it := range items {
+		var s *string
+		switch it.Key {
+		case KeyTitle:
+			s = &t.Title
+		case KeyArtist:
+			s = &t.Artist
+		case KeyAlbumArtist:
+			s = &t.AlbumArtist
+		case KeyAlbum:
+			s = &t.Album
+		case KeyYear:
+			s = &t.Year
+		case KeyGenre:
+			s = &t.Genre
+		case KeyComment:
+			s = &t.Comment
+		case KeyComposer:
+			s = &t.Composer
+		case KeyEncoder:
+			s = &t.Encoder
+		case KeyGenreID:
+			if v, ok := it.Int(); ok && genreID < 0 && v >= 1 && int(v) <= len(genres) {
+				genreID = int(v) - 1
+				continue
+			}
+		case KeyTrackNumber:
+			if n, total, ok := it.Pair(); ok && t.TrackNumber == 0 && t.TrackTotal == 0 {
+				t.TrackNumber, t.TrackTotal = n, total
+				continue
+			}
+		case KeyDiscNumber:
+			if n, total, ok := it.Pair(); ok && t.DiscNumber == 0 && t.DiscTotal == 0 {
+				t.DiscNumber, t.DiscTotal = n, total
+				continue
+			}
+		case KeyCover:
+			if p := (Picture{Format: it.DataType, Data: it.Value}); p.MIMEType() != "" {
+				t.Covers = append(t.Covers, p)
+				continue
+			}
+		case KeyFreeform:
+			t.Freeform = append(t.Freeform, it)
+			continue
+		}
+		if s != nil && *s == "" {
+			if v := it.Text(); v != "" {
+				*s = v
+				continue
+			}
+		}
+		t.Other = append(t.Other, it)
+	}
+	if t.Genre == "" && genreID >= 0 {
+		t.Genre = genres[genreID]
+	}
+	return t
+}
+
+// Items returns the tags as ilst items, in the order iTunes writes them. Text
+// is written as UTF-8 and the genre always as text.
+func (t *Tags) Items() []Item {
+	var items []Item
+	text := func(key mp4.BoxType, s string) {
+		if s != "" {
+			items = append(items, Item{Key: key, DataType: DataUTF8, Value: []byte(s)})
+		}
+	}
+	pair := func(key mp4.BoxType, n, total uint16, size int) {
+		if n != 0 || total != 0 {
+			v := make([]byte, size)
+			be.PutUint16(v[2:], n)
+			be.PutUint16(v[4:], total)
+			items = append(items, Item{Key: key, Value: v})
+		}
+	}
+	text(KeyTitle, t.Title)
+	text(KeyArtist, t.Artist)
+	text(KeyAlbumArtist, t.AlbumArtist)
+	text(KeyAlbum, t.Album)
+	text(KeyGenre, t.Genre)
+	text(KeyYear, t.Year)
+	pair(KeyTrackNumber, t.TrackNumber, t.TrackTotal, 8)
+	pair(KeyDiscNumber, t.DiscNumber, t.DiscTotal, 6)
+	text(KeyComment, t.Comment)
+	text(KeyComposer, t.Composer)
+	text(KeyEncoder, t.Encoder)
+	for _, p := range t.Covers {
+		items = append(items, Item{Key: KeyCover, DataType: p.Format, Value: p.Data})
+	}
+	items = append(items, t.Other...)
+	return append(items, t.Freeform...)
+}
+
+// FreeformText returns the text of the first freeform item with the given mean
+// and name, such as "com.apple.iTunes" and "iTunSMPB".
+func (t *Tags) FreeformText(mean, name string) (string, bool) {
+	for i := range t.Freeform {
+		if it := &t.Freeform[i]; it.Mean == mean && it.Name == name {
+			return it.Text(), true
+		}
+	}
+	return "", false
+}
+
+// genres are the ID3v1 genres; a gnre item holds an index into it plus one.
+var genres = [...]string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock",
+}
@@ -0,0 +1,275 @@
+package mp4
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrBoxNotFound is returned by [Find] when no box matches the path.
+	ErrBoxNotFound = errors.New("mp4: no box matches path")
+
+	// ErrInvalidPath is returned for a malformed box path.
+	ErrInvalidPath = errors.New("mp4: invalid box path")
+)
+
+// Match is a box found by a path query.
+type Match struct {
+	Type       BoxType
+	Offset     int // offset of the box header in the searched buffer
+	DataOffset int // offset of Data in the searched buffer
+	Size       uint64
+	Version    uint8  // full boxes only
+	Flags      uint32 // full boxes only
+	Data       []byte // box data, after the header and any version and flags
+}
+
+// Find returns the first box in buf that matches path, a list of box types
+// from the top level down separated by slashes, such as
+// "moov/trak/mdia/minf/stbl/stsd/*/avcC". A * matches any type, and a
+// zero-based index in brackets picks one of the boxes the element matches, as
+// in "moov/trak[1]" or "stsd/*[0]". Types may be written with © for the byte
+// 0xa9, as in "moov/udta/meta/ilst/©nam".
+//
+// Find descends into containers, the entries of stsd and dref, sample entries
+// such as avc1 and mp4a, and ilst items, skipping their fixed fields. It
+// returns [ErrBoxNotFound] if no box matches, [ErrInvalidPath] if path is
+// malformed, and a [*ParseError] for malformed boxes met on the way.
+func Find(buf []byte, path string) (Match, error) {
+	var segs pathSegments
+	if !segs.parse(path) {
+		return Match{}, ErrInvalidPath
+	}
+	r := NewReader(buf)
+	var m Match
+	found := r.find(&segs, 0, &m, nil)
+	if r.err != nil {
+		return Match{}, r.err
+	}
+	if !found {
+		return Match{}, ErrBoxNotFound
+	}
+	return m, nil
+}
+
+// FindAll returns every box in buf that matches path, in file order. See
+// [Find] for the path syntax. Matching nothing is not an error.
+func FindAll(buf []byte, path string) ([]Match, error) {
+	var segs pathSegments
+	if !segs.parse(path) {
+		return nil, ErrInvalidPath
+	}
+	r := NewReader(buf)
+	var all []Match
+	r.find(&segs, 0, nil, &all)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return all, nil
+}
+
+// Find returns the first box below the current box that matches path, given
+// relative to the current box, as in "avcC" for an avc1 entry or
+// "mdia/minf/stbl" for a trak. See the package-level [Find] for the path
+// syntax. It does not move the reader. Offsets are relative to the reader's
+// buffer, and malformed boxes are recorded as with the other accessors.
+func (r *Reader) Find(path string) (Match, bool) {
+	var segs pathSegments
+	if !segs.parse(path) {
+		r.fail(ErrInvalidPath)
+		return Match{}, false
+	}
+	off, ok := childOffset(r.parentType(), r.boxType, r.Data())
+	if !ok {
+		return Match{}, false
+	}
+	q := *r
+	q.Enter()
+	q.Skip(off)
+	var m Match
+	found := q.find(&segs, 0, &m, nil)
+	if r.err == nil {
+		r.err = q.err
+	}
+	return m, found
+}
+
+// find matches segs[i:] against the boxes at the reader's level. It stores the
+// first match in first and reports true, or, when first is nil, appends every
+// match to all.
+func (r *Reader) find(segs *pathSegments, i int, first *Match, all *[]Match) bool {
+	seg := &segs.s[i]
+	n := 0
+	for r.Next() {
+		if !seg.any && r.boxType != seg.typ {
+			continue
+		}
+		n++
+		if seg.index >= 0 && n-1 != seg.index {
+			continue
+		}
+		if i == segs.n-1 {
+			m := r.match()
+			if first != nil {
+				*first = m
+				return true
+			}
+			*all = append(*all, m)
+		} else if off, ok := childOffset(r.parentType(), r.boxType, r.Data()); ok {
+			r.Enter()
+			r.Skip(off)
+			found := r.find(segs, i+1, first, all)
+			r.Exit()
+			if found {
+				return true
+			}
+		}
+		if seg.index >= 0 || r.err != nil {
+			break
+		}
+	}
+	return false
+}
+
+// match describes the current box.
+func (r *Reader) match() Match {
+	return Match{
+		Type:       r.boxType,
+		Offset:     r.boxStart,
+		DataOffset: r.dataStart,
+		Size:       r.boxSize,
+		Version:    r.version,
+		Flags:      r.flags,
+		Data:       r.Data(),
+	}
+}
+
+// parentType returns the type of the box the reader has entered, or zero at
+// the top level.
+func (r *Reader) parentType() BoxType {
+	if r.depth == 0 {
+		return BoxType{}
+	}
+	return r.stack[r.depth-1].typ
+}
+
+// Sample entry formats, whose fixed fields come before their child boxes.
+var (
+	visualSampleEntries = [...]BoxType{
+		TypeAvc1, {'a', 'v', 'c', '3'}, {'h', 'v', 'c', '1'}, {'h', 'e', 'v', '1'},
+		TypeAv01, {'v', 'p', '0', '8'}, {'v', 'p', '0', '9'}, {'m', 'p', '4', 'v'},
+		{'d', 'v', 'h', '1'}, {'d', 'v', 'h', 'e'}, {'v', 'v', 'c', '1'}, {'e', 'n', 'c', 'v'},
+	}
+	audioSampleEntries = [...]BoxType{
+		TypeMp4a, {'a', 'c', '-', '3'}, {'e', 'c', '-', '3'}, {'a', 'c', '-', '4'},
+		{'O', 'p', 'u', 's'}, {'f', 'L', 'a', 'C'}, {'a', 'l', 'a', 'c'}, {'e', 'n', 'c', 'a'},
+	}
+)
+
+// childOffset returns where the child boxes of a box of type t, found in a
+// box of type parent, start within its data, and whether it has children.
+func childOffset(parent, t BoxType, data []byte) (int, bool) {
+	if IsContainerBox(t) || parent == TypeIlst {
+		return 0, true
+	}
+	switch t {
+	case TypeStsd, TypeDref:
+		return 4, true // entry count
+	}
+	if isVisualSampleEntry(t) {
+		return visualSampleEntrySize, true
+	}
+	if isAudioSampleEntry(t) {
+		// QuickTime sound descriptions version 1 and 2 add fields.
+		if len(data) >= 10 {
+			switch be.Uint16(data[8:]) {
+			case 1:
+				return audioSampleEntrySize + 16, true
+			case 2:
+				return audioSampleEntrySize + 36, true
+			}
+		}
+		return audioSampleEntrySize, true
+	}
+	return 0, false
+}
+
+func isVisualSampleEntry(t BoxType) bool { return slices.Contains(visualSampleEntries[:], t) }
+
+func isAudioSampleEntry(t BoxType) bool { return slices.Contains(audioSampleEntries[:], t) }
+
+// pathSegment is one element of a box path.
+type pathSegment struct {
+	typ   BoxType
+	any   bool // * matches every type
+	index int  // position among the matching siblings, or -1 for all
+}
+
+// pathSegments is a parsed box path. It holds no more elements than the
+// reader can nest, so parsing does not allocate.
+type pathSegments struct {
+	s [maxDepth]pathSegment
+	n int
+}
+
+// parse splits path into segments and reports whether it is well formed.
+func (p *pathSegments) parse(path string) bool {
+	for path != "" || p.n == 0 {
+		if p.n == maxDepth {
+			return false
+		}
+		elem, rest, more := strings.Cut(path, "/")
+		if more && rest == "" {
+			return false
+		}
+		path = rest
+		seg := &p.s[p.n]
+		seg.index = -1
+		if i := strings.IndexByte(elem, '['); i >= 0 {
+			idx, ok := parseIndex(elem[i+1:])
+			if !ok {
+				return false
+			}
+			seg.index = idx
+			elem = elem[:i]
+		}
+		if elem == "*" {
+			seg.any = true
+		} else if !parseBoxType(elem, &seg.typ) {
+			return false
+		}
+		p.n++
+	}
+	return true
+}
+
+// parseIndex parses "n]".
+func parseIndex(s string) (int, bool) {
+	if len(s) < 2 || s[len(s)-1] != ']' {
+		return 0, false
+	}
+	n := 0
+	for _, c := range []byte(s[:len(s)-1]) {
+		if c < '0' || c > '9' || n > 1<<24 {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+// parseBoxType reads a four-character type, writing runes below 256, such as
+// ©, as single bytes.
+func parseBoxType(s string, t *BoxType) bool {
+	i := 0
+	for _, c := range s {
+		if i == len(t) || c >= 256 || c == utf8.RuneError {
+			return false
+		}
+		t[i] = byte(c)
+		i++
+	}
+	return i == len(t)
+}
@@ -1,12 +1,32 @@
 package mp4
 
+import (
+	"errors"
+	"iter"
+)
+
 // maxDepth limits the reader/writer nesting stack.
 const maxDepth = 16
 
+var (
+	// ErrShortBox is reported by [Reader.Err] when a box holds fewer bytes than
+	// the layout of its type requires.
+	ErrShortBox = errors.New("mp4: box data too short")
+	// ErrInvalidBoxSize is reported by [Reader.Err] when a box size is smaller
+	// than its header or extends past the end of its parent.
+	ErrInvalidBoxSize = errors.New("mp4: invalid box size")
+	// ErrTooDeep is reported by [Reader.Err] when Enter would nest containers
+	// deeper than the reader supports.
+	ErrTooDeep = errors.New("mp4: box nesting too deep")
+)
+
 // readerFrame stores parent state when entering a container box.
 type readerFrame struct {
 	end    int // parent's iteration end boundary
 	boxEnd int // position to resume after exiting this container
+	first  int // start of the parent's first child, for error paths
+	start  int // start of the entered container, for error paths
+	typ    BoxType
 }
 
 // Reader provides hierarchical, in-memory parsing of box data. After loading
@@ -51,10 +71,26 @@ type readerFrame struct {
 //	    // process avcC, pasp, etc.
 //	}
 //	r.Exit()
+//
+// Typed accessors such as ReadTkhd check the box length against the layout of
+// the box type. A box that is too short yields zero values and records an
+// error, which [Reader.Err] reports after parsing:
+//
+//	for r.Next() {
+//	    if r.Type() == mp4.TypeTkhd {
+//	        trackId, _, _, _ = r.ReadTkhd()
+//	    }
+//	}
+//	if err := r.Err(); err != nil { ... }
 type Reader struct {
-	buf []byte
-	pos int // next position to parse from
-	end int // iteration end boundary
+	buf   []byte
+	pos   int // next position to parse from
+	end   int // iteration end boundary
+	first int // start of the first box at the current level
+
+	// Origin of buf within the file, used in error paths and offsets.
+	basePath   string
+	baseOffset int64
 
 	// Current box state
 	boxType   BoxType
@@ -67,9 +103,23 @@ type Reader struct {
 	version uint8
 	flags   uint32
 
+	extType [16]byte // extended type of a uuid box
+
 	// Nesting stack
-	stack [maxDepth]readerFrame
-	depth int
+	stack    [maxDepth]readerFrame
+	depth    int
+	overflow int // Enter calls refused past maxDepth, unwound by Exit
+
+	err error // first error, reported by Err
+}
+
+// SetOrigin records where the reader's buffer sits within a file, so that
+// errors from [Reader.Err] report absolute offsets and full box paths. offset
+// is the file position of the buffer's first byte and path is the box path of
+// the box whose data the buffer holds, or "" when it holds top-level boxes.
+func (r *Reader) SetOrigin(path string, offset int64) {
+	r.basePath = path
+	r.baseOffset = offset
 }
 
 // NewReader creates a Reader for the given buffer.
@@ -82,6 +132,10 @@ func NewReader(buf []byte) Reader {
 
 // Next advances to the next sibling box. Returns false if no more boxes.
 func (r *Reader) Next() bool {
+	if r.overflow > 0 {
+		return false
+	}
+
 	// Skip past current box
 	if r.boxEnd > r.pos {
 		r.pos = r.boxEnd
@@ -99,6 +153,7 @@ func (r *Reader) Next() bool {
 	// Extended size
 	if size == 1 {
 		if r.end-r.pos < 16 {
+			r.fail(ErrInvalidBoxSize)
 			return false
 		}
 		size = be.Uint64(r.buf[ptr:])
@@ -110,16 +165,27 @@ func (r *Reader) Next() bool {
 		size = uint64(r.end - r.pos)
 	}
 
+	if size < uint64(ptr-r.boxStart) || size > uint64(r.end-r.pos) {
+		r.fail(ErrInvalidBoxSize)
+		return false
+	}
+
 	r.boxSize = size
 	r.boxEnd = r.boxStart + int(size)
 
-	if r.boxEnd > r.end {
-		return false
+	if r.boxType == TypeUuid {
+		if r.boxEnd-ptr < uuidSize {
+			r.fail(ErrInvalidBoxSize)
+			return false
+		}
+		copy(r.extType[:], r.buf[ptr:])
+		ptr += uuidSize
 	}
 
 	// Parse full box header if applicable
 	if IsFullBox(r.boxType) {
 		if r.boxEnd-ptr < 4 {
+			r.fail(ErrShortBox)
 			return false
 		}
 		vf := be.Uint32(r.buf[ptr:])
@@ -141,6 +207,15 @@ func (r *Reader) Type() BoxType { return r.boxType }
 // Size returns the current box's total size including header.
 func (r *Reader) Size() uint64 { return r.boxSize }
 
+// ExtendedType returns the 16-byte extended type of a uuid box, which
+// [Reader.Data] excludes. It returns zero for other boxes.
+func (r *Reader) ExtendedType() [16]byte {
+	if r.boxType != TypeUuid {
+		return [16]byte{}
+	}
+	return r.extType
+}
+
 // Version returns the version field for full boxes.
 func (r *Reader) Version() uint8 { return r.version }
 
@@ -171,6 +246,81 @@ func (r *Reader) RawBox() []byte {
 // Depth returns the current nesting depth (0 at top level).
 func (r *Reader) Depth() int { return r.depth }
 
+// Err returns the first error encountered while parsing: a malformed box
+// header, a box too short for a typed accessor, or nesting past the supported
+// depth. Typed accessors return zero values once they fail. The error is a
+// [*ParseError] locating the offending box.
+func (r *Reader) Err() error { return r.err }
+
+// fail records err against the current box unless an earlier error is
+// already recorded.
+func (r *Reader) fail(err error) {
+	if r.err == nil {
+		r.err = r.parseError(err)
+	}
+}
+
+// parseError wraps err in a [*ParseError] locating the current box.
+func (r *Reader) parseError(err error) *ParseError {
+	return &ParseError{
+		Path:   r.path(),
+		Offset: r.baseOffset + int64(r.boxStart),
+		Type:   r.boxType,
+		Err:    err,
+	}
+}
+
+// path builds the box path of the current box from the nesting stack. It
+// walks each level's siblings to number repeated types, so it is only used
+// when reporting errors.
+func (r *Reader) path() string {
+	p := r.basePath
+	for i := 0; i < r.depth; i++ {
+		f := r.stack[i]
+		p = JoinPath(p, f.typ, r.siblingIndex(f.first, f.end, f.start, f.typ))
+	}
+	return JoinPath(p, r.boxType, r.siblingIndex(r.first, r.end, r.boxStart, r.boxType))
+}
+
+// siblingIndex returns the position of the box at target among boxes of type t
+// in buf[first:end], or -1 if it is the only one.
+func (r *Reader) siblingIndex(first, end, target int, t BoxType) int {
+	idx, n := -1, 0
+	for pos := first; end-pos >= 8; {
+		size := uint64(be.Uint32(r.buf[pos:]))
+		if size == 1 && end-pos >= 16 {
+			size = be.Uint64(r.buf[pos+8:])
+		} else if size == 0 {
+			size = uint64(end - pos)
+		}
+		if BoxType(r.buf[pos+4:pos+8]) == t {
+			if pos == target {
+				idx = n
+			}
+			n++
+		}
+		if size < 8 || size > uint64(end-pos) {
+			break
+		}
+		pos += int(size)
+	}
+	if n < 2 {
+		return -1
+	}
+	return idx
+}
+
+// need returns the current box's data if it holds at least n bytes. Otherwise
+// it records [ErrShortBox] and returns nil.
+func (r *Reader) need(n int) []byte {
+	data := r.Data()
+	if len(data) < n {
+		r.fail(ErrShortBox)
+		return nil
+	}
+	return data
+}
+
 // Enter descends into the current container box to iterate its children.
 // After Enter, call Next to advance to the first child box.
 // Call Exit when done to return to the parent level.
@@ -180,46 +330,114 @@ func (r *Reader) Depth() int { return r.depth }
 //
 // For sample entry boxes like avc1 (78 bytes) or mp4a (28 bytes),
 // call Skip with the fixed header size after Enter to reach child boxes.
+//
+// Entering deeper than the supported nesting depth records [ErrTooDeep];
+// Next then returns false until the matching Exit.
 func (r *Reader) Enter() {
+	if r.overflow > 0 || r.depth == maxDepth {
+		r.fail(ErrTooDeep)
+		r.overflow++
+		return
+	}
 	r.stack[r.depth] = readerFrame{
 		end:    r.end,
 		boxEnd: r.boxEnd,
+		first:  r.first,
+		start:  r.boxStart,
+		typ:    r.boxType,
 	}
 	r.depth++
 	r.end = r.boxEnd
 	r.pos = r.dataStart
+	r.first = r.dataStart
 	r.boxEnd = r.dataStart // prevent Next from skipping
 }
 
 // Exit returns to the parent container level.
 // After Exit, the next call to Next will advance to the next sibling.
 func (r *Reader) Exit() {
+	if r.overflow > 0 {
+		r.overflow--
+		return
+	}
+	if r.depth == 0 {
+		return
+	}
 	r.depth--
 	f := r.stack[r.depth]
 	r.end = f.end
 	r.pos = f.boxEnd
 	r.boxEnd = f.boxEnd
+	r.first = f.first
+}
+
+// Children returns a sequence over the child boxes of the current box, with
+// the reader positioned on each child in turn. It enters the box, skipping the
+// fixed fields of stsd, dref and sample entries as [Find] does, and returns to
+// the current level when the loop ends, even on break or when the loop body
+// leaves a child entered. It yields nothing for a box without children.
+func (r *Reader) Children() iter.Seq[BoxType] {
+	return func(yield func(BoxType) bool) {
+		off, ok := childOffset(r.parentType(), r.boxType, r.Data())
+		if !ok {
+			return
+		}
+		level := r.depth + r.overflow
+		r.Enter()
+		if r.overflow > 0 {
+			r.Exit() // too deep; Enter recorded the error
+			return
+		}
+		r.Skip(off)
+		for r.Next() {
+			if !yield(r.boxType) {
+				break
+			}
+			r.exitTo(level + 1)
+		}
+		r.exitTo(level)
+	}
+}
+
+// exitTo exits until the reader is level boxes deep, counting levels past
+// maxDepth.
+func (r *Reader) exitTo(level int) {
+	for r.depth+r.overflow > level {
+		r.Exit()
+	}
 }
 
 // Skip advances the data position by n bytes within the current container.
-// Use after Enter to skip fixed-size headers before child boxes.
+// Use after Enter to skip fixed-size headers before child boxes. Skipping past
+// the end of the container records [ErrShortBox].
 func (r *Reader) Skip(n int) {
+	if n < 0 || n > r.end-r.pos {
+		r.fail(ErrShortBox)
+		n = r.end - r.pos
+	}
 	r.pos += n
 	r.boxEnd = r.pos
+	r.first = r.pos
 }
 
 // EntryCount reads the uint32 entry count at the start of box data.
 // Used for boxes like stsd and dref that begin with a count field.
 func (r *Reader) EntryCount() uint32 {
-	data := r.Data()
+	data := r.need(4)
+	if data == nil {
+		return 0
+	}
 	return be.Uint32(data[0:4])
 }
 
 // ReadMvhd extracts key fields from an mvhd box.
 // Returns timescale, duration, and nextTrackId.
 func (r *Reader) ReadMvhd() (timescale uint32, duration uint64, nextTrackId uint32) {
-	data := r.Data()
 	version := r.Version()
+	data := r.need(mvhdSize(version))
+	if data == nil {
+		return
+	}
 	if version == 1 {
 		// v1: ctime(8)+mtime(8)+timescale(4)+duration(8)+rate(4)+volume(2)+reserved(10)+matrix(36)+predefined(24)+nextTrackId(4) = 108
 		timescale = be.Uint32(data[16:20])
@@ -238,8 +456,11 @@ func (r *Reader) ReadMvhd() (timescale uint32, duration uint64, nextTrackId uint
 // Returns trackId, duration, width, height.
 // Width and height are 16.16 fixed-point values; shift right by 16 for pixels.
 func (r *Reader) ReadTkhd() (trackId uint32, duration uint64, width, height uint32) {
-	data := r.Data()
 	version := r.Version()
+	data := r.need(tkhdSize(version))
+	if data == nil {
+		return
+	}
 	if version == 1 {
 		// v1: ctime(8)+mtime(8)+trackId(4)+reserved(4)+duration(8)
 		trackId = be.Uint32(data[16:20])
@@ -259,29 +480,64 @@ func (r *Reader) ReadTkhd() (trackId uint32, duration uint64, width, height uint
 }
 
 // ReadMdhd extracts key fields from an mdhd box.
-// Returns timescale, duration, and language code.
-func (r *Reader) ReadMdhd() (timescale uint32, duration uint64, language uint16) {
-	data := r.Data()
+// Returns timescale, duration, and the ISO-639-2/T language code, such as
+// "eng"; see [DecodeLanguage].
+func (r *Reader) ReadMdhd() (timescale uint32, duration uint64, language string) {
 	version := r.Version()
+	data := r.need(mdhdSize(version))
+	if data == nil {
+		return
+	}
 	if version == 1 {
 		// v1: ctime(8)+mtime(8)+timescale(4)+duration(8)+lang(2)+quality(2)
 		timescale = be.Uint32(data[16:20])
 		duration = be.Uint64(data[20:28])
-		language = be.Uint16(data[28:30])
+		language = DecodeLanguage(be.Uint16(data[28:30]))
 	} else {
 		// v0: ctime(4)+mtime(4)+timescale(4)+duration(4)+lang(2)+quality(2)
 		timescale = be.Uint32(data[8:12])
 		duration = uint64(be.Uint32(data[12:16]))
-		language = be.Uint16(data[16:18])
+		language = DecodeLanguage(be.Uint16(data[16:18]))
 	}
 	return
 }
 
+// ReadMovieHeader decodes every field of an mvhd box, including the creation
+// and modification times, rate, volume and matrix that [Reader.ReadMvhd]
+// leaves out.
+func (r *Reader) ReadMovieHeader() (h Mvhd) {
+	if r.need(mvhdSize(r.version)) != nil {
+		h.Decode(r.Data(), r.version, r.flags)
+	}
+	return h
+}
+
+// ReadTrackHeader decodes every field of a tkhd box, including the times,
+// layer, alternate group, volume and matrix that [Reader.ReadTkhd] leaves out.
+func (r *Reader) ReadTrackHeader() (h Tkhd) {
+	if r.need(tkhdSize(r.version)) != nil {
+		h.Decode(r.Data(), r.version, r.flags)
+	}
+	return h
+}
+
+// ReadMediaHeader decodes every field of an mdhd box, including the creation
+// and modification times.
+func (r *Reader) ReadMediaHeader() (h Mdhd) {
+	if r.need(mdhdSize(r.version)) != nil {
+		h.Decode(r.Data(), r.version, r.flags)
+	}
+	return h
+}
+
 // ReadHdlr extracts the handler type from an hdlr box.
 // Returns the 4-byte handler type string.
 func (r *Reader) ReadHdlr() [4]byte {
-	data := r.Data()
 	var t [4]byte
+	data := r.need(8)
+	if data == nil {
+		return t
+	}
 	copy(t[:], data[4:8])
 	return t
 }
@@ -300,10 +556,23 @@ func (r *Reader) ReadHdlrName() string {
 	return string(data[20:end])
 }
 
+// ReadElng extracts the BCP 47 language tag, such as "en-US", from an elng box.
+func (r *Reader) ReadElng() string {
+	data := r.Data()
+	end := 0
+	for end < len(data) && data[end] != 0 {
+		end++
+	}
+	return string(data[:end])
+}
+
 // ReadMehd extracts the fragment duration from an mehd box.
 func (r *Reader) ReadMehd() (fragmentDuration uint64) {
-	data := r.Data()
 	version := r.Version()
+	data := r.need(versionedSize(version, 4, 8))
+	if data == nil {
+		return
+	}
 	if version == 1 {
 		fragmentDuration = be.Uint64(data[0:8])
 	} else {
@@ -335,7 +604,10 @@ func (r *Reader) ReadElst() (mediaTime int64, ok bool) {
 // Returns trackId, default sample description index, default sample duration,
 // default sample size, and default sample flags.
 func (r *Reader) ReadTrex() (trackId, defSampleDescIdx, defSampleDuration, defSampleSize, defSampleFlags uint32) {
-	data := r.Data()
+	data := r.need(20)
+	if data == nil {
+		return
+	}
 	trackId = be.Uint32(data[0:4])
 	defSampleDescIdx = be.Uint32(data[4:8])
 	defSampleDuration = be.Uint32(data[8:12])
@@ -346,22 +618,32 @@ func (r *Reader) ReadTrex() (trackId, defSampleDescIdx, defSampleDuration, defSa
 
 // ReadMfhd extracts the sequence number from an mfhd box.
 func (r *Reader) ReadMfhd() (sequenceNumber uint32) {
-	data := r.Data()
+	data := r.need(4)
+	if data == nil {
+		return
+	}
 	sequenceNumber = be.Uint32(data[0:4])
 	return
 }
 
-// ReadTfhd extracts the track ID from a tfhd box.
+// ReadTfhd extracts the track ID from a tfhd box. Use [ReadTfhdInfo] for the
+// other fields.
 func (r *Reader) ReadTfhd() (trackId uint32) {
-	data := r.Data()
+	data := r.need(4)
+	if data == nil {
+		return
+	}
 	trackId = be.Uint32(data[0:4])
 	return
 }
 
 // ReadTfdt extracts the base media decode time from a tfdt box.
 func (r *Reader) ReadTfdt() (baseMediaDecodeTime uint64) {
-	data := r.Data()
 	version := r.Version()
+	data := r.need(versionedSize(version, 4, 8))
+	if data == nil {
+		return
+	}
 	if version == 1 {
 		baseMediaDecodeTime = be.Uint64(data[0:8])
 	} else {
@@ -369,3 +651,25 @@ func (r *Reader) ReadTfdt() (baseMediaDecodeTime uint64) {
 	}
 	return
 }
+
+// Minimum data sizes of the header boxes, after the version and flags.
+const (
+	mvhdSizeV0 = 96
+	mvhdSizeV1 = 108
+	tkhdSizeV0 = 80
+	tkhdSizeV1 = 92
+	mdhdSizeV0 = 20
+	mdhdSizeV1 = 32
+)
+
+func mvhdSize(version uint8) int { return versionedSize(version, mvhdSizeV0, mvhdSizeV1) }
+func tkhdSize(version uint8) int { return versionedSize(version, tkhdSizeV0, tkhdSizeV1) }
+func mdhdSize(version uint8) int { return versionedSize(version, mdhdSizeV0, mdhdSizeV1) }
+
+// versionedSize returns v1 for version 1 boxes and v0 otherwise.
+func versionedSize(version uint8, v0, v1 int) int {
+	if version == 1 {
+		return v1
+	}
+	return v0
+}
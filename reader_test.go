@@ -0,0 +1,780 @@
+package mp4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func TestReaderShortBox(t *testing.T) {
+	w := mp4.NewWriter(make([]byte, 64))
+	w.StartFullBox(mp4.TypeTkhd, 0, 3)
+	w.Write(make([]byte, 20)) // far short of the 80-byte v0 layout
+	w.EndBox()
+
+	r := mp4.NewReader(w.Bytes())
+	if !r.Next() {
+		t.Fatal("expected tkhd")
+	}
+	id, dur, width, height := r.ReadTkhd()
+	if id != 0 || dur != 0 || width != 0 || height != 0 {
+		t.Errorf("ReadTkhd on short box = %d %d %d %d, want zeros", id, dur, width, height)
+	}
+	if !errors.Is(r.Err(), mp4.ErrShortBox) {
+		t.Errorf("Err = %v, want ErrShortBox", r.Err())
+	}
+}
+
+func TestReaderInvalidSize(t *testing.T) {
+	// A box claiming 4 bytes is smaller than its own header.
+	buf := []byte{0, 0, 0, 4, 'f', 'r', 'e', 'e'}
+	r := mp4.NewReader(buf)
+	if r.Next() {
+		t.Fatal("Next accepted a box smaller than its header")
+	}
+	if !errors.Is(r.Err(), mp4.ErrInvalidBoxSize) {
+		t.Errorf("Err = %v, want ErrInvalidBoxSize", r.Err())
+	}
+}
+
+func TestReaderTooDeep(t *testing.T) {
+	const levels = 20
+	buf := make([]byte, 8*levels)
+	for i := range levels {
+		hdr := buf[8*i:]
+		binary.BigEndian.PutUint32(hdr, uint32(8*(levels-i)))
+		copy(hdr[4:8], "moov")
+	}
+
+	r := mp4.NewReader(buf)
+	var descend func(n int) int
+	descend = func(n int) int {
+		deepest := n
+		for r.Next() {
+			r.Enter()
+			deepest = max(deepest, descend(n+1))
+			r.Exit()
+		}
+		return deepest
+	}
+	if got := descend(0); got > levels {
+		t.Errorf("descended %d levels, want at most %d", got, levels)
+	}
+	if !errors.Is(r.Err(), mp4.ErrTooDeep) {
+		t.Errorf("Err = %v, want ErrTooDeep", r.Err())
+	}
+	if r.Depth() != 0 {
+		t.Errorf("Depth after unwinding = %d, want 0", r.Depth())
+	}
+}
+
+func TestReadSampleEntryShort(t *testing.T) {
+	if _, err := mp4.ReadVisualSampleEntry(make([]byte, 40)); !errors.Is(err, mp4.ErrShortBox) {
+		t.Errorf("ReadVisualSampleEntry err = %v, want ErrShortBox", err)
+	}
+	if _, err := mp4.ReadAudioSampleEntry(make([]byte, 10)); !errors.Is(err, mp4.ErrShortBox) {
+		t.Errorf("ReadAudioSampleEntry err = %v, want ErrShortBox", err)
+	}
+	if _, err := mp4.ReadFtyp(make([]byte, 4)); !errors.Is(err, mp4.ErrShortBox) {
+		t.Errorf("ReadFtyp err = %v, want ErrShortBox", err)
+	}
+}
+
+func TestStreamScanner(t *testing.T) {
+	w := mp4.NewWriter(make([]byte, 64))
+	w.StartBox(mp4.TypeFree)
+	w.Write([]byte("skipped"))
+	w.EndBox()
+	w.StartBox(mp4.TypeMoov)
+	w.Write([]byte("body"))
+	w.EndBox()
+	// A trailing mdat with size 0 runs to the end of the stream.
+	buf := append(w.Bytes(), 0, 0, 0, 0, 'm', 'd', 'a', 't', 1, 2, 3)
+
+	// Hide the Seek method of bytes.Reader.
+	sc := mp4.NewStreamScanner(struct{ io.Reader }{bytes.NewReader(buf)})
+	var types []string
+	for sc.Next() {
+		e := sc.Entry()
+		types = append(types, e.Type.String())
+		switch e.Type {
+		case mp4.TypeMoov:
+			box := make([]byte, e.Size)
+			if err := sc.ReadBox(box); err != nil {
+				t.Fatalf("ReadBox: %v", err)
+			}
+			if string(box[8:]) != "body" {
+				t.Errorf("moov body = %q, want %q", box[8:], "body")
+			}
+		case mp4.TypeMdat:
+			rest, _ := io.ReadAll(sc.Body())
+			if len(rest) != 3 {
+				t.Errorf("mdat body = %d bytes, want 3", len(rest))
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("Err = %v", err)
+	}
+	if got := strings.Join(types, ","); got != "free,moov,mdat" {
+		t.Errorf("boxes = %s, want free,moov,mdat", got)
+	}
+}
+
+func TestStreamScannerTruncated(t *testing.T) {
+	buf := []byte{0, 0, 0, 32, 'm', 'o', 'o', 'v', 1, 2}
+	sc := mp4.NewStreamScanner(bytes.NewReader(buf))
+	if !sc.Next() {
+		t.Fatal("expected moov header")
+	}
+	if sc.Next() {
+		t.Fatal("Next past a truncated body")
+	}
+	if !errors.Is(sc.Err(), io.ErrUnexpectedEOF) {
+		t.Errorf("Err = %v, want io.ErrUnexpectedEOF", sc.Err())
+	}
+}
+
+func TestScannerAtConcurrent(t *testing.T) {
+	w := mp4.NewWriter(make([]byte, 256))
+	for i := range 4 {
+		w.StartBox(mp4.TypeFree)
+		w.Write(bytes.Repeat([]byte{byte(i)}, 8*(i+1)))
+		w.EndBox()
+	}
+	buf := w.Bytes()
+
+	sc := mp4.NewScannerAt(bytes.NewReader(buf), int64(len(buf)))
+	entries, err := sc.Entries(nil)
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Go(func() {
+			body := make([]byte, e.DataSize())
+			if err := sc.ReadBody(e, body); err != nil {
+				t.Errorf("ReadBody(%d): %v", i, err)
+				return
+			}
+			if !bytes.Equal(body, bytes.Repeat([]byte{byte(i)}, 8*(i+1))) {
+				t.Errorf("body %d = %v", i, body)
+			}
+		})
+	}
+	wg.Wait()
+
+	// A box running past the end of the data is rejected before anything
+	// allocates its size.
+	short := mp4.NewScannerAt(bytes.NewReader(buf), int64(len(buf))-1)
+	_, err = short.EntryAt(entries[3].Offset)
+	if pe, ok := errors.AsType[*mp4.ParseError](err); !ok || !errors.Is(err, mp4.ErrInvalidBoxSize) || pe.Offset != entries[3].Offset {
+		t.Errorf("EntryAt past end err = %v, want ErrInvalidBoxSize at offset %d", err, entries[3].Offset)
+	}
+}
+
+func TestUUIDBox(t *testing.T) {
+	ext := [16]byte{0xa2, 0x39, 0x4f, 0x52, 0x5a, 0x9b, 0x4f, 0x14, 0xa2, 0x44, 0x6c, 0x42, 0x7c, 0x64, 0x8d, 0xf4}
+	w := mp4.NewWriter(make([]byte, 64))
+	w.StartUUIDBox(ext)
+	w.Write([]byte("piff"))
+	w.EndBox()
+	w.StartBox(mp4.TypeFree)
+	w.EndBox()
+	buf := w.Bytes()
+
+	r := mp4.NewReader(buf)
+	if !r.Next() || r.Type() != mp4.TypeUuid {
+		t.Fatalf("first box = %s, want uuid", r.Type())
+	}
+	if r.ExtendedType() != ext || string(r.Data()) != "piff" || r.HeaderSize() != 24 {
+		t.Errorf("uuid box: type %x, data %q, header %d", r.ExtendedType(), r.Data(), r.HeaderSize())
+	}
+	b, err := r.ReadBox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := b.(*mp4.UUIDBox); u.ExtendedType != ext || string(u.Data) != "piff" {
+		t.Errorf("ReadBox = %+v", u)
+	}
+	if !r.Next() || r.ExtendedType() != [16]byte{} {
+		t.Errorf("free box extended type = %x, want zero", r.ExtendedType())
+	}
+
+	scanners := map[string]func(yield func(mp4.ScanEntry)) error{
+		"Scanner": func(yield func(mp4.ScanEntry)) error {
+			sc := mp4.NewScanner(bytes.NewReader(buf))
+			for sc.Next() {
+				yield(sc.Entry())
+			}
+			return sc.Err()
+		},
+		"StreamScanner": func(yield func(mp4.ScanEntry)) error {
+			sc := mp4.NewStreamScanner(bytes.NewReader(buf))
+			for sc.Next() {
+				yield(sc.Entry())
+			}
+			return sc.Err()
+		},
+		"ScannerAt": func(yield func(mp4.ScanEntry)) error {
+			entries, err := mp4.NewScannerAt(bytes.NewReader(buf), int64(len(buf))).Entries(nil)
+			for _, e := range entries {
+				yield(e)
+			}
+			return err
+		},
+	}
+	for name, scan := range scanners {
+		var got []mp4.ScanEntry
+		if err := scan(func(e mp4.ScanEntry) { got = append(got, e) }); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(got) != 2 || got[0].ExtendedType != ext || got[0].DataOffset() != 24 || got[1].Offset != 28 {
+			t.Errorf("%s entries = %+v", name, got)
+		}
+	}
+}
+
+func TestStz2Iter(t *testing.T) {
+	sizes := []uint16{1, 15, 7}
+	for _, fieldSize := range []uint8{4, 8, 16} {
+		w := mp4.NewGrowWriter(nil)
+		w.WriteBox(&mp4.Stz2{FieldSize: fieldSize, Entries: sizes})
+		r := mp4.NewReader(w.Bytes())
+		r.Next()
+		it := mp4.NewStz2Iter(r.Data())
+		if it.FieldSize() != fieldSize || it.Count() != 3 {
+			t.Fatalf("field size %d: got field size %d count %d", fieldSize, it.FieldSize(), it.Count())
+		}
+		for i, want := range sizes {
+			if got, ok := it.Next(); !ok || got != uint32(want) {
+				t.Errorf("field size %d: entry %d = %d, %v, want %d", fieldSize, i, got, ok, want)
+			}
+		}
+		if _, ok := it.Next(); ok {
+			t.Errorf("field size %d: iterator returned more entries than its count", fieldSize)
+		}
+	}
+}
+
+func TestIterAll(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	w.WriteStsz(0, []uint32{5, 6, 7, 8})
+	r := mp4.NewReader(w.Bytes())
+	r.Next()
+
+	// All starts where Next left off and does not move the iterator.
+	it := mp4.NewStszIter(r.Data())
+	it.Next()
+	var got []uint32
+	for i, size := range it.All() {
+		if i != len(got)+1 {
+			t.Errorf("size %d has index %d, want %d", size, i, len(got)+1)
+		}
+		got = append(got, size)
+	}
+	if !slices.Equal(got, []uint32{6, 7, 8}) {
+		t.Errorf("All = %v, want [6 7 8]", got)
+	}
+	if size, ok := it.Next(); !ok || size != 6 {
+		t.Errorf("Next after All = %d, %v, want 6", size, ok)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		for i := range it.All() {
+			if i == 2 {
+				break
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("All allocated %v times per run, want 0", allocs)
+	}
+
+	w.Reset()
+	entries := []mp4.SubsEntry{
+		{SampleDelta: 1, Subsamples: []mp4.Subsample{{Size: 10}, {Size: 20}}},
+		{SampleDelta: 2, Subsamples: []mp4.Subsample{{Size: 30}}},
+	}
+	w.WriteSubs(0, entries)
+	r = mp4.NewReader(w.Bytes())
+	r.Next()
+	subs := mp4.NewSubsIter(r.Data(), r.Version())
+	n := 0
+	for i, e := range subs.All() {
+		if e.SampleDelta != entries[i].SampleDelta || !slices.Equal(e.Subsamples, entries[i].Subsamples) {
+			t.Errorf("subs entry %d = %+v, want %+v", i, e, entries[i])
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("subs All yielded %d entries, want 2", n)
+	}
+}
+
+func TestIterRead(t *testing.T) {
+	sizes := []uint32{1, 2, 3, 4, 5, 6, 7}
+	w := mp4.NewGrowWriter(nil)
+	w.WriteStsz(0, sizes)
+	w.WriteBox(&mp4.Stz2{FieldSize: 4, Entries: []uint16{1, 2, 3, 4, 5, 6, 7}})
+	w.WriteStco(sizes)
+	w.WriteStsz(9, make([]uint32, 7))
+	r := mp4.NewReader(w.Bytes())
+
+	read := func(name string, it interface{ Read([]uint32) int }, want []uint32) {
+		t.Helper()
+		var got []uint32
+		buf := make([]uint32, 3)
+		for n := it.Read(buf); n > 0; n = it.Read(buf) {
+			got = append(got, buf[:n]...)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s Read = %v, want %v", name, got, want)
+		}
+	}
+	r.Next()
+	stsz := mp4.NewStszIter(r.Data())
+	stsz.Next()
+	read("stsz", &stsz, sizes[1:])
+	r.Next()
+	stz2 := mp4.NewStz2Iter(r.Data())
+	stz2.Next()
+	read("stz2", &stz2, sizes[1:])
+	r.Next()
+	stco := mp4.NewUint32Iter(r.Data()[:len(r.Data())-2]) // last entry cut short
+	read("stco", &stco, sizes[:6])
+	r.Next()
+	fixed := mp4.NewStszIter(r.Data())
+	read("fixed stsz", &fixed, []uint32{9, 9, 9, 9, 9, 9, 9})
+
+	w.Reset()
+	w.WriteBox(&mp4.Co64{Entries: []uint64{1 << 40, 2}})
+	r = mp4.NewReader(w.Bytes())
+	r.Next()
+	co64 := mp4.NewCo64Iter(r.Data())
+	dst := make([]uint64, 4)
+	if n := co64.Read(dst); n != 2 || dst[0] != 1<<40 || dst[1] != 2 {
+		t.Errorf("co64 Read = %d, %v", n, dst)
+	}
+}
+
+func TestTrunDefaults(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	w.WriteTfhd(mp4.TfhdDefaultBaseIsMoof|mp4.TfhdDefaultSampleDurationPresent|mp4.TfhdDefaultSampleFlagsPresent, 1, 512, 0, 0x01010000)
+	w.WriteTrun(mp4.TrunDataOffsetPresent|mp4.TrunFirstSampleFlagsPresent|mp4.TrunSampleSizePresent, 100, 0x02000000,
+		[]mp4.TrunEntry{{Size: 10}, {Size: 20}})
+	w.WriteTrun(0, 0, 0, []mp4.TrunEntry{{}}) // every field from defaults
+
+	r := mp4.NewReader(w.Bytes())
+	r.Next()
+	tfhd, err := mp4.ReadTfhdInfo(r.Data(), r.Flags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tfhd.TrackID != 1 || tfhd.DefaultSampleDuration != 512 || tfhd.DefaultSampleSize != 0 {
+		t.Errorf("tfhd = %+v", tfhd)
+	}
+	defaults := tfhd.Defaults(mp4.SampleDefaults{Duration: 1, Size: 33, Flags: 7})
+
+	var got []mp4.TrunEntry
+	for r.Next() {
+		it := mp4.NewTrunIter(r.Data(), r.Flags())
+		it.SetDefaults(defaults)
+		for e, ok := it.Next(); ok; e, ok = it.Next() {
+			got = append(got, e)
+		}
+	}
+	want := []mp4.TrunEntry{
+		{Duration: 512, Size: 10, Flags: 0x02000000},
+		{Duration: 512, Size: 20, Flags: 0x01010000},
+		{Duration: 512, Size: 33, Flags: 0x01010000},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("trun entries = %+v, want %+v", got, want)
+	}
+
+	if _, err := mp4.ReadTfhdInfo(make([]byte, 8), mp4.TfhdBaseDataOffsetPresent); !errors.Is(err, mp4.ErrShortBox) {
+		t.Errorf("ReadTfhdInfo err = %v, want ErrShortBox", err)
+	}
+}
+
+func TestSidxTree(t *testing.T) {
+	entries := make([]mp4.SidxEntry, 5)
+	for i := range entries {
+		entries[i] = mp4.SidxEntry{ReferencedSize: uint32(100 * (i + 1)), SubsegDuration: 1000, StartsWithSAP: true, SAPType: 1}
+	}
+	w := mp4.NewGrowWriter(nil)
+	w.WriteSidxTree(1, 1000, 500, entries, 2)
+	index := len(w.Bytes())
+	w.Write(make([]byte, 1500)) // media
+	file := w.Bytes()
+
+	r := mp4.NewReader(file)
+	r.Next()
+	top := mp4.NewSidxIter(r.Data(), r.Version())
+	if top.Count() != 3 || top.EarliestPresentationTime() != 500 || top.FirstOffset() != 0 {
+		t.Fatalf("top sidx: count %d, earliest %d, first offset %d", top.Count(), top.EarliestPresentationTime(), top.FirstOffset())
+	}
+	if e, _ := top.Next(); !e.ReferenceType || e.SubsegDuration != 2000 {
+		t.Errorf("first top reference = %+v, want a 2000-tick sub-sidx", e)
+	}
+
+	sc := mp4.NewScannerAt(bytes.NewReader(file), int64(len(file)))
+	for i, want := range []struct {
+		time   uint64
+		offset int64
+		size   int64
+	}{
+		{500, 0, 100},
+		{2499, 100, 200},
+		{4499, 600, 400},
+		{5499, 1000, 500},
+	} {
+		got, err := sc.LookupSidx(0, want.time)
+		if err != nil {
+			t.Fatalf("LookupSidx(%d): %v", want.time, err)
+		}
+		if got.Offset != int64(index)+want.offset || got.Size != want.size || got.IsIndex {
+			t.Errorf("%d: LookupSidx(%d) = %+v, want media at %d, size %d", i, want.time, got, int64(index)+want.offset, want.size)
+		}
+	}
+	if _, err := sc.LookupSidx(0, 5500); !errors.Is(err, mp4.ErrTimeNotIndexed) {
+		t.Errorf("LookupSidx past the end: err = %v, want ErrTimeNotIndexed", err)
+	}
+
+	// A daisy chain: each sidx indexes one 10-byte segment, then the rest.
+	const links = 20
+	w = mp4.NewGrowWriter(nil)
+	for i := range links {
+		entries := []mp4.SidxEntry{{ReferencedSize: 10, SubsegDuration: 1000}}
+		if i < links-1 {
+			rest := (links-i-2)*(56+10) + 44 + 10
+			entries = append(entries, mp4.SidxEntry{ReferenceType: true, ReferencedSize: uint32(rest), SubsegDuration: uint32(links-i-1) * 1000})
+		}
+		w.WriteBox(&mp4.Sidx{ReferenceID: 1, Timescale: 1000, EarliestPresentationTime: uint64(i) * 1000, Entries: entries})
+		w.Write(make([]byte, 10))
+	}
+	file = w.Bytes()
+	sc = mp4.NewScannerAt(bytes.NewReader(file), int64(len(file)))
+	got, err := sc.LookupSidx(0, links*1000-1)
+	if want := int64(len(file) - 10); err != nil || got.Offset != want || got.Size != 10 {
+		t.Errorf("LookupSidx at the end of a %d-link chain = %+v, %v, want media at %d", links, got, err, want)
+	}
+
+	// A reference back to the sidx itself is a cycle. FirstOffset is -52, the
+	// size of the box.
+	w = mp4.NewGrowWriter(nil)
+	w.WriteBox(&mp4.Sidx{FullHeader: mp4.FullHeader{Version: 1}, ReferenceID: 1, Timescale: 1000, FirstOffset: ^uint64(52 - 1),
+		Entries: []mp4.SidxEntry{{ReferenceType: true, ReferencedSize: 52, SubsegDuration: 1000}}})
+	file = w.Bytes()
+	sc = mp4.NewScannerAt(bytes.NewReader(file), int64(len(file)))
+	if _, err := sc.LookupSidx(0, 0); err == nil || !strings.Contains(err.Error(), "points back") {
+		t.Errorf("LookupSidx on a cyclic index: err = %v, want a reference pointing back", err)
+	}
+
+	// A size past the end of the file fails before anything is allocated.
+	file = []byte{0, 0, 0, 1, 's', 'i', 'd', 'x', 0x40, 0, 0, 0, 0, 0, 0, 0, 31: 0}
+	sc = mp4.NewScannerAt(bytes.NewReader(file), int64(len(file)))
+	if _, err := sc.LookupSidx(0, 0); !errors.Is(err, mp4.ErrInvalidBoxSize) {
+		t.Errorf("LookupSidx on largesize 1<<62: err = %v, want ErrInvalidBoxSize", err)
+	}
+}
+
+func TestSidxIterVersion0(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	w.WriteBox(&mp4.Sidx{ReferenceID: 2, Timescale: 90000, EarliestPresentationTime: 7, FirstOffset: 9,
+		Entries: []mp4.SidxEntry{{ReferencedSize: 10, SubsegDuration: 3, SAPDeltaTime: 4}}})
+	r := mp4.NewReader(w.Bytes())
+	r.Next()
+	if r.Version() != 0 {
+		t.Fatalf("version = %d, want 0 for 32-bit times", r.Version())
+	}
+	it := mp4.NewSidxIter(r.Data(), r.Version())
+	if it.ReferenceID() != 2 || it.Timescale() != 90000 || it.EarliestPresentationTime() != 7 || it.FirstOffset() != 9 {
+		t.Errorf("sidx header = %d %d %d %d", it.ReferenceID(), it.Timescale(), it.EarliestPresentationTime(), it.FirstOffset())
+	}
+	if e, ok := it.Next(); !ok || e != (mp4.SidxEntry{ReferencedSize: 10, SubsegDuration: 3, SAPDeltaTime: 4}) {
+		t.Errorf("entry = %+v, %v", e, ok)
+	}
+}
+
+func TestReaderChildren(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	w.StartBox(mp4.TypeMoov)
+	w.StartBox(mp4.TypeTrak)
+	w.StartBox(mp4.TypeMdia)
+	w.StartBox(mp4.TypeMinf)
+	w.EndBox()
+	w.EndBox()
+	w.EndBox()
+	w.StartBox(mp4.TypeStsd)
+	w.Write([]byte{0, 0, 0, 0, 0, 0, 0, 1})
+	w.StartBox(mp4.TypeFree)
+	w.EndBox()
+	w.EndBox()
+	w.StartBox(mp4.TypeUdta)
+	w.EndBox()
+	w.EndBox()
+	buf := w.Bytes()
+
+	r := mp4.NewReader(buf)
+	r.Next()
+	var got []mp4.BoxType
+	for typ := range r.Children() {
+		got = append(got, typ)
+		switch typ {
+		case mp4.TypeTrak:
+			// Left entered: Children exits before moving on.
+			r.Enter()
+			r.Next()
+			r.Enter()
+		case mp4.TypeStsd:
+			for typ := range r.Children() {
+				got = append(got, typ)
+			}
+		}
+	}
+	want := []mp4.BoxType{mp4.TypeTrak, mp4.TypeStsd, mp4.TypeFree, mp4.TypeUdta}
+	if !slices.Equal(got, want) {
+		t.Errorf("children = %v, want %v", got, want)
+	}
+	if r.Depth() != 0 || r.Next() {
+		t.Errorf("after Children: depth %d, more boxes at top level", r.Depth())
+	}
+
+	// Breaking out returns to the starting level too.
+	r = mp4.NewReader(buf)
+	r.Next()
+	for range r.Children() {
+		r.Enter()
+		break
+	}
+	if r.Depth() != 0 {
+		t.Errorf("after break: depth %d, want 0", r.Depth())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		r := mp4.NewReader(buf)
+		for r.Next() {
+			for range r.Children() {
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Children allocated %v times per run, want 0", allocs)
+	}
+}
+
+func TestFind(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	w.StartBox(mp4.TypeMoov)
+	for _, handler := range []string{"vide", "soun"} {
+		w.StartBox(mp4.TypeTrak)
+		w.StartBox(mp4.TypeMdia)
+		w.WriteHdlr([4]byte([]byte(handler)), "")
+		w.StartBox(mp4.TypeMinf)
+		w.StartBox(mp4.TypeStbl)
+		w.StartFullBox(mp4.TypeStsd, 0, 0)
+		w.Write([]byte{0, 0, 0, 1})
+		if handler == "vide" {
+			w.StartBox(mp4.TypeAvc1)
+			w.WriteVisualSampleEntry(1, 64, 64, 1, 24, "")
+			w.StartBox(mp4.TypeAvcC)
+			w.Write([]byte{1, 0x64, 0, 0x1e})
+		} else {
+			w.StartBox(mp4.TypeMp4a)
+			w.WriteAudioSampleEntry(1, 2, 16, 48000<<16)
+			w.StartFullBox(mp4.TypeEsds, 0, 0)
+			w.Write([]byte{3})
+		}
+		w.EndBox()
+		w.EndBox() // sample entry
+		w.EndBox() // stsd
+		w.EndBox() // stbl
+		w.EndBox() // minf
+		w.EndBox() // mdia
+		w.EndBox() // trak
+	}
+	w.StartBox(mp4.TypeUdta)
+	w.StartFullBox(mp4.TypeMeta, 0, 0)
+	w.StartBox(mp4.TypeIlst)
+	w.StartBox(mp4.BoxType{0xa9, 'n', 'a', 'm'})
+	w.StartBox(mp4.BoxType{'d', 'a', 't', 'a'})
+	w.Write([]byte{0, 0, 0, 1, 0, 0, 0, 0, 'x'})
+	w.EndBox()
+	w.EndBox()
+	w.EndBox()
+	w.EndBox()
+	w.EndBox()
+	w.EndBox() // moov
+	buf := w.Bytes()
+
+	m, err := mp4.Find(buf, "moov/trak/mdia/minf/stbl/stsd/*/avcC")
+	if err != nil || !bytes.Equal(m.Data, []byte{1, 0x64, 0, 0x1e}) {
+		t.Fatalf("Find avcC = %+v, %v", m, err)
+	}
+	if !bytes.Equal(buf[m.DataOffset:m.DataOffset+len(m.Data)], m.Data) || m.Offset != m.DataOffset-8 || m.Size != 12 {
+		t.Errorf("avcC match offsets = %+v", m)
+	}
+	if m, err := mp4.Find(buf, "moov/trak[1]/mdia/hdlr"); err != nil || string(m.Data[4:8]) != "soun" {
+		t.Errorf("Find trak[1] hdlr = %+v, %v", m, err)
+	}
+	if m, err := mp4.Find(buf, "moov/trak/*/*/*/stsd/mp4a/esds"); err != nil || m.Version != 0 || !bytes.Equal(m.Data, []byte{3}) {
+		t.Errorf("Find esds = %+v, %v", m, err)
+	}
+	if m, err := mp4.Find(buf, "moov/udta/meta/ilst/©nam/data"); err != nil || m.Data[len(m.Data)-1] != 'x' {
+		t.Errorf("Find ©nam = %+v, %v", m, err)
+	}
+	all, err := mp4.FindAll(buf, "moov/trak/mdia/minf/stbl/stsd/*")
+	if err != nil || len(all) != 2 || all[0].Type != mp4.TypeAvc1 || all[1].Type != mp4.TypeMp4a {
+		t.Errorf("FindAll sample entries = %+v, %v", all, err)
+	}
+	if _, err := mp4.Find(buf, "moov/trak[2]"); err != mp4.ErrBoxNotFound {
+		t.Errorf("Find trak[2] err = %v, want ErrBoxNotFound", err)
+	}
+	for _, path := range []string{"", "moov//trak", "moov/", "moov/tr", "moov/trak[x]", "moov/trak[1"} {
+		if _, err := mp4.Find(buf, path); err != mp4.ErrInvalidPath {
+			t.Errorf("Find(%q) err = %v, want ErrInvalidPath", path, err)
+		}
+	}
+
+	// Reader.Find searches below the current box without moving the reader.
+	r := mp4.NewReader(buf)
+	r.Next()
+	r.Enter()
+	r.Next()
+	if m, ok := r.Find("mdia/minf/stbl/stsd/avc1/avcC"); !ok || m.Offset != all[0].Offset+8+78 {
+		t.Errorf("Reader.Find = %+v, %v", m, ok)
+	}
+	if !r.Next() || r.Type() != mp4.TypeTrak || r.Offset() == 8 {
+		t.Errorf("reader moved: at %s offset %d", r.Type(), r.Offset())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	f, err := os.Open("video-media-samples/big-buck-bunny-480p-30sec.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := mp4.ParseTree(f, fi.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree) != 3 || tree[0].Type != mp4.TypeFtyp || tree[1].Type != mp4.TypeMoov || tree[2].Type != mp4.TypeMdat {
+		t.Fatalf("top-level boxes = %v", tree)
+	}
+	if ftyp, ok := tree[0].Box.(*mp4.Ftyp); !ok || string(ftyp.MajorBrand[:]) != "isom" {
+		t.Errorf("ftyp box = %+v", tree[0].Box)
+	}
+	moov := tree[1]
+	if mvhd, ok := moov.Children[0].Box.(*mp4.Mvhd); !ok || mvhd.Timescale != 1000 || !moov.Children[0].FullBox {
+		t.Errorf("mvhd box = %+v", moov.Children[0].Box)
+	}
+
+	// The video sample entry carries its fixed fields and its children.
+	stsd := moov.Children[1].Children[2].Children[2].Children[2].Children[0]
+	if stsd.Type != mp4.TypeStsd || len(stsd.Children) != 1 {
+		t.Fatalf("stsd = %+v", stsd)
+	}
+	avc1 := stsd.Children[0]
+	if v, ok := avc1.Box.(*mp4.VisualSampleEntry); !ok || v.Width != 854 || v.Height != 480 {
+		t.Errorf("avc1 box = %+v", avc1.Box)
+	}
+	if len(avc1.Children) == 0 || avc1.Children[0].Type != mp4.TypeAvcC || mp4.ReadAvcC(avc1.Children[0].Data) != "64001e" {
+		t.Errorf("avc1 children = %+v", avc1.Children)
+	}
+	if avc1.Offset+avc1.Size > stsd.Offset+stsd.Size || avc1.DataOffset() != avc1.Offset+8 {
+		t.Errorf("avc1 at %d size %d outside stsd at %d size %d", avc1.Offset, avc1.Size, stsd.Offset, stsd.Size)
+	}
+
+	// mdat is not loaded, but its data can still be read.
+	mdat := tree[2]
+	if mdat.Loaded() || mdat.Children != nil {
+		t.Errorf("mdat loaded")
+	}
+	body, err := mdat.Body()
+	if err != nil || int64(len(body)) != mdat.Size-int64(mdat.HeaderSize) {
+		t.Fatalf("mdat Body = %d bytes, %v", len(body), err)
+	}
+	head := make([]byte, 16)
+	if _, err := io.ReadFull(mdat.Open(), head); err != nil || !bytes.Equal(head, body[:16]) {
+		t.Errorf("mdat Open read %x, %v, want %x", head, err, body[:16])
+	}
+
+	// MaxDepth stops below moov's children, and Load can skip moov too.
+	tree, err = mp4.ParseTree(f, fi.Size(), &mp4.TreeOptions{MaxDepth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range tree[1].Children {
+		if c.Children != nil {
+			t.Errorf("%s has children past MaxDepth", c.Type)
+		}
+	}
+	tree, err = mp4.ParseTree(f, fi.Size(), &mp4.TreeOptions{
+		Load: func(e mp4.ScanEntry) bool { return e.Type == mp4.TypeFtyp },
+	})
+	if err != nil || !tree[0].Loaded() || tree[1].Loaded() || tree[1].Children != nil {
+		t.Errorf("custom Load: moov loaded %v, err %v", tree[1].Loaded(), err)
+	}
+}
+
+func TestParseTreeError(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	w.StartBox(mp4.TypeMoov)
+	w.StartFullBox(mp4.TypeMvhd, 0, 0)
+	w.Write([]byte{0, 0, 0, 0}) // truncated
+	w.EndBox()
+	w.EndBox()
+	w.StartBox(mp4.TypeFree)
+	w.EndBox()
+	buf := w.Bytes()
+
+	tree, err := mp4.ParseTree(bytes.NewReader(buf), int64(len(buf)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree) != 2 || tree[1].Type != mp4.TypeFree {
+		t.Fatalf("tree = %v", tree)
+	}
+	mvhd := tree[0].Children[0]
+	pe, ok := errors.AsType[*mp4.ParseError](mvhd.Err)
+	if !ok || mvhd.Box != nil || pe.Offset != 8 || pe.Path != "moov/mvhd" {
+		t.Errorf("mvhd Err = %v, Box = %v", mvhd.Err, mvhd.Box)
+	}
+
+	// Sizes past the end of the file fail before anything is allocated.
+	for _, hdr := range [][]byte{
+		{0, 0, 0, 1, 'm', 'o', 'o', 'v', 0x40, 0, 0, 0, 0, 0, 0, 0}, // largesize 1<<62
+		{0xff, 0xff, 0xff, 0xf0, 'm', 'o', 'o', 'v'},
+	} {
+		data := append(hdr, make([]byte, 32-len(hdr))...)
+		tree, err := mp4.ParseTree(bytes.NewReader(data), int64(len(data)), nil)
+		if len(tree) != 0 || !errors.Is(err, mp4.ErrInvalidBoxSize) {
+			t.Errorf("header % x: tree %v, err %v, want ErrInvalidBoxSize", hdr, tree, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package mp4
+
+// Grouping types of the sample groups the package decodes. They appear in
+// sbgp and sgpd boxes.
+var (
+	GroupingRoll = [4]byte{'r', 'o', 'l', 'l'} // Roll recovery (AAC priming, open GOP)
+	GroupingProl = [4]byte{'p', 'r', 'o', 'l'} // Pre-roll
+	GroupingRap  = [4]byte{'r', 'a', 'p', ' '} // Random access point
+	GroupingSync = [4]byte{'s', 'y', 'n', 'c'} // Sync sample NAL unit type
+	GroupingSeig = [4]byte{'s', 'e', 'i', 'g'} // CENC sample encryption
+	GroupingTele = [4]byte{'t', 'e', 'l', 'e'} // Temporal level
+)
+
+// RollEntry is a roll or prol sample group description. RollDistance counts
+// the samples to decode before the group's samples display correctly;
+// negative values count backwards, as AAC priming does.
+type RollEntry struct {
+	RollDistance int16
+}
+
+// ReadRollEntry parses a roll or prol description. It returns [ErrShortBox]
+// if data is shorter than 2 bytes.
+func ReadRollEntry(data []byte) (RollEntry, error) {
+	if len(data) < 2 {
+		return RollEntry{}, ErrShortBox
+	}
+	return RollEntry{RollDistance: int16(be.Uint16(data))}, nil
+}
+
+// Append appends the encoded description to b.
+func (e RollEntry) Append(b []byte) []byte {
+	return be.AppendUint16(b, uint16(e.RollDistance))
+}
+
+// RapEntry is a rap description, marking open-GOP random access points.
+// NumLeadingSamples counts the samples after the access point that cannot be
+// decoded when decoding starts there.
+type RapEntry struct {
+	NumLeadingSamplesKnown bool
+	NumLeadingSamples      uint8 // 7 bits
+}
+
+// ReadRapEntry parses a rap description. It returns [ErrShortBox] if data is
+// empty.
+func ReadRapEntry(data []byte) (RapEntry, error) {
+	if len(data) < 1 {
+		return RapEntry{}, ErrShortBox
+	}
+	return RapEntry{
+		NumLeadingSamplesKnown: data[0]&0x80 != 0,
+		NumLeadingSamples:      data[0] & 0x7f,
+	}, nil
+}
+
+// Append appends the encoded description to b.
+func (e RapEntry) Append(b []byte) []byte {
+	return append(b, bit(e.NumLeadingSamplesKnown, 7)|e.NumLeadingSamples&0x7f)
+}
+
+// SyncEntry is a sync description. NALUnitType is the NAL unit type of the
+// group's sync samples, such as CRA or IDR for HEVC.
+type SyncEntry struct {
+	NALUnitType uint8 // 6 bits
+}
+
+// ReadSyncEntry parses a sync description. It returns [ErrShortBox] if data
+// is empty.
+func ReadSyncEntry(data []byte) (SyncEntry, error) {
+	if len(data) < 1 {
+		return SyncEntry{}, ErrShortBox
+	}
+	return SyncEntry{NALUnitType: data[0] & 0x3f}, nil
+}
+
+// Append appends the encoded description to b.
+func (e SyncEntry) Append(b []byte) []byte {
+	return append(b, e.NALUnitType&0x3f)
+}
+
+// SeigEntry is a seig description: the Common Encryption parameters of the
+// group's samples. ConstantIV is set only for protected groups with no
+// per-sample IV.
+type SeigEntry struct {
+	CryptByteBlock  uint8 // 4 bits; pattern encryption only
+	SkipByteBlock   uint8 // 4 bits; pattern encryption only
+	IsProtected     bool
+	PerSampleIVSize uint8
+	KID             [16]byte
+	ConstantIV      []byte
+}
+
+// ReadSeigEntry parses a seig description. It returns [ErrShortBox] if data
+// is truncated.
+func ReadSeigEntry(data []byte) (SeigEntry, error) {
+	if len(data) < 20 {
+		return SeigEntry{}, ErrShortBox
+	}
+	e := SeigEntry{
+		CryptByteBlock:  data[1] >> 4,
+		SkipByteBlock:   data[1] & 0x0f,
+		IsProtected:     data[2] == 1,
+		PerSampleIVSize: data[3],
+	}
+	copy(e.KID[:], data[4:20])
+	if e.IsProtected && e.PerSampleIVSize == 0 {
+		if len(data) < 21 || len(data) < 21+int(data[20]) {
+			return SeigEntry{}, ErrShortBox
+		}
+		e.ConstantIV = data[21 : 21+int(data[20])]
+	}
+	return e, nil
+}
+
+// Append appends the encoded description to b.
+func (e SeigEntry) Append(b []byte) []byte {
+	b = append(b, 0, e.CryptByteBlock<<4|e.SkipByteBlock&0x0f, bit(e.IsProtected, 0), e.PerSampleIVSize)
+	b = append(b, e.KID[:]...)
+	if e.IsProtected && e.PerSampleIVSize == 0 {
+		b = append(b, byte(len(e.ConstantIV)))
+		b = append(b, e.ConstantIV...)
+	}
+	return b
+}
+
+// TeleEntry is a tele description. LevelIndependentlyDecodable reports
+// whether the group's samples depend only on samples of the same or lower
+// temporal levels.
+type TeleEntry struct {
+	LevelIndependentlyDecodable bool
+}
+
+// ReadTeleEntry parses a tele description. It returns [ErrShortBox] if data
+// is empty.
+func ReadTeleEntry(data []byte) (TeleEntry, error) {
+	if len(data) < 1 {
+		return TeleEntry{}, ErrShortBox
+	}
+	return TeleEntry{LevelIndependentlyDecodable: data[0]&0x80 != 0}, nil
+}
+
+// Append appends the encoded description to b.
+func (e TeleEntry) Append(b []byte) []byte {
+	return append(b, bit(e.LevelIndependentlyDecodable, 7))
+}
@@ -7,7 +7,11 @@ type ScanEntry struct {
 	Type       BoxType
 	Size       int64 // total box size including header
 	Offset     int64 // byte offset from start of stream
-	HeaderSize int   // header size (8 or 16 bytes)
+	HeaderSize int   // header size (8 or 16 bytes, plus 16 for uuid boxes)
+
+	// ExtendedType is the 16-byte extended type of a uuid box, which is part
+	// of its header. It is zero for other boxes.
+	ExtendedType [16]byte
 }
 
 // DataSize returns the size of the box data (excluding the header).
@@ -71,55 +75,67 @@ func (s *Scanner) Next() bool {
 	}
 
 	boxStart := s.pos
-	size := int64(be.Uint32(s.hdr[:4]))
-	var t BoxType
-	copy(t[:], s.hdr[4:8])
-
+	t, size := parseScanHeader(s.hdr[:8])
 	headerSize := 8
 
 	if size == 1 {
 		// Extended 64-bit size
 		_, err = io.ReadFull(s.rs, s.hdr[8:16])
 		if err != nil {
-			s.err = err
+			s.err = newScanError(t, boxStart, err)
 			return false
 		}
 		size = int64(be.Uint64(s.hdr[8:16]))
 		headerSize = 16
 	}
 
+	var ext [16]byte
+	if t == TypeUuid {
+		if _, err := io.ReadFull(s.rs, ext[:]); err != nil {
+			s.err = newScanError(t, boxStart, err)
+			return false
+		}
+		headerSize += uuidSize
+	}
+
+	if size != 0 && size < int64(headerSize) {
+		s.err = newScanError(t, boxStart, ErrInvalidBoxSize)
+		return false
+	}
+
 	if size == 0 {
 		// Box extends to end of file; determine remaining size
 		cur, err := s.rs.Seek(0, io.SeekCurrent)
 		if err != nil {
-			s.err = err
+			s.err = newScanError(t, boxStart, err)
 			return false
 		}
 		end, err := s.rs.Seek(0, io.SeekEnd)
 		if err != nil {
-			s.err = err
+			s.err = newScanError(t, boxStart, err)
 			return false
 		}
 		size = end - boxStart
 		// Seek back to where we were
 		if _, err := s.rs.Seek(cur, io.SeekStart); err != nil {
-			s.err = err
+			s.err = newScanError(t, boxStart, err)
 			return false
 		}
 	}
 
 	s.entry = ScanEntry{
-		Type:       t,
-		Size:       size,
-		Offset:     boxStart,
-		HeaderSize: headerSize,
+		Type:         t,
+		Size:         size,
+		Offset:       boxStart,
+		HeaderSize:   headerSize,
+		ExtendedType: ext,
 	}
 
 	// Skip past this box's data to position for the next call
 	dataSize := size - int64(headerSize)
 	if dataSize > 0 {
 		if _, err := s.rs.Seek(dataSize, io.SeekCurrent); err != nil {
-			s.err = err
+			s.err = newScanError(t, boxStart, err)
 			return false
 		}
 	}
@@ -133,11 +149,27 @@ func (s *Scanner) Entry() ScanEntry {
 	return s.entry
 }
 
-// Err returns the first non-EOF error encountered by the Scanner.
+// Err returns the first non-EOF error encountered by the Scanner. Errors tied
+// to a box are reported as a [*ParseError].
 func (s *Scanner) Err() error {
 	return s.err
 }
 
+// parseScanHeader decodes the type and 32-bit size field of an 8-byte box
+// header. A size of 1 means a 64-bit size follows, and 0 means the box extends
+// to the end of the stream.
+func parseScanHeader(hdr []byte) (BoxType, int64) {
+	var t BoxType
+	copy(t[:], hdr[4:8])
+	return t, int64(be.Uint32(hdr[:4]))
+}
+
+// newScanError wraps err in a [*ParseError] for the top-level box of type t
+// starting at offset.
+func newScanError(t BoxType, offset int64, err error) error {
+	return &ParseError{Path: t.String(), Offset: offset, Type: t, Err: err}
+}
+
 // ReadBody reads the current box's data (excluding header) into buf.
 // buf must be exactly DataSize() bytes. The scanner seeks to the data
 // position, reads, then seeks back so that subsequent Next calls work correctly.
@@ -148,15 +180,15 @@ func (s *Scanner) ReadBody(buf []byte) error {
 	saved := s.pos
 
 	if _, err := s.rs.Seek(dataOffset, io.SeekStart); err != nil {
-		return err
+		return newScanError(s.entry.Type, s.entry.Offset, err)
 	}
 	if _, err := io.ReadFull(s.rs, buf); err != nil {
-		return err
+		return newScanError(s.entry.Type, s.entry.Offset, err)
 	}
 
 	// Restore position
 	if _, err := s.rs.Seek(saved, io.SeekStart); err != nil {
-		return err
+		return newScanError(s.entry.Type, s.entry.Offset, err)
 	}
 	return nil
 }
@@ -167,14 +199,14 @@ func (s *Scanner) ReadBox(buf []byte) error {
 	saved := s.pos
 
 	if _, err := s.rs.Seek(s.entry.Offset, io.SeekStart); err != nil {
-		return err
+		return newScanError(s.entry.Type, s.entry.Offset, err)
 	}
 	if _, err := io.ReadFull(s.rs, buf); err != nil {
-		return err
+		return newScanError(s.entry.Type, s.entry.Offset, err)
 	}
 
 	if _, err := s.rs.Seek(saved, io.SeekStart); err != nil {
-		return err
+		return newScanError(s.entry.Type, s.entry.Offset, err)
 	}
 	return nil
 }
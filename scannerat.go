@@ -0,0 +1,143 @@
+package mp4
+
+import "io"
+
+// ScannerAt locates top-level boxes in an [io.ReaderAt] of known size. Unlike
+// [Scanner] it keeps no read position: every method takes the offset or entry
+// it works on, so a single ScannerAt may be shared by any number of goroutines
+// as long as the underlying ReadAt is safe for concurrent use, as it is for
+// [*os.File].
+//
+// Typical usage:
+//
+//	f, _ := os.Open("video.mp4")
+//	fi, _ := f.Stat()
+//	sc := mp4.NewScannerAt(f, fi.Size())
+//	for off := int64(0); ; {
+//	    e, err := sc.EntryAt(off)
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    if err != nil { ... }
+//	    if e.Type == mp4.TypeMoov {
+//	        buf := make([]byte, e.DataSize())
+//	        if err := sc.ReadBody(e, buf); err != nil { ... }
+//	        // parse moov contents...
+//	    }
+//	    off = e.Offset + e.Size
+//	}
+type ScannerAt struct {
+	ra   io.ReaderAt
+	size int64
+}
+
+// NewScannerAt creates a ScannerAt that reads boxes from the first size bytes
+// of ra.
+func NewScannerAt(ra io.ReaderAt, size int64) ScannerAt {
+	return ScannerAt{ra: ra, size: size}
+}
+
+// Size returns the size of the underlying data.
+func (s ScannerAt) Size() int64 {
+	return s.size
+}
+
+// EntryAt reads the header of the top-level box starting at offset. Returns
+// [io.EOF] when fewer than 8 bytes remain, which is how iteration ends. A box
+// whose size field is 0 is reported as extending to Size; one whose size is
+// smaller than its header or runs past Size is reported as
+// [ErrInvalidBoxSize], so its size is safe to allocate.
+func (s ScannerAt) EntryAt(offset int64) (ScanEntry, error) {
+	if offset < 0 || s.size-offset < 8 {
+		return ScanEntry{}, io.EOF
+	}
+	var hdr [16]byte
+	if err := s.readFull(hdr[:8], offset); err != nil {
+		return ScanEntry{}, err
+	}
+
+	t, size := parseScanHeader(hdr[:8])
+	headerSize := 8
+
+	if size == 1 {
+		// Extended 64-bit size
+		if err := s.readFull(hdr[8:16], offset+8); err != nil {
+			return ScanEntry{}, newScanError(t, offset, err)
+		}
+		size = int64(be.Uint64(hdr[8:16]))
+		headerSize = 16
+	}
+
+	var ext [16]byte
+	if t == TypeUuid {
+		if err := s.readFull(ext[:], offset+int64(headerSize)); err != nil {
+			return ScanEntry{}, newScanError(t, offset, err)
+		}
+		headerSize += uuidSize
+	}
+
+	if size == 0 {
+		size = s.size - offset
+	}
+	if size < int64(headerSize) || size > s.size-offset {
+		return ScanEntry{}, newScanError(t, offset, ErrInvalidBoxSize)
+	}
+
+	return ScanEntry{
+		Type:         t,
+		Size:         size,
+		Offset:       offset,
+		HeaderSize:   headerSize,
+		ExtendedType: ext,
+	}, nil
+}
+
+// Entries appends every top-level box entry to dst and returns the extended
+// slice. Pass a reused slice with spare capacity to avoid allocation.
+func (s ScannerAt) Entries(dst []ScanEntry) ([]ScanEntry, error) {
+	for off := int64(0); ; {
+		e, err := s.EntryAt(off)
+		if err == io.EOF {
+			return dst, nil
+		}
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, e)
+		off = e.Offset + e.Size
+	}
+}
+
+// ReadBody reads the data (excluding header) of the box described by e into
+// buf. buf must be exactly e.DataSize() bytes.
+func (s ScannerAt) ReadBody(e ScanEntry, buf []byte) error {
+	if err := s.readFull(buf, e.DataOffset()); err != nil {
+		return newScanError(e.Type, e.Offset, err)
+	}
+	return nil
+}
+
+// ReadBox reads the full data (including header) of the box described by e
+// into buf. buf must be exactly e.Size bytes.
+func (s ScannerAt) ReadBox(e ScanEntry, buf []byte) error {
+	if err := s.readFull(buf, e.Offset); err != nil {
+		return newScanError(e.Type, e.Offset, err)
+	}
+	return nil
+}
+
+// readFull fills buf from offset. A read that runs past Size or the end of the
+// underlying data is reported as [io.ErrUnexpectedEOF].
+func (s ScannerAt) readFull(buf []byte, offset int64) error {
+	if offset < 0 || int64(len(buf)) > s.size-offset {
+		return io.ErrUnexpectedEOF
+	}
+	n, err := s.ra.ReadAt(buf, offset)
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package mp4
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTimeNotIndexed is returned by [ScannerAt.LookupSidx] when no reference
+// of the segment index covers the requested time.
+var ErrTimeNotIndexed = errors.New("mp4: time not covered by segment index")
+
+// SidxRange is the run of bytes one sidx reference points at and the
+// presentation time it covers.
+type SidxRange struct {
+	Offset   int64  // file offset of the first byte
+	Size     int64  // size in bytes
+	Time     uint64 // earliest presentation time, in the index's timescale
+	Duration uint64 // in the index's timescale
+	IsIndex  bool   // the range starts with a sub-sidx rather than media
+}
+
+// ReadSidx parses sidx box data with the given version.
+func ReadSidx(data []byte, version uint8) (Sidx, error) {
+	var b Sidx
+	err := b.Decode(data, version, 0)
+	return b, err
+}
+
+// Lookup returns the reference that covers presentation time t, in the
+// index's timescale. anchor is the file offset of the first byte after the
+// sidx box, from which FirstOffset counts. It returns false if t falls before
+// the first reference or after the last.
+func (b *Sidx) Lookup(t uint64, anchor int64) (SidxRange, bool) {
+	r := SidxRange{
+		Offset: anchor + int64(b.FirstOffset),
+		Time:   b.EarliestPresentationTime,
+	}
+	if t < r.Time {
+		return SidxRange{}, false
+	}
+	for _, e := range b.Entries {
+		r.Size = int64(e.ReferencedSize)
+		r.Duration = uint64(e.SubsegDuration)
+		r.IsIndex = e.ReferenceType
+		if t < r.Time+r.Duration {
+			return r, true
+		}
+		r.Offset += r.Size
+		r.Time += r.Duration
+	}
+	return SidxRange{}, false
+}
+
+// LookupSidx resolves presentation time t, in the timescale of the sidx box
+// at offset, to the media subsegment that contains it. It follows references
+// to sub-sidx boxes down a hierarchical or daisy-chained index, reading only
+// the boxes on the way, however long the chain. Each sub-sidx must lie after
+// the sidx that references it, so a cyclic index is an error rather than an
+// endless walk. It returns [ErrTimeNotIndexed] if no reference covers t.
+func (s ScannerAt) LookupSidx(offset int64, t uint64) (SidxRange, error) {
+	for {
+		e, err := s.EntryAt(offset)
+		if err != nil {
+			return SidxRange{}, err
+		}
+		if e.Type != TypeSidx {
+			return SidxRange{}, newScanError(e.Type, offset, fmt.Errorf("sidx reference points at a %s box", e.Type))
+		}
+		buf := make([]byte, e.DataSize())
+		if err := s.ReadBody(e, buf); err != nil {
+			return SidxRange{}, err
+		}
+		if len(buf) < 4 {
+			return SidxRange{}, newScanError(e.Type, offset, ErrShortBox)
+		}
+		b, err := ReadSidx(buf[4:], buf[0])
+		if err != nil {
+			return SidxRange{}, newScanError(e.Type, offset, err)
+		}
+		r, ok := b.Lookup(t, offset+e.Size)
+		if !ok {
+			return SidxRange{}, ErrTimeNotIndexed
+		}
+		if !r.IsIndex {
+			return r, nil
+		}
+		if r.Offset <= offset {
+			return SidxRange{}, newScanError(e.Type, offset, fmt.Errorf("sidx reference points back to offset %d", r.Offset))
+		}
+		offset = r.Offset
+	}
+}
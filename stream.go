@@ -0,0 +1,152 @@
+package mp4
+
+import (
+	"io"
+	"math"
+)
+
+// StreamScanner reads top-level boxes from a plain [io.Reader], such as a pipe,
+// socket, or HTTP response body. Unlike [Scanner] it never seeks: each box body
+// is exposed as a bounded reader, and whatever the caller leaves unread is
+// discarded when Next advances to the following box.
+//
+// Typical usage:
+//
+//	sc := mp4.NewStreamScanner(os.Stdin)
+//	for sc.Next() {
+//	    e := sc.Entry()
+//	    if e.Type == mp4.TypeMoov {
+//	        buf := make([]byte, e.DataSize())
+//	        if err := sc.ReadBody(buf); err != nil { ... }
+//	        // parse moov contents...
+//	    }
+//	}
+//	if err := sc.Err(); err != nil { ... }
+//
+// A box whose size field is 0 extends to the end of the stream. Its entry has
+// a Size of 0, its body reads until the stream ends, and it is always the last
+// box returned.
+type StreamScanner struct {
+	r     io.Reader
+	hdr   [32]byte // header bytes of the current box
+	entry ScanEntry
+	body  io.LimitedReader // unread part of the current box body
+	toEnd bool             // current box extends to the end of the stream
+	err   error
+	pos   int64 // stream position of the next box header
+}
+
+// NewStreamScanner creates a StreamScanner that reads boxes from r.
+func NewStreamScanner(r io.Reader) StreamScanner {
+	return StreamScanner{r: r}
+}
+
+// Reset discards all state and prepares the StreamScanner to read from r.
+func (s *StreamScanner) Reset(r io.Reader) {
+	*s = StreamScanner{r: r}
+}
+
+// Next discards the unread body of the current box and advances to the next
+// top-level box. Returns false when the stream ends or an error occurs. Check
+// Err after the loop.
+func (s *StreamScanner) Next() bool {
+	if s.err != nil || s.toEnd {
+		return false
+	}
+	if s.body.N > 0 {
+		_, err := io.Copy(io.Discard, &s.body)
+		if err == nil && s.body.N > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			s.err = newScanError(s.entry.Type, s.entry.Offset, err)
+			return false
+		}
+	}
+
+	_, err := io.ReadFull(s.r, s.hdr[:8])
+	if err != nil {
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.err = err
+		}
+		return false
+	}
+
+	boxStart := s.pos
+	t, size := parseScanHeader(s.hdr[:8])
+	headerSize := 8
+	if size == 1 {
+		if _, err := io.ReadFull(s.r, s.hdr[8:16]); err != nil {
+			s.err = newScanError(t, boxStart, err)
+			return false
+		}
+		size = int64(be.Uint64(s.hdr[8:16]))
+		headerSize = 16
+	}
+	var ext [16]byte
+	if t == TypeUuid {
+		if _, err := io.ReadFull(s.r, s.hdr[headerSize:headerSize+uuidSize]); err != nil {
+			s.err = newScanError(t, boxStart, err)
+			return false
+		}
+		copy(ext[:], s.hdr[headerSize:])
+		headerSize += uuidSize
+	}
+
+	if size == 0 {
+		s.toEnd = true
+		s.body = io.LimitedReader{R: s.r, N: math.MaxInt64}
+	} else {
+		if size < int64(headerSize) {
+			s.err = newScanError(t, boxStart, ErrInvalidBoxSize)
+			return false
+		}
+		s.body = io.LimitedReader{R: s.r, N: size - int64(headerSize)}
+	}
+
+	s.entry = ScanEntry{
+		Type:         t,
+		Size:         size,
+		Offset:       boxStart,
+		HeaderSize:   headerSize,
+		ExtendedType: ext,
+	}
+	s.pos = boxStart + size
+	return true
+}
+
+// Entry returns the current box entry. Only valid after Next returns true.
+func (s *StreamScanner) Entry() ScanEntry {
+	return s.entry
+}
+
+// Err returns the first non-EOF error encountered by the StreamScanner.
+// Errors tied to a box are reported as a [*ParseError].
+func (s *StreamScanner) Err() error {
+	return s.err
+}
+
+// Body returns a reader over the unread part of the current box's data. It
+// returns [io.EOF] at the end of the box. The reader is valid until the next
+// call to Next.
+func (s *StreamScanner) Body() io.Reader {
+	return &s.body
+}
+
+// ReadBody reads the current box's data (excluding header) into buf. buf must
+// be exactly DataSize() bytes, and no part of the body may have been read
+// through Body.
+func (s *StreamScanner) ReadBody(buf []byte) error {
+	if _, err := io.ReadFull(&s.body, buf); err != nil {
+		return newScanError(s.entry.Type, s.entry.Offset, err)
+	}
+	return nil
+}
+
+// ReadBox reads the current box's full data (including header) into buf. buf
+// must be exactly Size bytes, and no part of the body may have been read
+// through Body.
+func (s *StreamScanner) ReadBox(buf []byte) error {
+	n := copy(buf, s.hdr[:s.entry.HeaderSize])
+	return s.ReadBody(buf[n:])
+}
@@ -54,6 +54,73 @@ func BenchmarkParseTracks(b *testing.B) {
 	}
 }
 
+// longMoov builds the moov of a three-hour, 30 fps video track with sizes,
+// composition offsets and keyframes that vary from sample to sample.
+func longMoov() []byte {
+	const n = 3 * 60 * 60 * 30
+	sizes := make([]uint32, n)
+	ctts := make([]mp4.CttsEntry, n)
+	var sync []uint32
+	for i := range sizes {
+		sizes[i] = uint32(1000 + i%977)
+		ctts[i] = mp4.CttsEntry{Count: 1, Offset: int32(i%3) * 1000}
+		if i%60 == 0 {
+			sync = append(sync, uint32(i+1))
+		}
+	}
+	offsets := make([]uint64, n/10)
+	for i := range offsets {
+		offsets[i] = uint64(i) * 20000
+	}
+
+	w := mp4.NewGrowWriter(nil)
+	w.StartBox(mp4.TypeMoov)
+	w.WriteMvhd(1000, n*1000/30, 2)
+	w.StartBox(mp4.TypeTrak)
+	w.WriteTkhd(3, 1, n*1000/30, 1920<<16, 1080<<16)
+	w.StartBox(mp4.TypeMdia)
+	w.WriteMdhd(30000, n*1000, "und")
+	w.WriteHdlr([4]byte{'v', 'i', 'd', 'e'}, "VideoHandler")
+	w.StartBox(mp4.TypeMinf)
+	w.WriteVmhd()
+	w.StartBox(mp4.TypeStbl)
+	w.StartFullBox(mp4.TypeStsd, 0, 0)
+	w.Write([]byte{0, 0, 0, 1})
+	w.StartBox(mp4.TypeAvc1)
+	w.WriteVisualSampleEntry(1, 1920, 1080, 1, 24, "")
+	w.StartBox(mp4.TypeAvcC)
+	w.Write([]byte{1, 0x64, 0x00, 0x28, 0xff, 0xe0, 0x00})
+	w.EndBox() // avcC
+	w.EndBox() // avc1
+	w.EndBox() // stsd
+	w.WriteStts([]mp4.SttsEntry{{Count: n, Duration: 1000}})
+	w.WriteCtts(ctts)
+	w.WriteStss(sync)
+	w.WriteStsc([]mp4.StscEntry{{FirstChunk: 1, SamplesPerChunk: 10, SampleDescriptionId: 1}})
+	w.WriteStsz(0, sizes)
+	w.WriteBox(&mp4.Co64{Entries: offsets})
+	w.EndBox() // stbl
+	w.EndBox() // minf
+	w.EndBox() // mdia
+	w.EndBox() // trak
+	w.EndBox() // moov
+	return w.Bytes()
+}
+
+func BenchmarkParseTracksLong(b *testing.B) {
+	moov := longMoov()
+	b.SetBytes(int64(len(moov)))
+	b.ReportAllocs()
+	var tracks []*track.Track
+	for b.Loop() {
+		var err error
+		tracks, _, err = track.ParseTracksInto(tracks, moov)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkParseTracksAndCodec(b *testing.B) {
 	for _, path := range benchFiles {
 		moov := loadMoov(b, path)
@@ -0,0 +1,107 @@
+package track
+
+import (
+	"slices"
+
+	"github.com/tetsuo/mp4"
+)
+
+// groupBox is the data and version of an sbgp or sgpd box.
+type groupBox struct {
+	data    []byte
+	version uint8
+}
+
+// groupingType returns the grouping type the box starts with, or zero.
+func (b groupBox) groupingType() (t [4]byte) {
+	copy(t[:], b.data)
+	return t
+}
+
+// SampleGroup maps the samples of a track to the sample group descriptions of
+// one grouping type, such as roll or rap.
+type SampleGroup struct {
+	GroupingType          [4]byte
+	GroupingTypeParameter uint32
+
+	// Descriptions holds the undecoded sgpd entries; description index i
+	// refers to Descriptions[i-1]. See [mp4.ReadRollEntry] and the other
+	// Read*Entry functions to decode them.
+	Descriptions [][]byte
+
+	// DefaultIndex is the description index of samples that no sbgp entry
+	// maps, or 0 if they belong to no group. Samples mapped to index 0 belong
+	// to no group regardless.
+	DefaultIndex uint32
+
+	runEnd   []uint32 // sample number one past the end of each run
+	runIndex []uint32 // description index of each run
+}
+
+// SampleGroup returns the samples' grouping for groupingType, or nil if the
+// track has neither an sbgp nor an sgpd box of that type.
+func (t *Track) SampleGroup(groupingType [4]byte) *SampleGroup {
+	var g *SampleGroup
+	for _, b := range t.raw.sgpd {
+		if b.groupingType() != groupingType {
+			continue
+		}
+		it := mp4.NewSgpdIter(b.data, b.version)
+		g = &SampleGroup{
+			GroupingType: groupingType,
+			Descriptions: make([][]byte, 0, min(it.Count(), uint32(len(b.data)))),
+			DefaultIndex: it.DefaultSampleDescriptionIndex(),
+		}
+		for _, e := range it.All() {
+			g.Descriptions = append(g.Descriptions, e)
+		}
+		break
+	}
+	for _, b := range t.raw.sbgp {
+		if b.groupingType() != groupingType {
+			continue
+		}
+		it := mp4.NewSbgpIter(b.data, b.version)
+		if g == nil {
+			g = &SampleGroup{GroupingType: groupingType}
+		}
+		g.GroupingTypeParameter = it.GroupingTypeParameter()
+		n := min(it.Count(), uint32(len(b.data)/8))
+		g.runEnd = make([]uint32, 0, n)
+		g.runIndex = make([]uint32, 0, n)
+		var end uint32
+		for _, e := range it.All() {
+			if e.SampleCount == 0 {
+				continue
+			}
+			end += e.SampleCount
+			g.runEnd = append(g.runEnd, end)
+			g.runIndex = append(g.runIndex, e.GroupDescriptionIndex)
+		}
+		break
+	}
+	return g
+}
+
+// Index returns the 1-based description index of the given sample (0-based,
+// as in Track.Samples), or 0 if the sample belongs to no group.
+func (g *SampleGroup) Index(sample int) uint32 {
+	if sample < 0 {
+		return 0
+	}
+	i, _ := slices.BinarySearch(g.runEnd, uint32(sample)+1)
+	if i == len(g.runEnd) {
+		return g.DefaultIndex
+	}
+	return g.runIndex[i]
+}
+
+// Description returns the undecoded description of the group the given
+// sample belongs to, or nil if it belongs to none.
+func (g *SampleGroup) Description(sample int) []byte {
+	idx := g.Index(sample)
+	if idx == 0 || int(idx) > len(g.Descriptions) {
+		return nil
+	}
+	return g.Descriptions[idx-1]
+}
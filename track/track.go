@@ -3,6 +3,8 @@ package track
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/tetsuo/mp4"
 )
@@ -35,17 +37,37 @@ type trackRaw struct {
 	hasElst       bool
 
 	// Raw sample table data.
-	stszData    []byte
+	stszData    []byte // stsz, or stz2 if hasStz2
 	sttsData    []byte
 	stscData    []byte
 	cttsData    []byte
 	cttsVersion uint8
 	stssData    []byte
+	sdtpData    []byte
 	stcoData    []byte
 	co64Data    []byte
 	hasCo64     bool
+	hasStz2     bool
 	sampleCount uint32
 
+	// Sample group boxes, one per grouping type.
+	sbgp []groupBox
+	sgpd []groupBox
+
+	// Sub-sample information from the first subs box, decoded by parseSamples.
+	subsData    []byte
+	subsVersion uint8
+	subsFlags   uint32
+	subsSample  []uint32          // 0-based sample number of each entry, ascending
+	subsEntries [][]mp4.Subsample // subsamples of each entry
+
+	// Box positions within the moov buffer, for error reporting.
+	trakIndex  int // position among the moov's trak boxes, or -1 if alone
+	stblOffset int
+	stszOffset int
+	sttsOffset int
+	stscOffset int
+
 	// Codec string builder buffer.
 	codecBuf [24]byte
 	codecLen uint8
@@ -58,6 +80,26 @@ type Track struct {
 	TimeScale uint32
 	Duration  uint64
 
+	// CreationTime and ModificationTime come from the track header; they are
+	// zero when the file leaves them unset.
+	CreationTime     time.Time
+	ModificationTime time.Time
+
+	// AlternateGroup is non-zero when the track is one of several
+	// alternatives, such as audio tracks in different languages, of which a
+	// player presents only one.
+	AlternateGroup int16
+
+	// Matrix is the track header's transformation matrix. Phones record
+	// rotated video by setting it; see [Track.Rotation].
+	Matrix mp4.Matrix
+
+	// Language is the ISO-639-2/T code from the media header, such as "eng",
+	// or "und" when undetermined. ExtendedLanguage is the BCP 47 tag from the
+	// elng box, such as "en-US", or "" if the track has none.
+	Language         string
+	ExtendedLanguage string
+
 	Width        uint16
 	Height       uint16
 	ChannelCount uint16
@@ -72,6 +114,15 @@ type Track struct {
 // Codec returns the MIME codec string (e.g. "avc1.64001e", "mp4a.40.2").
 func (t *Track) Codec() string { return string(t.raw.codecBuf[:t.raw.codecLen]) }
 
+// PreferredLanguage returns the most specific language of the track: the
+// elng tag if there is one, and the mdhd code otherwise.
+func (t *Track) PreferredLanguage() string {
+	if t.ExtendedLanguage != "" {
+		return t.ExtendedLanguage
+	}
+	return t.Language
+}
+
 // StsdRaw returns the raw stsd box data (entire box including header).
 func (t *Track) StsdRaw() []byte { return t.raw.stsd }
 
@@ -109,6 +160,12 @@ func (t *Track) EditMediaTime() (int64, bool) {
 	return t.raw.elstMediaTime, t.raw.hasElst
 }
 
+// Rotation returns the clockwise rotation in degrees that the track's matrix
+// applies when the video is displayed, and whether it mirrors the video.
+func (t *Track) Rotation() (degrees int, flipped bool) {
+	return t.Matrix.Rotation()
+}
+
 // FindTrack returns the track with the given ID, or nil.
 func FindTrack(tracks []*Track, id uint32) *Track {
 	for _, t := range tracks {
@@ -178,11 +235,27 @@ func (t *Track) appendAv1CProfile(d []byte) {
 }
 
 // appendEsdsCodec appends ".OTI.audioConfig" to the codec buffer from esds data.
+// For MPEG-4 audio, the AudioSpecificConfig also gives the output sample rate
+// and channel count, which override those of the sample entry. The
+// DecoderSpecificInfo of other object types, such as Vorbis, is not one.
 func (t *Track) appendEsdsCodec(data []byte) {
-	oti, audioConfig := parseEsds(data)
-	if oti == 0 {
+	es, err := mp4.ReadESDescriptor(data)
+	oti := es.DecoderConfig.ObjectTypeIndication
+	if err != nil || oti == 0 {
 		return
 	}
+	var audioConfig byte
+	if oti == mp4.ObjectTypeMPEG4Audio {
+		if asc, err := mp4.ReadAudioSpecificConfig(es.DecoderConfig.DecoderSpecificInfo); err == nil {
+			audioConfig = asc.CodecObjectType()
+			if rate := asc.OutputSampleRate(); rate != 0 {
+				t.SampleRate = rate
+			}
+			if asc.Channels != 0 {
+				t.ChannelCount = asc.Channels
+			}
+		}
+	}
 	t.appendCodec(".")
 	if oti >= 16 {
 		t.raw.codecBuf[t.raw.codecLen] = hexChars[oti>>4]
@@ -201,70 +274,6 @@ func (t *Track) appendEsdsCodec(data []byte) {
 	}
 }
 
-// parseEsds extracts OTI and audio object type from esds box data.
-func parseEsds(data []byte) (oti, audioConfig byte) {
-	if len(data) < 2 {
-		return 0, 0
-	}
-	ptr, end := 0, len(data)
-	if data[ptr] != 0x03 {
-		return 0, 0
-	}
-	ptr++
-	ptr = skipDescLen(data, ptr, end)
-	if ptr < 0 || ptr+3 > end {
-		return 0, 0
-	}
-	flags := data[ptr+2]
-	ptr += 3
-	if flags&0x80 != 0 {
-		ptr += 2
-	}
-	if flags&0x40 != 0 {
-		if ptr >= end {
-			return 0, 0
-		}
-		ptr += 1 + int(data[ptr])
-	}
-	if flags&0x20 != 0 {
-		ptr += 2
-	}
-	if ptr >= end || data[ptr] != 0x04 {
-		return 0, 0
-	}
-	ptr++
-	ptr = skipDescLen(data, ptr, end)
-	if ptr < 0 || ptr+13 > end {
-		return 0, 0
-	}
-	oti = data[ptr]
-	if oti == 0 {
-		return 0, 0
-	}
-	ptr += 13
-	if ptr >= end || data[ptr] != 0x05 {
-		return oti, 0
-	}
-	ptr++
-	ptr = skipDescLen(data, ptr, end)
-	if ptr < 0 || ptr >= end {
-		return oti, 0
-	}
-	audioConfig = (data[ptr] & 0xf8) >> 3
-	return oti, audioConfig
-}
-
-func skipDescLen(data []byte, ptr, end int) int {
-	for ptr < end {
-		b := data[ptr]
-		ptr++
-		if b&0x80 == 0 {
-			return ptr
-		}
-	}
-	return -1
-}
-
 // Sample represents a single media sample. The sync-sample flag is stored in
 // the high bit of the size field, which keeps the struct at 32 bytes. Read the
 // size and the flag through the Size and IsSync methods.
@@ -358,8 +367,10 @@ var (
 // their samples fully populated. The moov buffer must include the box header
 // (the full top-level moov box). The movie duration (from mvhd) is also returned.
 //
-// Returns an error if the moov box is not found, if no playable tracks are
-// found, or if sample tables cannot be parsed for any track.
+// Returns an error if the moov box is not found or is malformed. Tracks whose
+// sample tables cannot be parsed are left out of the result; if that leaves no
+// tracks, the first such failure is returned. Box errors are reported as a
+// [*mp4.ParseError] with offsets relative to moovBuf.
 func ParseTracks(moovBuf []byte) ([]*Track, uint64, error) {
 	return ParseTracksInto(nil, moovBuf)
 }
@@ -370,17 +381,23 @@ func ParseTracks(moovBuf []byte) ([]*Track, uint64, error) {
 // call as dst. The tracks in dst must not be used after this call.
 func ParseTracksInto(dst []*Track, moovBuf []byte) ([]*Track, uint64, error) {
 	mr := mp4.NewReader(moovBuf)
-	if !mr.Next() || mr.Type() != mp4.TypeMoov {
+	if !mr.Next() {
+		if err := mr.Err(); err != nil {
+			return nil, 0, err
+		}
 		return nil, 0, ErrMoovNotFound
 	}
+	if mr.Type() != mp4.TypeMoov {
+		return nil, 0, &mp4.ParseError{Path: mr.Type().String(), Type: mr.Type(), Err: ErrMoovNotFound}
+	}
 
 	var tracks []*Track
 	var duration uint64
 	reused := 0
+	trakCount := 0
 
-	mr.Enter()
-	for mr.Next() {
-		switch mr.Type() {
+	for typ := range mr.Children() {
+		switch typ {
 		case mp4.TypeMvhd:
 			_, dur, _ := mr.ReadMvhd()
 			duration = dur
@@ -393,12 +410,16 @@ func ParseTracksInto(dst []*Track, moovBuf []byte) ([]*Track, uint64, error) {
 				t = &Track{}
 			}
 			reused++
+			t.raw.trakIndex = trakCount
+			trakCount++
 			if parseTrakInto(&mr, t) {
 				tracks = append(tracks, t)
 			}
 		}
 	}
-	mr.Exit()
+	if err := mr.Err(); err != nil {
+		return nil, 0, err
+	}
 
 	// Parse samples for each track, dropping any that fail. The result reuses
 	// dst's backing array when it fits, so repeated same-shape parses don't
@@ -409,12 +430,22 @@ func ParseTracksInto(dst []*Track, moovBuf []byte) ([]*Track, uint64, error) {
 	} else {
 		valid = make([]*Track, 0, len(tracks))
 	}
+	var firstErr error
 	for _, t := range tracks {
+		if trakCount == 1 {
+			t.raw.trakIndex = -1
+		}
 		if err := t.parseSamples(); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
 			continue
 		}
 		valid = append(valid, t)
 	}
+	if len(valid) == 0 && firstErr != nil {
+		return nil, 0, firstErr
+	}
 
 	return valid, duration, nil
 }
@@ -430,19 +461,20 @@ func resetTrack(t *Track) {
 // parseTrakInto fills track from a trak box and reports whether it is a valid,
 // playable track.
 func parseTrakInto(mr *mp4.Reader, track *Track) bool {
-	mr.Enter()
-	defer mr.Exit()
-
-	for mr.Next() {
-		switch mr.Type() {
+	for typ := range mr.Children() {
+		switch typ {
 		case mp4.TypeTkhd:
 			track.raw.tkhdVersion = mr.Version()
 			track.raw.tkhdFlags = mr.Flags()
 			track.raw.tkhd = mr.Data()
-			trackId, _, w, h := mr.ReadTkhd()
-			track.ID = trackId
-			track.Width = uint16(w >> 16)
-			track.Height = uint16(h >> 16)
+			h := mr.ReadTrackHeader()
+			track.ID = h.TrackID
+			track.Width = uint16(h.Width >> 16)
+			track.Height = uint16(h.Height >> 16)
+			track.CreationTime = h.CreationTime
+			track.ModificationTime = h.ModificationTime
+			track.AlternateGroup = h.AlternateGroup
+			track.Matrix = h.Matrix
 		case mp4.TypeEdts:
 			parseEdts(mr, track)
 		case mp4.TypeMdia:
@@ -456,10 +488,8 @@ func parseTrakInto(mr *mp4.Reader, track *Track) bool {
 // parseEdts reads the first edit list entry's media time, used to reproduce the
 // initial composition offset in the output's init segment.
 func parseEdts(mr *mp4.Reader, track *Track) {
-	mr.Enter()
-	defer mr.Exit()
-	for mr.Next() {
-		if mr.Type() == mp4.TypeElst {
+	for typ := range mr.Children() {
+		if typ == mp4.TypeElst {
 			if mt, ok := mr.ReadElst(); ok {
 				track.raw.elstMediaTime = mt
 				track.raw.hasElst = true
@@ -470,19 +500,18 @@ func parseEdts(mr *mp4.Reader, track *Track) {
 }
 
 func parseMdia(mr *mp4.Reader, track *Track) {
-	mr.Enter()
-	defer mr.Exit()
-
 	var handlerType [4]byte
-
-	for mr.Next() {
-		switch mr.Type() {
+	for typ := range mr.Children() {
+		switch typ {
 		case mp4.TypeMdhd:
 			track.raw.mdhdVersion = mr.Version()
 			track.raw.mdhd = mr.Data()
-			ts, dur, _ := mr.ReadMdhd()
+			ts, dur, lang := mr.ReadMdhd()
 			track.TimeScale = ts
 			track.Duration = dur
+			track.Language = lang
+		case mp4.TypeElng:
+			track.ExtendedLanguage = mr.ReadElng()
 		case mp4.TypeHdlr:
 			track.raw.hdlr = mr.RawBox()
 			handlerType = mr.ReadHdlr()
@@ -493,11 +522,8 @@ func parseMdia(mr *mp4.Reader, track *Track) {
 }
 
 func parseMinf(mr *mp4.Reader, track *Track, handlerType [4]byte) {
-	mr.Enter()
-	defer mr.Exit()
-
-	for mr.Next() {
-		switch mr.Type() {
+	for typ := range mr.Children() {
+		switch typ {
 		case mp4.TypeVmhd:
 			track.raw.hasVmhd = true
 		case mp4.TypeSmhd:
@@ -506,41 +532,61 @@ func parseMinf(mr *mp4.Reader, track *Track, handlerType [4]byte) {
 			track.raw.hasDinf = true
 			track.raw.dinf = mr.RawBox()
 		case mp4.TypeStbl:
+			track.raw.stblOffset = mr.Offset()
 			parseStbl(mr, track, handlerType)
 		}
 	}
 }
 
 func parseStbl(mr *mp4.Reader, track *Track, handlerType [4]byte) {
-	mr.Enter()
-	defer mr.Exit()
-
-	for mr.Next() {
-		switch mr.Type() {
+	for typ := range mr.Children() {
+		switch typ {
 		case mp4.TypeStsd:
 			track.raw.stsd = mr.RawBox()
 			parseStsd(mr, track, handlerType)
 		case mp4.TypeStsz:
 			track.raw.stszData = mr.Data()
+			track.raw.stszOffset = mr.Offset()
+			track.raw.hasStz2 = false
+		case mp4.TypeStz2:
+			if track.raw.stszData == nil {
+				track.raw.stszData = mr.Data()
+				track.raw.stszOffset = mr.Offset()
+				track.raw.hasStz2 = true
+			}
 		case mp4.TypeStts:
 			track.raw.sttsData = mr.Data()
+			track.raw.sttsOffset = mr.Offset()
 		case mp4.TypeStsc:
 			track.raw.stscData = mr.Data()
+			track.raw.stscOffset = mr.Offset()
 		case mp4.TypeCtts:
 			track.raw.cttsData = mr.Data()
 			track.raw.cttsVersion = mr.Version()
 		case mp4.TypeStss:
 			track.raw.stssData = mr.Data()
+		case mp4.TypeSdtp:
+			track.raw.sdtpData = mr.Data()
+		case mp4.TypeSubs:
+			if track.raw.subsData == nil {
+				track.raw.subsData = mr.Data()
+				track.raw.subsVersion = mr.Version()
+				track.raw.subsFlags = mr.Flags()
+			}
 		case mp4.TypeStco:
 			track.raw.stcoData = mr.Data()
 		case mp4.TypeCo64:
 			track.raw.co64Data = mr.Data()
 			track.raw.hasCo64 = true
+		case mp4.TypeSbgp:
+			track.raw.sbgp = append(track.raw.sbgp, groupBox{mr.Data(), mr.Version()})
+		case mp4.TypeSgpd:
+			track.raw.sgpd = append(track.raw.sgpd, groupBox{mr.Data(), mr.Version()})
 		}
 	}
 
 	if track.raw.stszData != nil {
-		stszIt := mp4.NewStszIter(track.raw.stszData)
+		stszIt := track.raw.sizeIter()
 		track.raw.sampleCount = stszIt.Count()
 	}
 
@@ -573,24 +619,24 @@ func parseStsd(mr *mp4.Reader, track *Track, handlerType [4]byte) {
 	switch handlerType {
 	case htVide:
 		track.Kind = TrackVideo
-		if len(entryData) < 78 {
+		v, err := mp4.ReadVisualSampleEntry(entryData)
+		if err != nil {
 			track.setCodec(entryType.String())
 			return
 		}
-		v := mp4.ReadVisualSampleEntry(entryData)
 		track.Width = v.Width
 		track.Height = v.Height
 		switch entryType {
 		case mp4.TypeAvc1:
 			track.setCodec("avc1")
-			if d := childBox(mr, v.ChildOffset, mp4.TypeAvcC); len(d) >= 4 {
+			if m, ok := mr.Find("avcC"); ok && len(m.Data) >= 4 {
 				track.appendCodec(".")
-				track.appendAvcCProfile(d[1], d[2], d[3])
+				track.appendAvcCProfile(m.Data[1], m.Data[2], m.Data[3])
 			}
 		case mp4.TypeAv01:
 			track.setCodec("av01")
-			if d := childBox(mr, v.ChildOffset, mp4.TypeAv1C); len(d) >= 3 {
-				track.appendAv1CProfile(d)
+			if m, ok := mr.Find("av1C"); ok && len(m.Data) >= 3 {
+				track.appendAv1CProfile(m.Data)
 			}
 		default:
 			track.setCodec(entryType.String())
@@ -600,12 +646,11 @@ func parseStsd(mr *mp4.Reader, track *Track, handlerType [4]byte) {
 		switch entryType {
 		case mp4.TypeMp4a:
 			track.setCodec("mp4a")
-			if len(entryData) >= 28 {
-				a := mp4.ReadAudioSampleEntry(entryData)
+			if a, err := mp4.ReadAudioSampleEntry(entryData); err == nil {
 				track.ChannelCount = a.ChannelCount
 				track.SampleRate = a.SampleRate >> 16
-				if d := childBox(mr, a.ChildOffset, mp4.TypeEsds); d != nil {
-					track.appendEsdsCodec(d)
+				if m, ok := mr.Find("esds"); ok {
+					track.appendEsdsCodec(m.Data)
 				}
 			}
 		default:
@@ -617,32 +662,74 @@ func parseStsd(mr *mp4.Reader, track *Track, handlerType [4]byte) {
 	}
 }
 
-// childBox enters the current sample entry, skips its fixed header of
-// childOffset bytes, and returns the data of the first child box of boxType, or
-// nil if none is found.
-func childBox(mr *mp4.Reader, childOffset int, boxType mp4.BoxType) []byte {
-	mr.Enter()
-	defer mr.Exit()
-	mr.Skip(childOffset)
-	for mr.Next() {
-		if mr.Type() == boxType {
-			return mr.Data()
-		}
+// sizeIter reads sample sizes from an stsz or an stz2 box.
+type sizeIter struct {
+	stsz    mp4.StszIter
+	stz2    mp4.Stz2Iter
+	compact bool
+}
+
+// sizeIter returns an iterator over the track's sample sizes.
+func (r *trackRaw) sizeIter() sizeIter {
+	if r.hasStz2 {
+		return sizeIter{stz2: mp4.NewStz2Iter(r.stszData), compact: true}
 	}
-	return nil
+	return sizeIter{stsz: mp4.NewStszIter(r.stszData)}
 }
 
+// sizeBox returns the type of the track's sample size box.
+func (r *trackRaw) sizeBox() mp4.BoxType {
+	if r.hasStz2 {
+		return mp4.TypeStz2
+	}
+	return mp4.TypeStsz
+}
+
+// Count returns the total number of samples.
+func (it *sizeIter) Count() uint32 {
+	if it.compact {
+		return it.stz2.Count()
+	}
+	return it.stsz.Count()
+}
+
+// Next returns the next sample size. Returns (0, false) when done.
+func (it *sizeIter) Next() (uint32, bool) {
+	if it.compact {
+		return it.stz2.Next()
+	}
+	return it.stsz.Next()
+}
+
+// Read decodes up to len(dst) of the remaining sample sizes into dst and
+// returns how many it decoded.
+func (it *sizeIter) Read(dst []uint32) int {
+	if it.compact {
+		return it.stz2.Read(dst)
+	}
+	return it.stsz.Read(dst)
+}
+
+// batchSize is the number of table entries parseSamples decodes at a time.
+const batchSize = 256
+
 // parseSamples parses sample table data and populates track.Samples.
 // Returns an error if required sample table data is missing or corrupt.
+//
+// Each table is decoded in its own pass over the samples, in batches, rather
+// than walking every table in step one sample at a time.
 func (t *Track) parseSamples() error {
 	if t.raw.stszData == nil || t.raw.sttsData == nil || t.raw.stscData == nil {
-		return fmt.Errorf("track %d: %w: missing required sample table data (stsz/stts/stsc)", t.ID, ErrInvalidTrack)
+		return t.tableError(mp4.TypeStbl, t.raw.stblOffset, fmt.Errorf("track %d: %w: missing required sample table data (stsz or stz2/stts/stsc)", t.ID, ErrInvalidTrack))
 	}
 	if t.raw.stcoData == nil && t.raw.co64Data == nil {
-		return fmt.Errorf("track %d: %w: missing chunk offset data (stco/co64)", t.ID, ErrInvalidTrack)
+		return t.tableError(mp4.TypeStbl, t.raw.stblOffset, fmt.Errorf("track %d: %w: missing chunk offset data (stco/co64)", t.ID, ErrInvalidTrack))
 	}
 
-	stszIt := mp4.NewStszIter(t.raw.stszData)
+	stszIt := t.raw.sizeIter()
+	if stszIt.compact && stszIt.stz2.FieldSize() == 0 {
+		return t.tableError(mp4.TypeStz2, t.raw.stszOffset, fmt.Errorf("track %d: %w: stz2 field size is not 4, 8 or 16", t.ID, ErrCorruptData))
+	}
 	numSamples := int(stszIt.Count())
 	if numSamples == 0 {
 		t.Samples = t.Samples[:0]
@@ -657,166 +744,234 @@ func (t *Track) parseSamples() error {
 	}
 
 	stscIt := mp4.NewStscIter(t.raw.stscData)
-	sttsIt := mp4.NewSttsIter(t.raw.sttsData)
-
-	var cttsIt mp4.CttsIter
-	hasCtts := t.raw.cttsData != nil
-	if hasCtts {
-		cttsIt = mp4.NewCttsIter(t.raw.cttsData, t.raw.cttsVersion)
-	}
-
-	hasSync := t.raw.stssData != nil
-	var syncIt mp4.Uint32Iter
-	if hasSync {
-		syncIt = mp4.NewUint32Iter(t.raw.stssData)
-	}
-
-	curStsc, ok := stscIt.Next()
+	stsc, ok := stscIt.Next()
 	if !ok {
-		return fmt.Errorf("track %d: %w: empty stsc table", t.ID, ErrInvalidTrack)
-	}
-	var nextStsc mp4.StscEntry
-	haveNextStsc := false
-	if e, ok := stscIt.Next(); ok {
-		nextStsc = e
-		haveNextStsc = true
+		return t.tableError(mp4.TypeStsc, t.raw.stscOffset, fmt.Errorf("track %d: %w: empty stsc table", t.ID, ErrInvalidTrack))
 	}
-
-	curStts, ok := sttsIt.Next()
+	sttsIt := mp4.NewSttsIter(t.raw.sttsData)
+	stts, ok := sttsIt.Next()
 	if !ok {
-		return fmt.Errorf("track %d: %w: empty stts table", t.ID, ErrInvalidTrack)
+		return t.tableError(mp4.TypeStts, t.raw.sttsOffset, fmt.Errorf("track %d: %w: empty stts table", t.ID, ErrInvalidTrack))
 	}
-	sttsRemaining := int(curStts.Count)
 
-	var curCtts mp4.CttsEntry
-	cttsRemaining := 0
-	if hasCtts {
-		if e, ok := cttsIt.Next(); ok {
-			curCtts = e
-			cttsRemaining = int(e.Count)
+	var batch [batchSize]uint32
+	for i := 0; i < numSamples; {
+		n := stszIt.Read(batch[:min(batchSize, numSamples-i)])
+		if n == 0 {
+			return t.tableError(t.raw.sizeBox(), t.raw.stszOffset, fmt.Errorf("track %d: %w: %s iterator exhausted at sample %d/%d", t.ID, ErrCorruptData, t.raw.sizeBox(), i, numSamples))
 		}
+		for j, size := range batch[:n] {
+			samples[i+j] = Sample{TrackID: t.ID, size: size}
+		}
+		i += n
 	}
 
-	var nextSync uint32
-	haveSync := false
-	if hasSync {
-		if v, ok := syncIt.Next(); ok {
-			nextSync = v
-			haveSync = true
+	stsc = t.fillChunks(samples, stsc, stscIt)
+	fillTimes(samples, stts, sttsIt)
+	if t.raw.cttsData != nil {
+		fillPresentationOffsets(samples, mp4.NewCttsIter(t.raw.cttsData, t.raw.cttsVersion))
+	}
+	if t.raw.stssData != nil {
+		markSync(samples, mp4.NewUint32Iter(t.raw.stssData), &batch)
+	} else {
+		for i := range samples {
+			samples[i].size |= syncBit
 		}
 	}
 
-	var chunkOffset int64
-	var chunkIdx uint32
+	t.Samples = samples
+	t.SampleDescIdx = stsc.SampleDescriptionId
+	if t.raw.subsData != nil {
+		t.parseSubs()
+	}
+	return nil
+}
 
-	var stcoIt mp4.Uint32Iter
-	var co64It mp4.Co64Iter
+// fillChunks sets the sample offsets from the chunk offset and sample-to-chunk
+// tables, given the first stsc entry and an iterator over the rest. It returns
+// the stsc entry of the last chunk. Once the chunk offsets run out, the last
+// one is reused.
+func (t *Track) fillChunks(samples []Sample, cur mp4.StscEntry, stscIt mp4.StscIter) mp4.StscEntry {
+	next, haveNext := stscIt.Next()
+
+	var offsets chunkOffsets
 	if t.raw.hasCo64 {
-		co64It = mp4.NewCo64Iter(t.raw.co64Data)
-		if v, ok := co64It.Next(); ok {
-			chunkOffset = int64(v)
-		}
+		offsets.co64 = mp4.NewCo64Iter(t.raw.co64Data)
+		offsets.wide = true
 	} else {
-		stcoIt = mp4.NewUint32Iter(t.raw.stcoData)
-		if v, ok := stcoIt.Next(); ok {
-			chunkOffset = int64(v)
-		}
+		offsets.stco = mp4.NewUint32Iter(t.raw.stcoData)
 	}
-	chunkIdx = 1
-
-	sampleInChunk := uint32(0)
-	var offsetInChunk int64
-	var dts int64
+	chunkOffset, _ := offsets.next()
+	chunk := uint32(1)
 
-	for i := range numSamples {
-		size, ok := stszIt.Next()
-		if !ok {
-			return fmt.Errorf("track %d: %w: stsz iterator exhausted at sample %d/%d", t.ID, ErrCorruptData, i, numSamples)
+	for i := 0; ; {
+		n := min(max(int(cur.SamplesPerChunk), 1), len(samples)-i)
+		off := chunkOffset
+		for j := range samples[i : i+n] {
+			s := &samples[i+j]
+			s.Offset = off
+			off += int64(s.Size())
 		}
-
-		var presOff int32
-		if hasCtts && cttsRemaining > 0 {
-			presOff = curCtts.Offset
+		i += n
+		if i == len(samples) {
+			return cur
 		}
 
-		isSync := true
-		if hasSync {
-			isSync = haveSync && nextSync == uint32(i+1)
+		chunk++
+		if v, ok := offsets.next(); ok {
+			chunkOffset = v
 		}
-
-		packedSize := size
-		if isSync {
-			packedSize |= syncBit
-		}
-		samples[i] = Sample{
-			Offset:             offsetInChunk + chunkOffset,
-			DTS:                dts,
-			TrackID:            t.ID,
-			size:               packedSize,
-			Duration:           curStts.Duration,
-			PresentationOffset: presOff,
+		if haveNext && chunk >= next.FirstChunk {
+			cur = next
+			next, haveNext = stscIt.Next()
 		}
+	}
+}
 
-		if i+1 >= numSamples {
-			break
-		}
+// chunkOffsets reads a track's stco or co64 table in batches.
+type chunkOffsets struct {
+	stco mp4.Uint32Iter
+	co64 mp4.Co64Iter
+	wide bool // co64
+	buf  [batchSize]uint64
+	pos  int
+	n    int
+}
 
-		sampleInChunk++
-		offsetInChunk += int64(size)
-		if sampleInChunk >= curStsc.SamplesPerChunk {
-			sampleInChunk = 0
-			offsetInChunk = 0
-			chunkIdx++
-			if t.raw.hasCo64 {
-				if v, ok := co64It.Next(); ok {
-					chunkOffset = int64(v)
-				}
-			} else {
-				if v, ok := stcoIt.Next(); ok {
-					chunkOffset = int64(v)
-				}
-			}
-			if haveNextStsc && chunkIdx >= nextStsc.FirstChunk {
-				curStsc = nextStsc
-				if e, ok := stscIt.Next(); ok {
-					nextStsc = e
-				} else {
-					haveNextStsc = false
-				}
+// next returns the next chunk offset, or false when done.
+func (c *chunkOffsets) next() (int64, bool) {
+	if c.pos == c.n {
+		if c.wide {
+			c.n = c.co64.Read(c.buf[:])
+		} else {
+			var narrow [batchSize]uint32
+			c.n = c.stco.Read(narrow[:])
+			for i, v := range narrow[:c.n] {
+				c.buf[i] = uint64(v)
 			}
 		}
+		c.pos = 0
+		if c.n == 0 {
+			return 0, false
+		}
+	}
+	v := c.buf[c.pos]
+	c.pos++
+	return int64(v), true
+}
 
-		dts += int64(curStts.Duration)
-		sttsRemaining--
-		if sttsRemaining <= 0 {
-			if e, ok := sttsIt.Next(); ok {
-				curStts = e
-				sttsRemaining = int(e.Count)
-			}
+// fillTimes sets the decode times and durations from the stts table, given
+// its first entry and an iterator over the rest. An entry covers at least one
+// sample, and samples past the end of the table repeat the last duration.
+func fillTimes(samples []Sample, e mp4.SttsEntry, it mp4.SttsIter) {
+	var dts int64
+	for i := 0; i < len(samples); {
+		n := len(samples) - i
+		next, more := it.Next()
+		if more {
+			n = min(max(int(e.Count), 1), n)
+		}
+		for j := range samples[i : i+n] {
+			s := &samples[i+j]
+			s.DTS = dts
+			s.Duration = e.Duration
+			dts += int64(e.Duration)
 		}
+		i += n
+		e = next
+	}
+}
 
-		if hasCtts {
-			cttsRemaining--
-			if cttsRemaining <= 0 {
-				if e, ok := cttsIt.Next(); ok {
-					curCtts = e
-					cttsRemaining = int(e.Count)
-				}
+// fillPresentationOffsets sets the composition offsets from the ctts table.
+// An entry covers at least one sample, and samples past the end of the table
+// keep an offset of zero.
+func fillPresentationOffsets(samples []Sample, it mp4.CttsIter) {
+	i := 0
+	for _, e := range it.All() {
+		n := min(max(int(e.Count), 1), len(samples)-i)
+		if e.Count > 0 {
+			for j := range samples[i : i+n] {
+				samples[i+j].PresentationOffset = e.Offset
 			}
 		}
+		i += n
+		if i == len(samples) {
+			return
+		}
+	}
+}
 
-		if isSync && hasSync {
-			if v, ok := syncIt.Next(); ok {
-				nextSync = v
-			} else {
-				haveSync = false
+// markSync sets the sync bit of the samples listed in the stss table, which
+// must be in increasing order; marking stops at the first entry that is not.
+func markSync(samples []Sample, it mp4.Uint32Iter, batch *[batchSize]uint32) {
+	next := uint32(1) // lowest sample number the next entry may name
+	for n := it.Read(batch[:]); n > 0; n = it.Read(batch[:]) {
+		for _, v := range batch[:n] {
+			if v < next || int(v) > len(samples) {
+				return
 			}
+			samples[v-1].size |= syncBit
+			next = v + 1
 		}
 	}
+}
 
-	t.Samples = samples
-	t.SampleDescIdx = curStsc.SampleDescriptionId
-	return nil
+// parseSubs decodes the track's subs box so Subsamples can look up a sample.
+func (t *Track) parseSubs() {
+	it := mp4.NewSubsIter(t.raw.subsData, t.raw.subsVersion)
+	n := min(int(it.Count()), len(t.raw.subsData)/6)
+	t.raw.subsSample = make([]uint32, 0, n)
+	t.raw.subsEntries = make([][]mp4.Subsample, 0, n)
+	var buf, all []mp4.Subsample
+	var sample uint32
+	for e, ok := it.Next(buf); ok; e, ok = it.Next(buf) {
+		buf = e.Subsamples
+		if e.SampleDelta == 0 {
+			continue // sample numbers must increase
+		}
+		sample += e.SampleDelta
+		start := len(all)
+		all = append(all, e.Subsamples...)
+		t.raw.subsSample = append(t.raw.subsSample, sample-1)
+		t.raw.subsEntries = append(t.raw.subsEntries, all[start:len(all):len(all)])
+	}
+}
+
+// Subsamples returns the subsamples of the given sample (0-based, as in
+// Track.Samples) from the track's subs box, or nil if it has none. The
+// returned slice must not be modified.
+func (t *Track) Subsamples(sample int) []mp4.Subsample {
+	i, found := slices.BinarySearch(t.raw.subsSample, uint32(sample))
+	if !found || sample < 0 {
+		return nil
+	}
+	return t.raw.subsEntries[i]
+}
+
+// Dependency returns the dependency information of the given sample (0-based,
+// as in Track.Samples) from the track's sdtp box, or 0 (all unknown) if it has
+// none, such as whether the sample is leading or disposable.
+func (t *Track) Dependency(sample int) mp4.SampleDependency {
+	if sample < 0 || sample >= len(t.raw.sdtpData) || sample >= len(t.Samples) {
+		return 0
+	}
+	return mp4.SampleDependency(t.raw.sdtpData[sample])
+}
+
+// SubsFlags returns the flags of the track's subs box, whose meaning is codec
+// specific, and whether the track has one.
+func (t *Track) SubsFlags() (uint32, bool) {
+	return t.raw.subsFlags, t.raw.subsData != nil
+}
+
+// tableError wraps err in a ParseError for the box of type bt at offset, which
+// is either the track's stbl or one of its sample tables.
+func (t *Track) tableError(bt mp4.BoxType, offset int, err error) error {
+	path := mp4.JoinPath("moov", mp4.TypeTrak, t.raw.trakIndex) + "/mdia/minf/stbl"
+	if bt != mp4.TypeStbl {
+		path = mp4.JoinPath(path, bt, -1)
+	}
+	return &mp4.ParseError{Path: path, Offset: int64(offset), Type: bt, Err: err}
 }
 
 const hexChars = "0123456789abcdef"
@@ -0,0 +1,368 @@
+package track_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/tetsuo/mp4"
+	"github.com/tetsuo/mp4/track"
+)
+
+// buildMoov writes a moov box holding one avc1 video track per stbl callback.
+// Each callback writes the sample tables that follow the track's stsd.
+func buildMoov(stbls ...func(w *mp4.Writer)) []byte {
+	w := mp4.NewWriter(make([]byte, 1<<16))
+	w.StartBox(mp4.TypeMoov)
+	w.WriteMvhd(1000, 1000, uint32(len(stbls)+1))
+	for i, stbl := range stbls {
+		w.StartBox(mp4.TypeTrak)
+		w.WriteTkhd(3, uint32(i+1), 1000, 640<<16, 480<<16)
+		w.StartBox(mp4.TypeMdia)
+		w.WriteMdhd(1000, 1000, "und")
+		w.WriteHdlr([4]byte{'v', 'i', 'd', 'e'}, "VideoHandler")
+		w.StartBox(mp4.TypeMinf)
+		w.WriteVmhd()
+		w.StartBox(mp4.TypeStbl)
+		w.StartFullBox(mp4.TypeStsd, 0, 0)
+		w.Write([]byte{0, 0, 0, 1})
+		w.StartBox(mp4.TypeAvc1)
+		w.WriteVisualSampleEntry(1, 640, 480, 1, 24, "")
+		w.StartBox(mp4.TypeAvcC)
+		w.Write([]byte{1, 0x64, 0x00, 0x1e, 0xff, 0xe0, 0x00})
+		w.EndBox() // avcC
+		w.EndBox() // avc1
+		w.EndBox() // stsd
+		stbl(&w)
+		w.EndBox() // stbl
+		w.EndBox() // minf
+		w.EndBox() // mdia
+		w.EndBox() // trak
+	}
+	w.EndBox() // moov
+	return w.Bytes()
+}
+
+// simpleTables writes sample tables for n samples of 100 bytes in one chunk.
+func simpleTables(n int) func(w *mp4.Writer) {
+	return func(w *mp4.Writer) {
+		sizes := make([]uint32, n)
+		for i := range sizes {
+			sizes[i] = 100
+		}
+		w.WriteStts([]mp4.SttsEntry{{Count: uint32(n), Duration: 10}})
+		w.WriteStsc([]mp4.StscEntry{{FirstChunk: 1, SamplesPerChunk: uint32(n), SampleDescriptionId: 1}})
+		w.WriteStsz(0, sizes)
+		w.WriteStco([]uint32{1000})
+	}
+}
+
+func TestParseTracksCorruptStsz(t *testing.T) {
+	corrupt := func(w *mp4.Writer) {
+		w.WriteStts([]mp4.SttsEntry{{Count: 4, Duration: 10}})
+		w.WriteStsc([]mp4.StscEntry{{FirstChunk: 1, SamplesPerChunk: 4, SampleDescriptionId: 1}})
+		// Claims four samples but carries only two sizes.
+		w.StartFullBox(mp4.TypeStsz, 0, 0)
+		w.Write([]byte{0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 100, 0, 0, 0, 100})
+		w.EndBox()
+		w.WriteStco([]uint32{1000})
+	}
+	moov := buildMoov(corrupt, corrupt)
+
+	_, _, err := track.ParseTracks(moov)
+	if !errors.Is(err, track.ErrCorruptData) {
+		t.Fatalf("err = %v, want ErrCorruptData", err)
+	}
+	pe, ok := errors.AsType[*mp4.ParseError](err)
+	if !ok {
+		t.Fatalf("err = %T, want *mp4.ParseError", err)
+	}
+	if want := "moov/trak[0]/mdia/minf/stbl/stsz"; pe.Path != want {
+		t.Errorf("Path = %q, want %q", pe.Path, want)
+	}
+	if pe.Type != mp4.TypeStsz {
+		t.Errorf("Type = %s, want stsz", pe.Type)
+	}
+	if got := string(moov[pe.Offset+4 : pe.Offset+8]); got != "stsz" {
+		t.Errorf("Offset %d points at %q, want stsz", pe.Offset, got)
+	}
+}
+
+func TestParseTracksShortTkhd(t *testing.T) {
+	moov := buildMoov(simpleTables(2), simpleTables(2))
+
+	// Truncate the second tkhd's data by shrinking its size field; the bytes
+	// left over become padding before the next box.
+	r := mp4.NewReader(moov)
+	r.Next()
+	r.Enter()
+	tkhdOffset, traks := 0, 0
+	for r.Next() {
+		if r.Type() == mp4.TypeTrak {
+			traks++
+			if traks == 2 {
+				r.Enter()
+				r.Next()
+				tkhdOffset = r.Offset()
+				r.Exit()
+			}
+		}
+	}
+	r.Exit()
+	broken := append([]byte(nil), moov...)
+	broken[tkhdOffset+3] = 12 + 20 // header + version/flags + 20 bytes
+
+	_, _, err := track.ParseTracks(broken)
+	pe, ok := errors.AsType[*mp4.ParseError](err)
+	if !ok {
+		t.Fatalf("err = %v, want *mp4.ParseError", err)
+	}
+	if want := "moov/trak[1]/tkhd"; pe.Path != want {
+		t.Errorf("Path = %q, want %q", pe.Path, want)
+	}
+	if pe.Offset != int64(tkhdOffset) {
+		t.Errorf("Offset = %d, want %d", pe.Offset, tkhdOffset)
+	}
+}
+
+func TestSampleGroup(t *testing.T) {
+	moov := buildMoov(func(w *mp4.Writer) {
+		simpleTables(6)(w)
+		w.WriteSbgp(mp4.GroupingRap, []mp4.SbgpEntry{
+			{SampleCount: 1, GroupDescriptionIndex: 1},
+			{SampleCount: 2},
+			{SampleCount: 1, GroupDescriptionIndex: 2},
+		})
+		w.WriteSgpd(mp4.GroupingRap, [][]byte{
+			mp4.RapEntry{NumLeadingSamplesKnown: true}.Append(nil),
+			mp4.RapEntry{NumLeadingSamplesKnown: true, NumLeadingSamples: 2}.Append(nil),
+		})
+	})
+	tracks, _, err := track.ParseTracks(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := tracks[0].SampleGroup(mp4.GroupingRoll); g != nil {
+		t.Errorf("SampleGroup(roll) = %+v, want nil", g)
+	}
+	g := tracks[0].SampleGroup(mp4.GroupingRap)
+	if g == nil {
+		t.Fatal("SampleGroup(rap) = nil")
+	}
+	for i, want := range []uint32{1, 0, 0, 2, 0, 0} {
+		if got := g.Index(i); got != want {
+			t.Errorf("Index(%d) = %d, want %d", i, got, want)
+		}
+	}
+	rap, err := mp4.ReadRapEntry(g.Description(3))
+	if err != nil || rap.NumLeadingSamples != 2 {
+		t.Errorf("sample 3 rap entry = %+v, %v, want 2 leading samples", rap, err)
+	}
+	if d := g.Description(1); d != nil {
+		t.Errorf("Description(1) = %x, want nil", d)
+	}
+}
+
+func TestSampleDependency(t *testing.T) {
+	moov := buildMoov(func(w *mp4.Writer) {
+		simpleTables(3)(w)
+		w.WriteSdtp([]mp4.SampleDependency{
+			0x24, // does not depend on others; depended on
+			0x58, // leading, depends on others, disposable
+		})
+	})
+	tracks, _, err := track.ParseTracks(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tracks[0]
+	if d := tr.Dependency(0); d.DependsOn() != 2 || !d.IsDependedOn() || d.IsDisposable() || d.Leading() != 0 || d.IsLeadingSample() {
+		t.Errorf("sample 0 dependency = %#x, want an independent, referenced sample", d)
+	}
+	if d := tr.Dependency(1); !d.IsDependent() || d.DependedOn() != 2 || !d.IsDisposable() || d.Leading() != 1 || !d.IsLeadingSample() {
+		t.Errorf("sample 1 dependency = %#x, want a leading, dependent, disposable sample", d)
+	}
+	for _, i := range []int{2, 3, -1} {
+		if d := tr.Dependency(i); d != 0 {
+			t.Errorf("sample %d dependency = %#x, want 0 past the end of sdtp", i, d)
+		}
+	}
+	if size := unsafe.Sizeof(track.Sample{}); size != 32 {
+		t.Errorf("Sample is %d bytes, want 32", size)
+	}
+}
+
+func TestParseSamples(t *testing.T) {
+	moov := buildMoov(func(w *mp4.Writer) {
+		w.WriteStts([]mp4.SttsEntry{{Count: 3, Duration: 10}, {Count: 4, Duration: 20}})
+		w.WriteCtts([]mp4.CttsEntry{{Count: 2, Offset: 5}, {Count: 1, Offset: 0}, {Count: 4, Offset: 15}})
+		w.WriteStss([]uint32{1, 5})
+		w.WriteStsc([]mp4.StscEntry{
+			{FirstChunk: 1, SamplesPerChunk: 2, SampleDescriptionId: 1},
+			{FirstChunk: 3, SamplesPerChunk: 3, SampleDescriptionId: 2},
+		})
+		w.WriteStsz(0, []uint32{10, 20, 30, 40, 50, 60, 70})
+		w.WriteStco([]uint32{1000, 2000, 3000})
+	})
+	tracks, _, err := track.ParseTracks(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tracks[0]
+	want := []struct {
+		offset, dts  int64
+		duration     uint32
+		presentation int32
+		sync         bool
+	}{
+		{1000, 0, 10, 5, true},
+		{1010, 10, 10, 5, false},
+		{2000, 20, 10, 0, false},
+		{2030, 30, 20, 15, false},
+		{3000, 50, 20, 15, true},
+		{3050, 70, 20, 15, false},
+		{3110, 90, 20, 15, false},
+	}
+	if len(tr.Samples) != len(want) {
+		t.Fatalf("got %d samples, want %d", len(tr.Samples), len(want))
+	}
+	for i, w := range want {
+		s := tr.Samples[i]
+		if s.Offset != w.offset || s.DTS != w.dts || s.Duration != w.duration || s.PresentationOffset != w.presentation || s.IsSync() != w.sync || s.Size() != uint32(10*(i+1)) {
+			t.Errorf("sample %d = %+v (sync %v), want %+v", i, s, s.IsSync(), w)
+		}
+	}
+	if tr.SampleDescIdx != 2 {
+		t.Errorf("SampleDescIdx = %d, want 2 from the last chunk's stsc entry", tr.SampleDescIdx)
+	}
+}
+
+func TestParseTracksStz2(t *testing.T) {
+	moov := buildMoov(func(w *mp4.Writer) {
+		w.WriteStts([]mp4.SttsEntry{{Count: 3, Duration: 10}})
+		w.WriteStsc([]mp4.StscEntry{{FirstChunk: 1, SamplesPerChunk: 3, SampleDescriptionId: 1}})
+		w.WriteBox(&mp4.Stz2{FieldSize: 4, Entries: []uint16{3, 9, 12}})
+		w.WriteStco([]uint32{1000})
+	})
+	tracks, _, err := track.ParseTracks(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := tracks[0].Samples
+	if len(s) != 3 || s[1].Size() != 9 || s[2].Offset != 1000+3+9 {
+		t.Errorf("samples = %+v, want sizes 3, 9, 12 from stz2", s)
+	}
+}
+
+func TestSubsamples(t *testing.T) {
+	big := []mp4.Subsample{{Size: 1 << 20, Priority: 2}}
+	small := []mp4.Subsample{{Size: 40}, {Size: 60, CodecSpecificParameters: 7}}
+	moov := buildMoov(func(w *mp4.Writer) {
+		simpleTables(4)(w)
+		w.WriteSubs(1, []mp4.SubsEntry{{SampleDelta: 1, Subsamples: big}, {SampleDelta: 2, Subsamples: small}})
+	})
+	tracks, _, err := track.ParseTracks(moov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tracks[0]
+	if flags, ok := tr.SubsFlags(); !ok || flags != 1 {
+		t.Errorf("SubsFlags = %d, %v, want 1, true", flags, ok)
+	}
+	for i, want := range [][]mp4.Subsample{big, nil, small, nil} {
+		if got := tr.Subsamples(i); !reflect.DeepEqual(got, want) {
+			t.Errorf("Subsamples(%d) = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestTrackLanguage(t *testing.T) {
+	boxes, err := mp4.DecodeBoxes(buildMoov(simpleTables(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdia := boxes[0].(*mp4.Container).Child(mp4.TypeTrak).(*mp4.Container).Child(mp4.TypeMdia).(*mp4.Container)
+	mdia.Child(mp4.TypeMdhd).(*mp4.Mdhd).Language = mp4.EncodeLanguage("por")
+
+	tracks, _, err := track.ParseTracks(encode(boxes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr := tracks[0]; tr.Language != "por" || tr.PreferredLanguage() != "por" {
+		t.Errorf("language = %q, preferred %q, want por", tr.Language, tr.PreferredLanguage())
+	}
+
+	// elng goes after the hdlr.
+	mdia.Children = append(mdia.Children[:2:2], append([]mp4.Box{&mp4.Elng{ExtendedLanguage: "pt-BR"}}, mdia.Children[2:]...)...)
+	tracks, _, err = track.ParseTracks(encode(boxes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr := tracks[0]; tr.ExtendedLanguage != "pt-BR" || tr.PreferredLanguage() != "pt-BR" {
+		t.Errorf("extended language = %q, preferred %q, want pt-BR", tr.ExtendedLanguage, tr.PreferredLanguage())
+	}
+}
+
+func TestAudioSpecificConfig(t *testing.T) {
+	boxes, err := mp4.DecodeBoxes(buildMoov(simpleTables(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdia := boxes[0].(*mp4.Container).Child(mp4.TypeTrak).(*mp4.Container).Child(mp4.TypeMdia).(*mp4.Container)
+	mdia.Child(mp4.TypeHdlr).(*mp4.Hdlr).HandlerType = [4]byte{'s', 'o', 'u', 'n'}
+	stbl := mdia.Child(mp4.TypeMinf).(*mp4.Container).Child(mp4.TypeStbl).(*mp4.Container)
+
+	for _, tc := range []struct {
+		oti      uint8
+		asc      []byte
+		codec    string
+		rate     uint32
+		channels uint16
+	}{
+		{0x40, []byte{0x11, 0x90}, "mp4a.40.2", 48000, 2},
+		{0x40, []byte{0x2b, 0x11, 0x88, 0x00}, "mp4a.40.5", 48000, 2},  // HE-AAC
+		{0x40, []byte{0xeb, 0x09, 0x88, 0x00}, "mp4a.40.29", 48000, 2}, // HE-AAC v2, mono core
+		{0x40, []byte{0x11}, "mp4a.40", 24000, 1},                      // truncated: sample entry values
+		{0xdd, []byte{0x12, 0x18}, "mp4a.dd", 24000, 1},                // Vorbis: not an ASC
+	} {
+		w := mp4.NewGrowWriter(nil)
+		w.WriteEsds(&mp4.ESDescriptor{
+			ESID: 1,
+			DecoderConfig: mp4.DecoderConfigDescriptor{
+				ObjectTypeIndication: tc.oti,
+				StreamType:           mp4.StreamTypeAudio,
+				DecoderSpecificInfo:  tc.asc,
+			},
+			SLConfig: mp4.SLConfigDescriptor{Predefined: mp4.SLPredefinedMP4},
+		})
+		esds := &mp4.Esds{Descriptor: w.Bytes()[12:]}
+		stbl.Child(mp4.TypeStsd).(*mp4.Stsd).Entries = []mp4.Box{&mp4.AudioSampleEntry{
+			BoxType:            mp4.TypeMp4a,
+			DataReferenceIndex: 1,
+			ChannelCount:       1,
+			SampleSize:         16,
+			SampleRate:         24000 << 16,
+			Children:           []mp4.Box{esds},
+		}}
+
+		tracks, _, err := track.ParseTracks(encode(boxes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tracks[0]
+		if tr.Codec() != tc.codec || tr.SampleRate != tc.rate || tr.ChannelCount != tc.channels {
+			t.Errorf("ASC % x: codec %s, %d Hz, %d channels, want %s, %d Hz, %d channels",
+				tc.asc, tr.Codec(), tr.SampleRate, tr.ChannelCount, tc.codec, tc.rate, tc.channels)
+		}
+	}
+}
+
+// encode writes boxes into a new buffer.
+func encode(boxes []mp4.Box) []byte {
+	w := mp4.NewGrowWriter(nil)
+	for _, b := range boxes {
+		w.WriteBox(b)
+	}
+	return w.Bytes()
+}
@@ -0,0 +1,209 @@
+package mp4
+
+import "io"
+
+// Node is a box in the tree built by [ParseTree].
+type Node struct {
+	Type         BoxType
+	ExtendedType [16]byte // uuid boxes only
+	Offset       int64    // file offset of the box header
+	Size         int64    // total box size including the header
+
+	// HeaderSize covers the size and type fields, the extended type of a
+	// uuid box, and the version and flags of a full box.
+	HeaderSize int
+	FullBox    bool
+	Version    uint8
+	Flags      uint32
+
+	// Box holds the decoded fields of a box type the package knows, such as
+	// an [*Mvhd] or a [*VisualSampleEntry] without its children, or nil for
+	// containers and unknown types. Err records why a known box failed to
+	// decode.
+	Box Box
+	Err error
+
+	// Data holds the box data after the header, or nil if the box was not
+	// loaded. See [Node.Body] to read it from the file.
+	Data []byte
+
+	Children []*Node
+
+	src ScannerAt
+}
+
+// Loaded reports whether the box's data was read into memory.
+func (n *Node) Loaded() bool { return n.Data != nil }
+
+// DataOffset returns the file offset of the box data.
+func (n *Node) DataOffset() int64 { return n.Offset + int64(n.HeaderSize) }
+
+// Body returns the box data, reading it from the file if it was not loaded.
+func (n *Node) Body() ([]byte, error) {
+	if n.Loaded() {
+		return n.Data, nil
+	}
+	if n.Size < int64(n.HeaderSize) || n.Size > n.src.size-n.Offset {
+		return nil, newScanError(n.Type, n.Offset, ErrInvalidBoxSize)
+	}
+	buf := make([]byte, n.Size-int64(n.HeaderSize))
+	if err := n.src.readFull(buf, n.DataOffset()); err != nil {
+		return nil, newScanError(n.Type, n.Offset, err)
+	}
+	return buf, nil
+}
+
+// Open returns a reader over the box data in the file, for streaming a large
+// box such as mdat without loading it.
+func (n *Node) Open() *io.SectionReader {
+	return io.NewSectionReader(n.src.ra, n.DataOffset(), n.Size-int64(n.HeaderSize))
+}
+
+// TreeOptions controls [ParseTree].
+type TreeOptions struct {
+	// MaxDepth limits the levels of the tree, counting top-level boxes as
+	// level 1. Zero means no limit.
+	MaxDepth int
+
+	// Load reports whether to read a top-level box into memory and parse its
+	// children. If nil, every box except mdat is loaded.
+	Load func(e ScanEntry) bool
+}
+
+// loadAllButMdat is the default load policy.
+func loadAllButMdat(e ScanEntry) bool { return e.Type != TypeMdat }
+
+// ParseTree builds the box tree of the first size bytes of ra. It descends into
+// containers, the entries of stsd and dref, sample entries and ilst items, and
+// decodes the boxes the package knows into Node.Box. opts may be nil for the
+// defaults, which load everything but mdat.
+//
+// A malformed box ends the parsing of the top-level box it is in; ParseTree
+// goes on with the next one and returns the tree together with the first such
+// error, a [*ParseError].
+func ParseTree(ra io.ReaderAt, size int64, opts *TreeOptions) ([]*Node, error) {
+	var o TreeOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Load == nil {
+		o.Load = loadAllButMdat
+	}
+	src := NewScannerAt(ra, size)
+
+	var nodes []*Node
+	var firstErr error
+	for off := int64(0); ; {
+		e, err := src.EntryAt(off)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			break
+		}
+		off = e.Offset + e.Size
+
+		if !o.Load(e) {
+			nodes = append(nodes, &Node{
+				Type:         e.Type,
+				ExtendedType: e.ExtendedType,
+				Offset:       e.Offset,
+				Size:         e.Size,
+				HeaderSize:   e.HeaderSize,
+				src:          src,
+			})
+			continue
+		}
+		buf := make([]byte, e.Size)
+		if err := src.ReadBox(e, buf); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			break
+		}
+		r := NewReader(buf)
+		r.SetOrigin("", e.Offset)
+		if r.Next() {
+			nodes = append(nodes, treeNode(&r, e.Offset, o.MaxDepth, src))
+		}
+		if err := r.Err(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nodes, firstErr
+}
+
+// treeNode builds the node of the reader's current box and its descendants.
+// base is the file offset of the reader's buffer.
+func treeNode(r *Reader, base int64, maxDepth int, src ScannerAt) *Node {
+	data := r.Data()
+	n := &Node{
+		Type:       r.boxType,
+		Offset:     base + int64(r.boxStart),
+		Size:       int64(r.boxSize),
+		HeaderSize: r.HeaderSize(),
+		FullBox:    IsFullBox(r.boxType),
+		Version:    r.version,
+		Flags:      r.flags,
+		Data:       data,
+		src:        src,
+	}
+	if n.Type == TypeUuid {
+		n.ExtendedType = r.extType
+	}
+
+	if _, ok := childOffset(r.parentType(), r.boxType, data); !ok {
+		n.decode(r)
+		return n
+	}
+	n.decodeSampleEntry(r)
+	if maxDepth > 0 && r.depth+1 >= maxDepth {
+		return n
+	}
+	for range r.Children() {
+		n.Children = append(n.Children, treeNode(r, base, maxDepth, src))
+	}
+	return n
+}
+
+// decode decodes a box without children into n.Box, unless its type is
+// unknown.
+func (n *Node) decode(r *Reader) {
+	b := NewBox(n.Type)
+	if _, raw := b.(*RawBox); raw {
+		return
+	}
+	data := n.Data
+	if n.Type == TypeUuid {
+		data = r.buf[r.dataStart-uuidSize : r.boxEnd]
+	}
+	if err := b.Decode(data, n.Version, n.Flags); err != nil {
+		n.Err = r.parseError(err)
+		return
+	}
+	n.Box = b
+}
+
+// decodeSampleEntry decodes the fixed fields of a sample entry into n.Box,
+// leaving its children to the tree.
+func (n *Node) decodeSampleEntry(r *Reader) {
+	var err error
+	switch {
+	case isVisualSampleEntry(n.Type):
+		var e VisualSampleEntry
+		e, err = ReadVisualSampleEntry(n.Data)
+		e.BoxType = n.Type
+		n.Box = &e
+	case isAudioSampleEntry(n.Type):
+		var e AudioSampleEntry
+		e, err = ReadAudioSampleEntry(n.Data)
+		e.BoxType = n.Type
+		n.Box = &e
+	}
+	if err != nil {
+		n.Box, n.Err = nil, r.parseError(err)
+	}
+}
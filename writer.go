@@ -1,20 +1,48 @@
 package mp4
 
-import "errors"
+import (
+	"errors"
+	"io"
+	"math/bits"
+	"slices"
+)
 
 // writerFrame tracks the start offset of a box for size backpatching.
 type writerFrame struct {
 	offset int
-}
-
-// ErrBoxTooLarge is returned by [Writer.Err] when a box exceeds the 4 GB
-// limit for standard (32-bit) box sizes.
-var ErrBoxTooLarge = errors.New("mp4: box size exceeds 4GB limit")
-
-// Writer encodes ISOBMFF boxes into the provided buffer.
+	large  bool // header carries a 64-bit largesize field
+}
+
+// Box header sizes: size and type, plus version and flags for a full box or a
+// 64-bit largesize for a large box.
+const (
+	boxHeaderSize      = 8
+	fullBoxHeaderSize  = 12
+	largeBoxHeaderSize = 16
+)
+
+var (
+	// ErrBoxTooLarge was returned by [Writer.Err] when a box exceeded the 4 GB
+	// limit for standard (32-bit) box sizes.
+	//
+	// Deprecated: [Writer.EndBox] now promotes such boxes to a 64-bit
+	// largesize header, so the Writer no longer returns this error.
+	ErrBoxTooLarge = errors.New("mp4: box size exceeds 4GB limit")
+
+	// ErrBufferFull is returned by [Writer.Err] when a fixed-size Writer runs
+	// out of room.
+	ErrBufferFull = errors.New("mp4: writer buffer full")
+)
+
+// Writer encodes ISOBMFF boxes into a buffer.
 //
-// The buffer must be large enough to hold all written data; writes beyond
-// the buffer boundary will panic.
+// A Writer works in one of three modes, chosen by its constructor:
+//
+//   - [NewWriter] writes into a fixed buffer. A write that does not fit
+//     records [ErrBufferFull].
+//   - [NewGrowWriter] starts from a buffer and grows it as needed.
+//   - [NewStreamWriter] buffers each top-level box until it is finished so its
+//     size can be backpatched, then writes it to an [io.Writer].
 //
 // Use [Writer.StartBox] and [Writer.EndBox] to write nested boxes:
 //
@@ -24,39 +52,141 @@ var ErrBoxTooLarge = errors.New("mp4: box size exceeds 4GB limit")
 //	w.EndBox()
 //	output := w.Bytes()
 //
-// After all writes, check [Writer.Err] for errors.
+// After all writes, check [Writer.Err] for errors. Once an error is recorded,
+// further writes are dropped.
 type Writer struct {
-	buf   []byte
-	pos   int
-	err   error // first deferred error
-	stack [maxDepth]writerFrame
-	depth int
-}
-
-// NewWriter creates a Writer that writes into buf.
+	buf      []byte
+	pos      int
+	err      error // first deferred error
+	stack    [maxDepth]writerFrame
+	depth    int
+	overflow int       // StartBox calls refused past maxDepth, unwound by EndBox
+	growable bool      // buf may be reallocated when full
+	dst      io.Writer // stream mode destination, nil otherwise
+	flushed  int64     // bytes already written to dst
+}
+
+// NewWriter creates a Writer that writes into buf. Writes beyond the capacity
+// of buf are dropped and reported as [ErrBufferFull].
 func NewWriter(buf []byte) Writer {
 	return Writer{buf: buf[:cap(buf)]}
 }
 
-// Bytes returns the written data.
+// NewGrowWriter creates a Writer that writes into buf and reallocates it when
+// it fills up. buf may be nil. Retrieve the result, which may no longer share
+// memory with buf, through [Writer.Bytes].
+func NewGrowWriter(buf []byte) Writer {
+	return Writer{buf: buf[:cap(buf)], growable: true}
+}
+
+// NewStreamWriter creates a Writer that sends its output to dst. Each
+// top-level box is held in buf, grown as needed, until [Writer.EndBox]
+// finishes it; then it is written to dst and the buffer is reused. Bytes
+// written outside any box pass straight through to dst.
+func NewStreamWriter(dst io.Writer, buf []byte) Writer {
+	return Writer{buf: buf[:cap(buf)], growable: true, dst: dst}
+}
+
+// Bytes returns the written data. For a stream Writer it returns only the
+// part of an unfinished top-level box that has not been written to dst.
 func (w *Writer) Bytes() []byte {
 	return w.buf[:w.pos]
 }
 
-// Len returns the number of bytes written.
+// Len returns the number of bytes in [Writer.Bytes].
+//
+// An offset taken with Len inside a box moves 8 bytes forward if
+// [Writer.EndBox] promotes that box, or one around it, to a largesize header.
+// Code that patches the buffer at such offsets, such as the trun data offsets
+// of a fragment writer, must do so before the box is finished or start it with
+// [Writer.StartLargeBox].
 func (w *Writer) Len() int { return w.pos }
 
+// Offset returns the total number of bytes written, including those a stream
+// Writer has already sent to its destination.
+func (w *Writer) Offset() int64 { return w.flushed + int64(w.pos) }
+
 // Err returns the first deferred error encountered during writing.
 func (w *Writer) Err() error { return w.err }
 
-// Write appends raw bytes. Implements io.Writer.
+// Write appends raw bytes. Implements io.Writer. A stream Writer outside any
+// box sends p directly to its destination.
 func (w *Writer) Write(p []byte) (int, error) {
+	if w.dst != nil && w.depth == 0 && w.overflow == 0 {
+		if w.Flush() != nil {
+			return 0, w.err
+		}
+		n, err := w.dst.Write(p)
+		w.flushed += int64(n)
+		if err != nil {
+			w.fail(err)
+		}
+		return n, err
+	}
+	if !w.reserve(len(p)) {
+		return 0, w.err
+	}
 	copy(w.buf[w.pos:], p)
 	n := len(p)
 	w.pos += n
 	return n, nil
 }
 
+// Flush writes buffered data to the destination of a stream Writer. Only
+// finished top-level boxes are buffered outside a box, so Flush between boxes
+// sends everything written so far. It is a no-op for other modes and inside a
+// box, where the sizes of open boxes are not yet known.
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.dst == nil || w.depth > 0 || w.overflow > 0 || w.pos == 0 {
+		return nil
+	}
+	n, err := w.dst.Write(w.buf[:w.pos])
+	w.flushed += int64(n)
+	w.pos = 0
+	if err != nil {
+		w.fail(err)
+	}
+	return err
+}
+
+// reserve reports whether n more bytes fit, growing the buffer if the mode
+// allows. Each box writer reserves its full encoded size up front, so the put
+// helpers below need no checks of their own.
+func (w *Writer) reserve(n int) bool {
+	if len(w.buf)-w.pos >= n {
+		return true
+	}
+	return w.grow(n)
+}
+
+// grow is the out-of-line part of reserve. It records [ErrBufferFull] and
+// returns false when the buffer cannot grow.
+func (w *Writer) grow(n int) bool {
+	if w.err != nil {
+		return false
+	}
+	if !w.growable {
+		w.fail(ErrBufferFull)
+		return false
+	}
+	w.buf = slices.Grow(w.buf[:w.pos], n)
+	w.buf = w.buf[:cap(w.buf)]
+	return true
+}
+
+// fail records err unless an error is already recorded. It also trims the
+// buffer to the written length, so every later reserve fails and the write is
+// dropped.
+func (w *Writer) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+	w.buf = w.buf[:w.pos]
+}
+
 // putUint8 appends a single byte.
 func (w *Writer) putUint8(v byte) {
 	w.buf[w.pos] = v
@@ -110,42 +240,138 @@ func (w *Writer) putFixedString(s string, length int) {
 	w.pos += length
 }
 
-// Reset resets the writer position to 0 and clears any error state.
+// Reset resets the writer position to 0 and clears any error state. The mode
+// and, for a stream Writer, the destination are kept.
 func (w *Writer) Reset() {
+	w.buf = w.buf[:cap(w.buf)]
 	w.pos = 0
 	w.depth = 0
+	w.overflow = 0
+	w.flushed = 0
 	w.err = nil
 }
 
-// StartBox begins a new box. Write content, then call EndBox.
+// StartBox begins a new box. Write content, then call EndBox. Nesting deeper
+// than the Writer supports records [ErrTooDeep].
 func (w *Writer) StartBox(t BoxType) {
-	w.stack[w.depth] = writerFrame{offset: w.pos}
+	w.startBox(t, false)
+}
+
+// StartLargeBox begins a new box with a 16-byte header carrying a 64-bit size.
+// Use it for boxes, typically mdat, that are expected to exceed 4 GB. EndBox
+// promotes a box started with StartBox as well, but must then move its
+// contents to make room for the larger header.
+func (w *Writer) StartLargeBox(t BoxType) {
+	w.startBox(t, true)
+}
+
+func (w *Writer) startBox(t BoxType, large bool) {
+	if w.depth == maxDepth {
+		w.overflow++
+		w.fail(ErrTooDeep)
+		return
+	}
+	w.stack[w.depth] = writerFrame{offset: w.pos, large: large}
 	w.depth++
+	n := boxHeaderSize
+	if large {
+		n = largeBoxHeaderSize
+	}
+	if !w.reserve(n) {
+		return
+	}
+	if large {
+		w.putUint32(1) // size is in the largesize field
+		w.putBytes(t[:])
+		w.putUint64(0) // placeholder largesize
+		return
+	}
 	w.putUint32(0) // placeholder size
 	w.putBytes(t[:])
 }
 
+// StartUUIDBox begins a uuid box with the given extended type.
+func (w *Writer) StartUUIDBox(extendedType [16]byte) {
+	w.StartBox(TypeUuid)
+	if !w.reserve(uuidSize) {
+		return
+	}
+	w.putBytes(extendedType[:])
+}
+
 // StartFullBox begins a new full box with version and flags.
 func (w *Writer) StartFullBox(t BoxType, version uint8, flags uint32) {
 	w.StartBox(t)
+	if !w.reserve(4) {
+		return
+	}
 	vf := (uint32(version) << 24) | (flags & 0x00ffffff)
 	w.putUint32(vf)
 }
 
-// EndBox finishes the current box by backpatching its size.
+// EndBox finishes the current box by backpatching its size. A box that has
+// grown past 4 GB is promoted to a 64-bit largesize header: its contents move
+// 8 bytes forward, so offsets recorded inside it with [Writer.Len] shift too.
+// A stream Writer sends the box to its destination once the outermost box is
+// finished.
 func (w *Writer) EndBox() {
+	if w.overflow > 0 {
+		w.overflow--
+		return
+	}
+	if w.depth == 0 {
+		return
+	}
 	w.depth--
+	if w.err != nil {
+		return
+	}
 	f := w.stack[w.depth]
 	size := w.pos - f.offset
-	if w.err == nil && uint64(size) > uint64(uint32Max) {
-		w.err = ErrBoxTooLarge
+	switch {
+	case f.large:
+		be.PutUint64(w.buf[f.offset+8:], uint64(size))
+	case uint64(size) > maxCompactBoxSize:
+		w.promote(f.offset)
+	default:
+		be.PutUint32(w.buf[f.offset:], uint32(size))
+	}
+	if w.depth == 0 && w.dst != nil {
+		w.Flush()
+	}
+}
+
+// maxCompactBoxSize is the largest box EndBox writes with a 32-bit size. It is
+// a variable so tests can force promotion without writing 4 GB.
+var maxCompactBoxSize uint64 = uint32Max
+
+// promote rewrites the box at offset, which runs to the current position, with
+// a largesize header, shifting its contents to make room.
+func (w *Writer) promote(offset int) {
+	if !w.reserve(8) {
 		return
 	}
-	be.PutUint32(w.buf[f.offset:], uint32(size))
+	body := offset + boxHeaderSize
+	copy(w.buf[body+8:w.pos+8], w.buf[body:w.pos])
+	w.pos += 8
+	be.PutUint32(w.buf[offset:], 1)
+	be.PutUint64(w.buf[body:], uint64(w.pos-offset))
+}
+
+// versionFor returns the full box version needed to store v: 1 when it does
+// not fit in 32 bits, 0 otherwise.
+func versionFor(v uint64) uint8 {
+	if v > uint32Max {
+		return 1
+	}
+	return 0
 }
 
 // WriteFtyp writes a complete ftyp box.
 func (w *Writer) WriteFtyp(brand [4]byte, brandVersion uint32, compat [][4]byte) {
+	if !w.reserve(boxHeaderSize + 8 + 4*len(compat)) {
+		return
+	}
 	w.StartBox(TypeFtyp)
 	w.putBytes(brand[:])
 	w.putUint32(brandVersion)
@@ -155,98 +381,46 @@ func (w *Writer) WriteFtyp(brand [4]byte, brandVersion uint32, compat [][4]byte)
 	w.EndBox()
 }
 
-// WriteMvhd writes a complete mvhd box.
+// WriteMvhd writes a complete mvhd box with normal rate and volume, the
+// identity matrix and unset times. Use [Mvhd] to control the other fields.
 func (w *Writer) WriteMvhd(timescale uint32, duration uint64, nextTrackId uint32) {
-	if duration > uint32Max {
-		w.StartFullBox(TypeMvhd, 1, 0)
-		w.putUint64(0) // creation time
-		w.putUint64(0) // modification time
-		w.putUint32(timescale)
-		w.putUint64(duration)
-	} else {
-		w.StartFullBox(TypeMvhd, 0, 0)
-		w.putUint32(0) // creation time
-		w.putUint32(0) // modification time
-		w.putUint32(timescale)
-		w.putUint32(uint32(duration))
-	}
-	w.putUint32(0x00010000) // rate 1.0
-	w.putUint16(0x0100)     // volume 1.0
-	w.putZeros(10)          // reserved
-	// Identity matrix
-	w.putUint32(0x00010000)
-	w.putZeros(4)
-	w.putZeros(4)
-	w.putZeros(4)
-	w.putUint32(0x00010000)
-	w.putZeros(4)
-	w.putZeros(4)
-	w.putZeros(4)
-	w.putUint32(0x40000000)
-	w.putZeros(24) // predefined
-	w.putUint32(nextTrackId)
-	w.EndBox()
+	h := Mvhd{
+		Timescale:   timescale,
+		Duration:    duration,
+		Rate:        0x00010000,
+		Volume:      0x0100,
+		Matrix:      IdentityMatrix,
+		NextTrackID: nextTrackId,
+	}
+	h.Encode(w)
 }
 
-// WriteTkhd writes a complete tkhd box.
+// WriteTkhd writes a complete tkhd box with the identity matrix and unset
+// times. Use [Tkhd] to control the other fields.
 func (w *Writer) WriteTkhd(flags uint32, trackId uint32, duration uint64, width, height uint32) {
-	if duration > uint32Max {
-		w.StartFullBox(TypeTkhd, 1, flags)
-		w.putUint64(0) // creation time
-		w.putUint64(0) // modification time
-		w.putUint32(trackId)
-		w.putUint32(0) // reserved
-		w.putUint64(duration)
-	} else {
-		w.StartFullBox(TypeTkhd, 0, flags)
-		w.putUint32(0) // creation time
-		w.putUint32(0) // modification time
-		w.putUint32(trackId)
-		w.putUint32(0) // reserved
-		w.putUint32(uint32(duration))
-	}
-	w.putZeros(8)  // reserved
-	w.putUint16(0) // layer
-	w.putUint16(0) // alternate group
-	w.putUint16(0) // volume
-	w.putUint16(0) // reserved
-	// Identity matrix
-	w.putUint32(0x00010000)
-	w.putZeros(4)
-	w.putZeros(4)
-	w.putZeros(4)
-	w.putUint32(0x00010000)
-	w.putZeros(4)
-	w.putZeros(4)
-	w.putZeros(4)
-	w.putUint32(0x40000000)
-	w.putUint32(width)
-	w.putUint32(height)
-	w.EndBox()
+	h := Tkhd{
+		FullHeader: FullHeader{Flags: flags},
+		TrackID:    trackId,
+		Duration:   duration,
+		Matrix:     IdentityMatrix,
+		Width:      width,
+		Height:     height,
+	}
+	h.Encode(w)
 }
 
-// WriteMdhd writes a complete mdhd box.
-func (w *Writer) WriteMdhd(timescale uint32, duration uint64, language uint16) {
-	if duration > uint32Max {
-		w.StartFullBox(TypeMdhd, 1, 0)
-		w.putUint64(0) // creation time
-		w.putUint64(0) // modification time
-		w.putUint32(timescale)
-		w.putUint64(duration)
-	} else {
-		w.StartFullBox(TypeMdhd, 0, 0)
-		w.putUint32(0) // creation time
-		w.putUint32(0) // modification time
-		w.putUint32(timescale)
-		w.putUint32(uint32(duration))
-	}
-	w.putUint16(language)
-	w.putUint16(0) // quality
-	w.EndBox()
+// WriteMdhd writes a complete mdhd box with unset times. Use [Mdhd] to
+// control the other fields.
+func (w *Writer) WriteMdhd(timescale uint32, duration uint64, language string) {
+	h := Mdhd{Timescale: timescale, Duration: duration, Language: EncodeLanguage(language)}
+	h.Encode(w)
 }
 
 // WriteHdlr writes a complete hdlr box.
 func (w *Writer) WriteHdlr(handlerType [4]byte, name string) {
+	if !w.reserve(fullBoxHeaderSize + 20 + len(name) + 1) {
+		return
+	}
 	w.StartFullBox(TypeHdlr, 0, 0)
 	w.putUint32(0) // predefined
 	w.putBytes(handlerType[:])
@@ -256,8 +430,18 @@ func (w *Writer) WriteHdlr(handlerType [4]byte, name string) {
 	w.EndBox()
 }
 
+// WriteElng writes a complete elng box holding a BCP 47 language tag, such as
+// "en-US". It belongs in mdia after the hdlr.
+func (w *Writer) WriteElng(tag string) {
+	b := Elng{ExtendedLanguage: tag}
+	b.Encode(w)
+}
+
 // WriteVmhd writes a complete vmhd box.
 func (w *Writer) WriteVmhd() {
+	if !w.reserve(fullBoxHeaderSize + 8) {
+		return
+	}
 	w.StartFullBox(TypeVmhd, 0, 1)
 	w.putUint16(0) // graphicsmode
 	w.putZeros(6)  // opcolor
@@ -266,6 +450,9 @@ func (w *Writer) WriteVmhd() {
 
 // WriteSmhd writes a complete smhd box.
 func (w *Writer) WriteSmhd() {
+	if !w.reserve(fullBoxHeaderSize + 4) {
+		return
+	}
 	w.StartFullBox(TypeSmhd, 0, 0)
 	w.putUint16(0) // balance
 	w.putUint16(0) // reserved
@@ -274,16 +461,39 @@ func (w *Writer) WriteSmhd() {
 
 // WriteDref writes a dref box with a single self-referencing url entry.
 func (w *Writer) WriteDref() {
+	if !w.reserve(2*fullBoxHeaderSize + 4) {
+		return
+	}
 	w.StartFullBox(TypeDref, 0, 0)
 	w.putUint32(1) // entry count
 	// url entry: self-contained
-	w.StartFullBox(BoxType{'u', 'r', 'l', ' '}, 0, 1)
+	w.StartFullBox(TypeUrl, 0, UrlSelfContained)
 	w.EndBox()
 	w.EndBox()
 }
 
+// WriteEsds writes a complete esds box holding es, with the shortest length
+// fields. A descriptor too large for its length field records
+// [ErrInvalidDescriptor].
+func (w *Writer) WriteEsds(es *ESDescriptor) {
+	n := es.size()
+	if n > maxDescriptorSize {
+		w.fail(ErrInvalidDescriptor)
+		return
+	}
+	if !w.reserve(fullBoxHeaderSize + descriptorSize(n)) {
+		return
+	}
+	w.StartFullBox(TypeEsds, 0, 0)
+	w.putESDescriptor(es, n)
+	w.EndBox()
+}
+
 // WriteStsz writes a complete stsz box from an iterator or raw entries.
 func (w *Writer) WriteStsz(sampleSize uint32, entries []uint32) {
+	if !w.reserve(fullBoxHeaderSize + 8 + 4*len(entries)) {
+		return
+	}
 	w.StartFullBox(TypeStsz, 0, 0)
 	w.putUint32(sampleSize)
 	w.putUint32(uint32(len(entries)))
@@ -297,6 +507,9 @@ func (w *Writer) WriteStsz(sampleSize uint32, entries []uint32) {
 
 // WriteStco writes a complete stco box.
 func (w *Writer) WriteStco(entries []uint32) {
+	if !w.reserve(fullBoxHeaderSize + 4 + 4*len(entries)) {
+		return
+	}
 	w.StartFullBox(TypeStco, 0, 0)
 	w.putUint32(uint32(len(entries)))
 	for _, e := range entries {
@@ -307,6 +520,9 @@ func (w *Writer) WriteStco(entries []uint32) {
 
 // WriteCo64 writes a complete co64 box.
 func (w *Writer) WriteCo64(entries []uint64) {
+	if !w.reserve(fullBoxHeaderSize + 4 + 8*len(entries)) {
+		return
+	}
 	w.StartFullBox(TypeCo64, 0, 0)
 	w.putUint32(uint32(len(entries)))
 	for _, e := range entries {
@@ -317,6 +533,9 @@ func (w *Writer) WriteCo64(entries []uint64) {
 
 // WriteStss writes a complete stss box.
 func (w *Writer) WriteStss(entries []uint32) {
+	if !w.reserve(fullBoxHeaderSize + 4 + 4*len(entries)) {
+		return
+	}
 	w.StartFullBox(TypeStss, 0, 0)
 	w.putUint32(uint32(len(entries)))
 	for _, e := range entries {
@@ -327,6 +546,9 @@ func (w *Writer) WriteStss(entries []uint32) {
 
 // WriteStts writes a complete stts box.
 func (w *Writer) WriteStts(entries []SttsEntry) {
+	if !w.reserve(fullBoxHeaderSize + 4 + 8*len(entries)) {
+		return
+	}
 	w.StartFullBox(TypeStts, 0, 0)
 	w.putUint32(uint32(len(entries)))
 	for _, e := range entries {
@@ -338,6 +560,9 @@ func (w *Writer) WriteStts(entries []SttsEntry) {
 
 // WriteCtts writes a complete ctts box.
 func (w *Writer) WriteCtts(entries []CttsEntry) {
+	if !w.reserve(fullBoxHeaderSize + 4 + 8*len(entries)) {
+		return
+	}
 	w.StartFullBox(TypeCtts, 0, 0)
 	w.putUint32(uint32(len(entries)))
 	for _, e := range entries {
@@ -349,6 +574,9 @@ func (w *Writer) WriteCtts(entries []CttsEntry) {
 
 // WriteStsc writes a complete stsc box.
 func (w *Writer) WriteStsc(entries []StscEntry) {
+	if !w.reserve(fullBoxHeaderSize + 4 + 12*len(entries)) {
+		return
+	}
 	w.StartFullBox(TypeStsc, 0, 0)
 	w.putUint32(uint32(len(entries)))
 	for _, e := range entries {
@@ -359,6 +587,73 @@ func (w *Writer) WriteStsc(entries []StscEntry) {
 	w.EndBox()
 }
 
+// WriteSdtp writes a complete sdtp box with one entry per sample.
+func (w *Writer) WriteSdtp(entries []SampleDependency) {
+	if !w.reserve(fullBoxHeaderSize + len(entries)) {
+		return
+	}
+	w.StartFullBox(TypeSdtp, 0, 0)
+	for _, e := range entries {
+		w.putUint8(uint8(e))
+	}
+	w.EndBox()
+}
+
+// WriteSubs writes a complete subs box. It uses version 1 if any subsample is
+// larger than 16 bits allow. The meaning of flags is codec specific.
+func (w *Writer) WriteSubs(flags uint32, entries []SubsEntry) {
+	b := Subs{FullHeader: FullHeader{Flags: flags}, Entries: entries}
+	b.Encode(w)
+}
+
+// WriteSbgp writes a complete version 0 sbgp box.
+func (w *Writer) WriteSbgp(groupingType [4]byte, entries []SbgpEntry) {
+	if !w.reserve(fullBoxHeaderSize + 8 + 8*len(entries)) {
+		return
+	}
+	w.StartFullBox(TypeSbgp, 0, 0)
+	w.putBytes(groupingType[:])
+	w.putUint32(uint32(len(entries)))
+	for _, e := range entries {
+		w.putUint32(e.SampleCount)
+		w.putUint32(e.GroupDescriptionIndex)
+	}
+	w.EndBox()
+}
+
+// WriteSgpd writes a complete version 1 sgpd box. Entries that all have the
+// same length share a default length; otherwise each is written with its own.
+func (w *Writer) WriteSgpd(groupingType [4]byte, entries [][]byte) {
+	var defaultLength uint32
+	if len(entries) > 0 {
+		defaultLength = uint32(len(entries[0]))
+	}
+	n := fullBoxHeaderSize + 12
+	for _, e := range entries {
+		if uint32(len(e)) != defaultLength {
+			defaultLength = 0
+		}
+		n += len(e)
+	}
+	if defaultLength == 0 {
+		n += 4 * len(entries)
+	}
+	if !w.reserve(n) {
+		return
+	}
+	w.StartFullBox(TypeSgpd, 1, 0)
+	w.putBytes(groupingType[:])
+	w.putUint32(defaultLength)
+	w.putUint32(uint32(len(entries)))
+	for _, e := range entries {
+		if defaultLength == 0 {
+			w.putUint32(uint32(len(e)))
+		}
+		w.putBytes(e)
+	}
+	w.EndBox()
+}
+
 // WriteElst writes a complete elst box.
 func (w *Writer) WriteElst(entries []ElstEntry) {
 	// Determine if v1 is needed
@@ -369,6 +664,13 @@ func (w *Writer) WriteElst(entries []ElstEntry) {
 			break
 		}
 	}
+	entrySize := 12
+	if v1 {
+		entrySize = 20
+	}
+	if !w.reserve(fullBoxHeaderSize + 4 + entrySize*len(entries)) {
+		return
+	}
 	if v1 {
 		w.StartFullBox(TypeElst, 1, 0)
 	} else {
@@ -391,6 +693,9 @@ func (w *Writer) WriteElst(entries []ElstEntry) {
 
 // WriteMehd writes a complete mehd box.
 func (w *Writer) WriteMehd(fragmentDuration uint64) {
+	if !w.reserve(fullBoxHeaderSize + versionedSize(versionFor(fragmentDuration), 4, 8)) {
+		return
+	}
 	if fragmentDuration > uint32Max {
 		w.StartFullBox(TypeMehd, 1, 0)
 		w.putUint64(fragmentDuration)
@@ -403,6 +708,9 @@ func (w *Writer) WriteMehd(fragmentDuration uint64) {
 
 // WriteTrex writes a complete trex box.
 func (w *Writer) WriteTrex(trackId, descIdx, defDuration, defSize, defFlags uint32) {
+	if !w.reserve(fullBoxHeaderSize + 20) {
+		return
+	}
 	w.StartFullBox(TypeTrex, 0, 0)
 	w.putUint32(trackId)
 	w.putUint32(descIdx)
@@ -414,6 +722,9 @@ func (w *Writer) WriteTrex(trackId, descIdx, defDuration, defSize, defFlags uint
 
 // WriteMfhd writes a complete mfhd box.
 func (w *Writer) WriteMfhd(sequenceNumber uint32) {
+	if !w.reserve(fullBoxHeaderSize + 4) {
+		return
+	}
 	w.StartFullBox(TypeMfhd, 0, 0)
 	w.putUint32(sequenceNumber)
 	w.EndBox()
@@ -423,6 +734,11 @@ func (w *Writer) WriteMfhd(sequenceNumber uint32) {
 // WriteTfhd writes a track fragment header. Default sample duration, size, and
 // flags are written when their corresponding flag bits are set.
 func (w *Writer) WriteTfhd(flags, trackId, defaultDuration, defaultSize, defaultFlags uint32) {
+	defaults := bits.OnesCount32(flags & (TfhdDefaultSampleDurationPresent |
+		TfhdDefaultSampleSizePresent | TfhdDefaultSampleFlagsPresent))
+	if !w.reserve(fullBoxHeaderSize + 4 + 4*defaults) {
+		return
+	}
 	w.StartFullBox(TypeTfhd, 0, flags)
 	w.putUint32(trackId)
 	if flags&TfhdDefaultSampleDurationPresent != 0 {
@@ -439,6 +755,9 @@ func (w *Writer) WriteTfhd(flags, trackId, defaultDuration, defaultSize, default
 
 // WriteTfdt writes a complete tfdt box.
 func (w *Writer) WriteTfdt(baseMediaDecodeTime uint64) {
+	if !w.reserve(fullBoxHeaderSize + versionedSize(versionFor(baseMediaDecodeTime), 4, 8)) {
+		return
+	}
 	if baseMediaDecodeTime > uint32Max {
 		w.StartFullBox(TypeTfdt, 1, 0)
 		w.putUint64(baseMediaDecodeTime)
@@ -453,6 +772,12 @@ func (w *Writer) WriteTfdt(baseMediaDecodeTime uint64) {
 // WriteTrun writes a track run. firstSampleFlags is written when
 // TrunFirstSampleFlagsPresent is set, overriding the default for sample one.
 func (w *Writer) WriteTrun(flags uint32, dataOffset int32, firstSampleFlags uint32, entries []TrunEntry) {
+	headerFields := bits.OnesCount32(flags & (TrunDataOffsetPresent | TrunFirstSampleFlagsPresent))
+	sampleFields := bits.OnesCount32(flags & (TrunSampleDurationPresent | TrunSampleSizePresent |
+		TrunSampleFlagsPresent | TrunSampleCompositionTimeOffsetPresent))
+	if !w.reserve(fullBoxHeaderSize + 4 + 4*headerFields + 4*sampleFields*len(entries)) {
+		return
+	}
 	w.StartFullBox(TypeTrun, 0, flags)
 	w.putUint32(uint32(len(entries)))
 	if flags&TrunDataOffsetPresent != 0 {
@@ -481,6 +806,9 @@ func (w *Writer) WriteTrun(flags uint32, dataOffset int32, firstSampleFlags uint
 // WriteVisualSampleEntry writes the 78-byte visual sample entry header.
 // The caller must start the box (e.g. avc1) and end it after writing children.
 func (w *Writer) WriteVisualSampleEntry(dataRefIdx, width, height, frameCount, depth uint16, compressor string) {
+	if !w.reserve(visualSampleEntrySize) {
+		return
+	}
 	w.putZeros(6)           // reserved
 	w.putUint16(dataRefIdx) // data reference index
 	w.putZeros(16)          // predefined + reserved
@@ -500,6 +828,9 @@ func (w *Writer) WriteVisualSampleEntry(dataRefIdx, width, height, frameCount, d
 // WriteAudioSampleEntry writes the 28-byte audio sample entry header.
 // The caller must start the box (e.g. mp4a) and end it after writing children.
 func (w *Writer) WriteAudioSampleEntry(dataRefIdx, channelCount, sampleSize uint16, sampleRate uint32) {
+	if !w.reserve(audioSampleEntrySize) {
+		return
+	}
 	w.putZeros(6)             // reserved
 	w.putUint16(dataRefIdx)   // data reference index
 	w.putZeros(8)             // reserved
@@ -511,6 +842,9 @@ func (w *Writer) WriteAudioSampleEntry(dataRefIdx, channelCount, sampleSize uint
 
 // WriteStyp writes a segment type box (same format as ftyp).
 func (w *Writer) WriteStyp(brand [4]byte, brandVersion uint32, compat [][4]byte) {
+	if !w.reserve(boxHeaderSize + 8 + 4*len(compat)) {
+		return
+	}
 	w.StartBox(TypeStyp)
 	w.putBytes(brand[:])
 	w.putUint32(brandVersion)
@@ -520,6 +854,11 @@ func (w *Writer) WriteStyp(brand [4]byte, brandVersion uint32, compat [][4]byte)
 	w.EndBox()
 }
 
+// WriteEmsg writes a complete emsg box in the version e.Version selects.
+func (w *Writer) WriteEmsg(e *Emsg) {
+	e.Encode(w)
+}
+
 // SidxEntry represents one reference in a sidx box.
 type SidxEntry struct {
 	ReferenceType  bool   // false = media, true = sub-sidx
@@ -527,10 +866,14 @@ type SidxEntry struct {
 	SubsegDuration uint32 // duration in timescale units
 	StartsWithSAP  bool   // starts with a stream access point
 	SAPType        uint8  // SAP type (1-6)
+	SAPDeltaTime   uint32 // SAP time relative to the subsegment start (28 bits)
 }
 
 // WriteSidx writes a segment index box (version 1, 64-bit times).
 func (w *Writer) WriteSidx(trackID uint32, timescale uint32, earliestPTS uint64, firstOffset uint64, entries []SidxEntry) {
+	if !w.reserve(fullBoxHeaderSize + 28 + sidxEntrySize*len(entries)) {
+		return
+	}
 	w.StartFullBox(TypeSidx, 1, 0)
 	w.putUint32(trackID) // reference_ID
 	w.putUint32(timescale)
@@ -539,19 +882,96 @@ func (w *Writer) WriteSidx(trackID uint32, timescale uint32, earliestPTS uint64,
 	w.putUint16(0)                    // reserved
 	w.putUint16(uint16(len(entries))) // reference_count
 	for _, e := range entries {
-		var refTypeAndSize uint32
-		if e.ReferenceType {
-			refTypeAndSize = 0x80000000
-		}
-		refTypeAndSize |= e.ReferencedSize & 0x7FFFFFFF
-		w.putUint32(refTypeAndSize)
-		w.putUint32(e.SubsegDuration)
-		var sapField uint32
-		if e.StartsWithSAP {
-			sapField = 0x80000000
+		w.putSidxEntry(e)
+	}
+	w.EndBox()
+}
+
+// WriteSidxTree writes a two-level segment index for entries, which must
+// all reference media. A top-level sidx references one sub-sidx per group of
+// perSidx consecutive entries, and the sub-sidx boxes follow it directly, so
+// a client can fetch the whole index with one request. The media the entries
+// describe must follow the last sub-sidx.
+func (w *Writer) WriteSidxTree(trackID uint32, timescale uint32, earliestPTS uint64, entries []SidxEntry, perSidx int) {
+	if perSidx <= 0 {
+		perSidx = len(entries)
+	}
+	groups := (len(entries) + perSidx - 1) / perSidx
+	subSize := func(n int) int { return fullBoxHeaderSize + 28 + sidxEntrySize*n }
+	total := subSize(groups)
+	for g := range groups {
+		total += subSize(min(perSidx, len(entries)-g*perSidx))
+	}
+	if !w.reserve(total) {
+		return
+	}
+
+	w.StartFullBox(TypeSidx, 1, 0)
+	w.putUint32(trackID)
+	w.putUint32(timescale)
+	w.putUint64(earliestPTS)
+	w.putUint64(0) // first_offset: the sub-sidx boxes follow
+	w.putUint16(0) // reserved
+	w.putUint16(uint16(groups))
+	for g := range groups {
+		group := entries[g*perSidx : min((g+1)*perSidx, len(entries))]
+		var dur uint32
+		for _, e := range group {
+			dur += e.SubsegDuration
 		}
-		sapField |= uint32(e.SAPType) << 28
-		w.putUint32(sapField)
+		w.putSidxEntry(SidxEntry{
+			ReferenceType:  true,
+			ReferencedSize: uint32(subSize(len(group))),
+			SubsegDuration: dur,
+			StartsWithSAP:  group[0].StartsWithSAP,
+			SAPType:        group[0].SAPType,
+			SAPDeltaTime:   group[0].SAPDeltaTime,
+		})
 	}
 	w.EndBox()
+
+	// Each sub-sidx skips the sub-sidx boxes after it and the media of the
+	// groups before it.
+	skip := uint64(total - subSize(groups))
+	pts := earliestPTS
+	for g := range groups {
+		group := entries[g*perSidx : min((g+1)*perSidx, len(entries))]
+		skip -= uint64(subSize(len(group)))
+		w.StartFullBox(TypeSidx, 1, 0)
+		w.putUint32(trackID)
+		w.putUint32(timescale)
+		w.putUint64(pts)
+		w.putUint64(skip)
+		w.putUint16(0) // reserved
+		w.putUint16(uint16(len(group)))
+		for _, e := range group {
+			w.putSidxEntry(e)
+			skip += uint64(e.ReferencedSize)
+			pts += uint64(e.SubsegDuration)
+		}
+		w.EndBox()
+	}
+}
+
+// sidxEntrySize is the size of one sidx reference.
+const sidxEntrySize = 12
+
+// putSidxEntry writes one sidx reference.
+func (w *Writer) putSidxEntry(e SidxEntry) {
+	w.putUint32(uint32(bit(e.ReferenceType, 7))<<24 | e.ReferencedSize&0x7fffffff)
+	w.putUint32(e.SubsegDuration)
+	w.putUint32(uint32(bit(e.StartsWithSAP, 7))<<24 | uint32(e.SAPType&0x07)<<28 | e.SAPDeltaTime&0x0fffffff)
+}
+
+// readSidxEntry parses one sidx reference.
+func readSidxEntry(p []byte) SidxEntry {
+	ref, sap := be.Uint32(p[0:4]), be.Uint32(p[8:12])
+	return SidxEntry{
+		ReferenceType:  ref&0x80000000 != 0,
+		ReferencedSize: ref & 0x7fffffff,
+		SubsegDuration: be.Uint32(p[4:8]),
+		StartsWithSAP:  sap&0x80000000 != 0,
+		SAPType:        uint8(sap >> 28 & 0x07),
+		SAPDeltaTime:   sap & 0x0fffffff,
+	}
 }
@@ -0,0 +1,57 @@
+package mp4
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriterPromote(t *testing.T) {
+	defer func(n uint64) { maxCompactBoxSize = n }(maxCompactBoxSize)
+	maxCompactBoxSize = 32
+
+	body := bytes.Repeat([]byte{0xab, 0xcd}, 20)
+	w := NewGrowWriter(nil)
+	w.StartBox(TypeMoov)
+	w.StartBox(TypeMdat)
+	w.Write(body)
+	w.EndBox() // 48 bytes: promoted to 56
+	w.StartBox(TypeFree)
+	w.EndBox() // 8 bytes: stays compact
+	w.EndBox() // 72 bytes with the promoted mdat: promoted to 80
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := w.Bytes()
+	if len(b) != 80 {
+		t.Fatalf("wrote %d bytes, want 80", len(b))
+	}
+	for _, h := range []struct {
+		off  int
+		typ  BoxType
+		size uint64
+	}{{0, TypeMoov, 80}, {16, TypeMdat, 56}} {
+		if be.Uint32(b[h.off:]) != 1 || BoxType(b[h.off+4:h.off+8]) != h.typ || be.Uint64(b[h.off+8:]) != h.size {
+			t.Errorf("%s header = % x, want size 1 and largesize %d", h.typ, b[h.off:h.off+16], h.size)
+		}
+	}
+
+	r := NewReader(b)
+	if !r.Next() || r.Type() != TypeMoov || r.Size() != 80 {
+		t.Fatalf("moov: type %s size %d, err %v", r.Type(), r.Size(), r.Err())
+	}
+	r.Enter()
+	if !r.Next() || r.Type() != TypeMdat || r.Size() != 56 || !bytes.Equal(r.Data(), body) {
+		t.Errorf("mdat: type %s size %d data % x", r.Type(), r.Size(), r.Data())
+	}
+	if !r.Next() || r.Type() != TypeFree || r.Size() != 8 {
+		t.Errorf("free: type %s size %d", r.Type(), r.Size())
+	}
+	if r.Next() {
+		t.Errorf("unexpected %s after free", r.Type())
+	}
+	r.Exit()
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,278 @@
+package mp4_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tetsuo/mp4"
+)
+
+func writeSampleMoov(w *mp4.Writer) {
+	w.StartBox(mp4.TypeMoov)
+	w.WriteMvhd(1000, 30000, 2)
+	w.StartBox(mp4.TypeTrak)
+	w.WriteTkhd(3, 1, 30000, 1920, 1080)
+	w.EndBox()
+	w.EndBox()
+}
+
+func TestWriterOverflow(t *testing.T) {
+	w := mp4.NewWriter(make([]byte, 32))
+	writeSampleMoov(&w)
+	if !errors.Is(w.Err(), mp4.ErrBufferFull) {
+		t.Fatalf("Err = %v, want ErrBufferFull", w.Err())
+	}
+	if w.Len() > 32 {
+		t.Errorf("Len = %d past buffer capacity", w.Len())
+	}
+}
+
+func TestWriterGrow(t *testing.T) {
+	fixed := mp4.NewWriter(make([]byte, 1024))
+	writeSampleMoov(&fixed)
+
+	w := mp4.NewGrowWriter(nil)
+	writeSampleMoov(&w)
+	if err := w.Err(); err != nil {
+		t.Fatalf("Err = %v", err)
+	}
+	if !bytes.Equal(w.Bytes(), fixed.Bytes()) {
+		t.Error("grown output differs from fixed-buffer output")
+	}
+}
+
+func TestWriterStream(t *testing.T) {
+	var out bytes.Buffer
+	w := mp4.NewStreamWriter(&out, make([]byte, 16))
+	w.WriteFtyp([4]byte{'i', 's', 'o', '5'}, 0, nil)
+	writeSampleMoov(&w)
+	w.StartBox(mp4.TypeMdat)
+	w.Write([]byte{1, 2, 3})
+	w.EndBox()
+	if err := w.Err(); err != nil {
+		t.Fatalf("Err = %v", err)
+	}
+	if w.Len() != 0 {
+		t.Errorf("Len = %d after finishing all boxes, want 0", w.Len())
+	}
+	if w.Offset() != int64(out.Len()) {
+		t.Errorf("Offset = %d, want %d", w.Offset(), out.Len())
+	}
+
+	r := mp4.NewReader(out.Bytes())
+	var types []mp4.BoxType
+	for r.Next() {
+		types = append(types, r.Type())
+	}
+	want := []mp4.BoxType{mp4.TypeFtyp, mp4.TypeMoov, mp4.TypeMdat}
+	if len(types) != len(want) || r.Err() != nil {
+		t.Fatalf("boxes = %v (err %v), want %v", types, r.Err(), want)
+	}
+}
+
+func TestWriterTooDeep(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	for range 20 {
+		w.StartBox(mp4.TypeMoov)
+	}
+	for range 20 {
+		w.EndBox()
+	}
+	if !errors.Is(w.Err(), mp4.ErrTooDeep) {
+		t.Errorf("Err = %v, want ErrTooDeep", w.Err())
+	}
+}
+
+func TestWriterLargeBox(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	w.StartLargeBox(mp4.TypeMdat)
+	w.Write([]byte{1, 2, 3, 4})
+	w.EndBox()
+	if err := w.Err(); err != nil {
+		t.Fatalf("Err = %v", err)
+	}
+	if w.Len() != 20 {
+		t.Fatalf("Len = %d, want 20", w.Len())
+	}
+
+	r := mp4.NewReader(w.Bytes())
+	if !r.Next() || r.Type() != mp4.TypeMdat {
+		t.Fatalf("Next = %v (err %v), want mdat", r.Type(), r.Err())
+	}
+	if got := r.Data(); !bytes.Equal(got, []byte{1, 2, 3, 4}) {
+		t.Errorf("Data = %v, want [1 2 3 4]", got)
+	}
+
+	sc := mp4.NewScanner(bytes.NewReader(w.Bytes()))
+	if !sc.Next() {
+		t.Fatalf("Scanner.Next failed: %v", sc.Err())
+	}
+	if e := sc.Entry(); e.HeaderSize != 16 || e.Size != 20 {
+		t.Errorf("entry = %+v, want 16-byte header and size 20", e)
+	}
+}
+
+func TestWriteSampleGroups(t *testing.T) {
+	seig := mp4.SeigEntry{IsProtected: true, KID: [16]byte{15: 1}, ConstantIV: []byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	w := mp4.NewGrowWriter(nil)
+	w.WriteSbgp(mp4.GroupingRoll, []mp4.SbgpEntry{{SampleCount: 1, GroupDescriptionIndex: 1}, {SampleCount: 9}})
+	w.WriteSgpd(mp4.GroupingRoll, [][]byte{mp4.RollEntry{RollDistance: -1}.Append(nil)})
+	w.WriteSgpd(mp4.GroupingSeig, [][]byte{seig.Append(nil), mp4.SeigEntry{PerSampleIVSize: 8}.Append(nil)})
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mp4.NewReader(w.Bytes())
+	r.Next()
+	sbgp := mp4.NewSbgpIter(r.Data(), r.Version())
+	if sbgp.GroupingType() != mp4.GroupingRoll || sbgp.Count() != 2 {
+		t.Fatalf("sbgp grouping %q count %d, want roll with 2 entries", sbgp.GroupingType(), sbgp.Count())
+	}
+	if e, _ := sbgp.Next(); e != (mp4.SbgpEntry{SampleCount: 1, GroupDescriptionIndex: 1}) {
+		t.Errorf("first sbgp entry = %+v", e)
+	}
+
+	r.Next()
+	sgpd := mp4.NewSgpdIter(r.Data(), r.Version())
+	if sgpd.DefaultLength() != 2 {
+		t.Errorf("roll sgpd default length = %d, want 2", sgpd.DefaultLength())
+	}
+	d, _ := sgpd.Next()
+	if roll, err := mp4.ReadRollEntry(d); err != nil || roll.RollDistance != -1 {
+		t.Errorf("ReadRollEntry = %+v, %v, want roll distance -1", roll, err)
+	}
+
+	// Entries of different lengths are written with their own lengths.
+	r.Next()
+	sgpd = mp4.NewSgpdIter(r.Data(), r.Version())
+	if sgpd.DefaultLength() != 0 || sgpd.Count() != 2 {
+		t.Fatalf("seig sgpd default length %d count %d, want 0 and 2", sgpd.DefaultLength(), sgpd.Count())
+	}
+	d, _ = sgpd.Next()
+	got, err := mp4.ReadSeigEntry(d)
+	if err != nil || got.KID != seig.KID || !bytes.Equal(got.ConstantIV, seig.ConstantIV) {
+		t.Errorf("ReadSeigEntry = %+v, %v, want %+v", got, err, seig)
+	}
+	if d, _ = sgpd.Next(); len(d) != 20 {
+		t.Errorf("second seig entry is %d bytes, want 20", len(d))
+	}
+	if _, ok := sgpd.Next(); ok {
+		t.Error("sgpd iterator returned more entries than its count")
+	}
+}
+
+func TestWriteLanguage(t *testing.T) {
+	w := mp4.NewGrowWriter(nil)
+	w.WriteMdhd(48000, 0, "fra")
+	w.WriteElng("fr-CA")
+	w.WriteMdhd(48000, 0, "FR") // not a code; written as und
+
+	r := mp4.NewReader(w.Bytes())
+	for _, want := range []string{"fra", "fr-CA", "und"} {
+		r.Next()
+		var got string
+		if r.Type() == mp4.TypeElng {
+			got = r.ReadElng()
+		} else {
+			_, _, got = r.ReadMdhd()
+		}
+		if got != want {
+			t.Errorf("%s language = %q, want %q", r.Type(), got, want)
+		}
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for packed, want := range map[uint16]string{0: "eng", 0x15c7: "eng", 0x7fff: "und", 0x0002: "und", 0x1a45: "fre"} {
+		if got := mp4.DecodeLanguage(packed); got != want {
+			t.Errorf("DecodeLanguage(%#x) = %q, want %q", packed, got, want)
+		}
+	}
+}
+
+func TestWriteEsds(t *testing.T) {
+	want := mp4.ESDescriptor{
+		ESID:           2,
+		StreamPriority: 3,
+		DependsOnESID:  1,
+		URL:            "rtsp://example.com/audio",
+		OCRESID:        5,
+		DecoderConfig: mp4.DecoderConfigDescriptor{
+			ObjectTypeIndication: mp4.ObjectTypeMPEG4Audio,
+			StreamType:           mp4.StreamTypeAudio,
+			BufferSizeDB:         0x012345,
+			MaxBitrate:           192000,
+			AvgBitrate:           128000,
+			DecoderSpecificInfo:  []byte{0x12, 0x10},
+			Other:                []mp4.Descriptor{{Tag: 0x14, Data: []byte{1}}},
+		},
+		SLConfig: mp4.SLConfigDescriptor{Predefined: mp4.SLPredefinedMP4},
+		Other:    []mp4.Descriptor{{Tag: 0x0a, Data: make([]byte, 200)}}, // two-byte length
+	}
+	w := mp4.NewGrowWriter(nil)
+	w.WriteEsds(&want)
+	r := mp4.NewReader(w.Bytes())
+	if !r.Next() || r.Type() != mp4.TypeEsds {
+		t.Fatalf("no esds box: %v", r.Err())
+	}
+	got, err := mp4.ReadESDescriptor(r.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadESDescriptor = %+v\nwant %+v", got, want)
+	}
+
+	// ffmpeg pads every length to four bytes.
+	padded := []byte{
+		0x03, 0x80, 0x80, 0x80, 0x22, 0x00, 0x01, 0x00,
+		0x04, 0x80, 0x80, 0x80, 0x14, 0x40, 0x15, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0xf4, 0x00, 0x00, 0x01, 0xf4, 0x00,
+		0x05, 0x80, 0x80, 0x80, 0x02, 0x12, 0x10,
+		0x06, 0x80, 0x80, 0x80, 0x01, 0x02,
+	}
+	es, err := mp4.ReadESDescriptor(padded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := es.DecoderConfig
+	if es.ESID != 1 || dc.StreamType != mp4.StreamTypeAudio || dc.MaxBitrate != 128000 || !bytes.Equal(dc.DecoderSpecificInfo, []byte{0x12, 0x10}) {
+		t.Errorf("ReadESDescriptor = %+v", es)
+	}
+	es.DecoderConfig.AvgBitrate = 96000
+	w.Reset()
+	w.WriteEsds(&es)
+	b := w.Bytes()
+	if len(b) != 12+27 {
+		t.Errorf("rewritten esds is %d bytes, want %d", len(b), 12+27)
+	}
+	if got, _ := mp4.ReadESDescriptor(b[12:]); got.DecoderConfig.AvgBitrate != 96000 {
+		t.Errorf("avg bitrate = %d, want 96000", got.DecoderConfig.AvgBitrate)
+	}
+	if got := mp4.ReadEsdsCodec(b[12:]); got != "40.2" {
+		t.Errorf("ReadEsdsCodec = %q, want 40.2", got)
+	}
+	es.DecoderConfig.ObjectTypeIndication = 0xdd // Vorbis
+	w.Reset()
+	w.WriteEsds(&es)
+	if got := mp4.ReadEsdsCodec(w.Bytes()[12:]); got != "dd" {
+		t.Errorf("ReadEsdsCodec = %q, want dd", got)
+	}
+
+	for _, tc := range []struct {
+		data []byte
+		err  error
+	}{
+		{padded[:20], mp4.ErrShortBox},
+		{padded[8:], mp4.ErrInvalidDescriptor},                           // not an ES_Descriptor
+		{[]byte{0x03, 0x03, 0x00, 0x01, 0x00}, mp4.ErrInvalidDescriptor}, // no decoder config
+		{[]byte{0x03, 0x80, 0x80, 0x80, 0x80, 0x01}, mp4.ErrInvalidDescriptor},
+	} {
+		if _, err := mp4.ReadESDescriptor(tc.data); !errors.Is(err, tc.err) {
+			t.Errorf("ReadESDescriptor(% x) error = %v, want %v", tc.data, err, tc.err)
+		}
+	}
+}